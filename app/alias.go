@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// isAliasName reports whether name can be defined as an alias: a word
+// without quoting, expansions or slashes, which could never be read back as
+// the plain word it replaces.
+func isAliasName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\n/\\$`'\"=;&|<>()")
+}
+
+// aliasDefinition returns the alias command that defines name as value.
+func aliasDefinition(name, value string) string {
+	return "alias " + name + "=" + quoteString(value)
+}
+
+func (sh *Shell) executeAliasCmd(cmd *Command) int {
+	args := cmd.Args
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+		if opt != "-p" {
+			fmt.Fprintf(cmd.Stderr, "alias: %s: invalid option\n", opt)
+			fmt.Fprintln(cmd.Stderr, "alias: usage: alias [-p] [name[=value] ... ]")
+			return 2
+		}
+	}
+
+	if len(args) == 0 {
+		for _, name := range slices.Sorted(maps.Keys(sh.aliases)) {
+			fmt.Fprintln(cmd.Stdout, aliasDefinition(name, sh.aliases[name]))
+		}
+		return 0
+	}
+
+	status := 0
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			value, found := sh.aliases[name]
+			if !found {
+				fmt.Fprintf(cmd.Stderr, "alias: %s: not found\n", name)
+				status = 1
+				continue
+			}
+			fmt.Fprintln(cmd.Stdout, aliasDefinition(name, value))
+			continue
+		}
+
+		if !isAliasName(name) {
+			fmt.Fprintf(cmd.Stderr, "alias: `%s': invalid alias name\n", name)
+			status = 1
+			continue
+		}
+		sh.aliases[name] = value
+	}
+	return status
+}
+
+func (sh *Shell) executeUnaliasCmd(cmd *Command) int {
+	args := cmd.Args
+	if len(args) > 0 && args[0] == "-a" {
+		clear(sh.aliases)
+		return 0
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(cmd.Stderr, "unalias: usage: unalias [-a] name [name ...]")
+		return 2
+	}
+
+	status := 0
+	for _, name := range args {
+		if _, ok := sh.aliases[name]; !ok {
+			fmt.Fprintf(cmd.Stderr, "unalias: %s: not found\n", name)
+			status = 1
+			continue
+		}
+		delete(sh.aliases, name)
+	}
+	return status
+}
+
+// expandAlias replaces the word at position i, if it's an alias, with the
+// tokens of its value, and returns the number of tokens the word now spans.
+// The first word of the value is checked for an alias in turn, and so is the
+// word after it when the value ends in a blank. A word coming from an alias
+// is never expanded as that same alias again, which ends the recursion.
+func (p *parser) expandAlias(i int) (int, error) {
+	if i >= len(p.tokens) {
+		return 0, nil
+	}
+	tok := p.tokens[i]
+	value, ok := p.aliases[tok.text]
+	if !ok || tok.kind != tokWord || slices.Contains(tok.aliases, tok.text) {
+		return 1, nil
+	}
+
+	tokens, err := tokenize(value)
+	if err != nil {
+		return 0, err
+	}
+
+	// The words of the alias stand where its name was in the input
+	from := append(slices.Clone(tok.aliases), tok.text)
+	for j := range tokens {
+		tokens[j].start, tokens[j].end = tok.start, tok.end
+		tokens[j].aliases = from
+	}
+	p.tokens = slices.Replace(p.tokens, i, i+1, tokens...)
+
+	n := len(tokens)
+	if n > 0 {
+		m, err := p.expandAlias(i)
+		if err != nil {
+			return 0, err
+		}
+		n += m - 1
+	}
+	if strings.HasSuffix(value, " ") || strings.HasSuffix(value, "\t") {
+		if _, err := p.expandAlias(i + n); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestAlias(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"command word", "alias greet='echo hello'\ngreet world\n", "hello world\n"},
+		{"after assignments", "alias show='echo shown'\nX=1 show\n", "shown\n"},
+		{"not as an argument", "alias x=y\necho x\n", "x\n"},
+		{"quoted", "alias ls='echo no'\n'ls' -d .\n\\ls -d .\n", ".\n.\n"},
+		{"operators", "alias both='echo a; echo b'\nboth | tr a-z A-Z\n", "a\nB\n"},
+		{"reserved word", "alias when=if\nwhen true; then echo yes; fi\n", "yes\n"},
+		{"recursive", "alias echo='echo E'\necho x\n", "E x\n"},
+		{"chained", "alias a=b b='echo b'\na\n", "b\n"},
+		{"trailing blank", "alias run='echo ' it=expanded\nrun it\n", "expanded\n"},
+		{"empty", "alias nothing=''\nnothing\necho after\n", "after\n"},
+		{"listed", "alias b='x y' a=\"it's\"\nalias\nalias a\n", "alias a='it'\\''s'\nalias b='x y'\nalias a='it'\\''s'\n"},
+		{"type", "alias ll='ls -l'\ntype ll\ncommand -v ll\n", "ll is aliased to `ls -l'\nalias ll='ls -l'\n"},
+		{"unalias", "alias a=b c=d\nunalias a\nalias\nunalias -a\nalias\n", "alias c='d'\n"},
+		{"same line", "alias hi='echo hi'; hi 2>/dev/null || echo not yet\nhi\n", "not yet\nhi\n"},
+		{"in functions", "alias hi='echo hi'\nf() { hi; }\nunalias hi\nf\n", "hi\n"},
+	})
+}
+
+func TestAliasErrors(t *testing.T) {
+	_, stderr, status := runScript(t, "alias missing\nalias 'a/b=c'\n", "")
+	if want := "alias: missing: not found\nalias: `a/b': invalid alias name\n"; stderr != want || status != 1 {
+		t.Errorf("got %q with status %d, want %q with status 1", stderr, status, want)
+	}
+	_, stderr, status = runScript(t, "unalias missing\n", "")
+	if want := "unalias: missing: not found\n"; stderr != want || status != 1 {
+		t.Errorf("got %q with status %d, want %q with status 1", stderr, status, want)
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// arithOps lists the operators of arithmetic expressions, longest first so
+// that tokenizing is greedy.
+var arithOps = []string{
+	"<<=", ">>=",
+	"**", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "^=", "|=",
+	"+", "-", "*", "/", "%", "<", ">", "=", "!", "~", "&", "^", "|", "?", ":", ",", "(", ")",
+}
+
+// arithAssignOps lists the assignment operators, each but "=" made of the
+// binary operator it applies.
+var arithAssignOps = []string{"=", "*=", "/=", "%=", "+=", "-=", "<<=", ">>=", "&=", "^=", "|="}
+
+// arithLevels lists the left-associative binary operators by increasing
+// precedence.
+var arithLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// maxArithDepth bounds the recursion through variables whose values are
+// expressions themselves.
+const maxArithDepth = 1024
+
+// arith evaluates an arithmetic expression, as tokens.
+type arith struct {
+	sh     *Shell
+	expr   string
+	tokens []string
+	pos    int
+	depth  int
+
+	// skip is non-zero while evaluating operands whose value is discarded,
+	// like the right side of a short-circuited "&&", which must not have
+	// side effects
+	skip int
+}
+
+// evalArith evaluates an arithmetic expression with the shell's variables,
+// as in "$((...))".
+func (sh *Shell) evalArith(expr string) (int64, error) {
+	return sh.evalArithDepth(expr, 0)
+}
+
+func (sh *Shell) evalArithDepth(expr string, depth int) (int64, error) {
+	if depth > maxArithDepth {
+		return 0, fmt.Errorf("%s: expression recursion level exceeded", expr)
+	}
+
+	tokens, err := tokenizeArith(expr)
+	if err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+
+	a := &arith{sh: sh, expr: expr, tokens: tokens, depth: depth}
+	n, err := a.comma()
+	if err != nil {
+		return 0, err
+	}
+	if a.pos < len(a.tokens) {
+		return 0, a.syntaxError()
+	}
+	return n, nil
+}
+
+// executeLetCmd evaluates each argument as an arithmetic expression. The
+// status is 1 if the last one is 0, and 0 otherwise.
+func (sh *Shell) executeLetCmd(cmd *Command) int {
+	if len(cmd.Args) == 0 {
+		fmt.Fprintln(cmd.Stderr, "let: expression expected")
+		return 1
+	}
+
+	var n int64
+	for _, expr := range cmd.Args {
+		var err error
+		if n, err = sh.evalArith(expr); err != nil {
+			fmt.Fprintf(cmd.Stderr, "let: %v\n", err)
+			return 1
+		}
+	}
+	return btoi(n == 0)
+}
+
+// runArith evaluates the expression of an arithmetic command. Its status is
+// 0 when the value is non-zero, and 1 otherwise.
+func (sh *Shell) runArith(node *Arith, s Streams) int {
+	expr, err := sh.expandWord(node.Expr)
+	if err == nil {
+		var n int64
+		if n, err = sh.evalArith(expr); err == nil {
+			return btoi(n == 0)
+		}
+	}
+	fmt.Fprintf(s.Stderr, "((: %v\n", err)
+	return 1
+}
+
+func tokenizeArith(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+			continue
+
+		case isArithWordChar(c):
+			j := i
+			for j < len(expr) && (isArithWordChar(expr[j]) || expr[j] == '#') {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+			continue
+		}
+
+		op := ""
+		for _, o := range arithOps {
+			if strings.HasPrefix(expr[i:], o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("%s: syntax error: invalid arithmetic operator (error token is \"%s\")", expr, expr[i:])
+		}
+		tokens = append(tokens, op)
+		i += len(op)
+	}
+	return tokens, nil
+}
+
+func isArithWordChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (a *arith) peek() string {
+	if a.pos >= len(a.tokens) {
+		return ""
+	}
+	return a.tokens[a.pos]
+}
+
+func (a *arith) syntaxError() error {
+	if a.pos >= len(a.tokens) {
+		return fmt.Errorf("%s: syntax error: operand expected", a.expr)
+	}
+	return fmt.Errorf("%s: syntax error in expression (error token is \"%s\")",
+		a.expr, strings.Join(a.tokens[a.pos:], " "))
+}
+
+func (a *arith) comma() (int64, error) {
+	n, err := a.assignment()
+	for err == nil && a.peek() == "," {
+		a.pos++
+		n, err = a.assignment()
+	}
+	return n, err
+}
+
+func (a *arith) assignment() (int64, error) {
+	if a.pos+1 < len(a.tokens) && isName(a.tokens[a.pos]) {
+		name, op := a.tokens[a.pos], a.tokens[a.pos+1]
+		if slices.Contains(arithAssignOps, op) {
+			a.pos += 2
+			n, err := a.assignment()
+			if err != nil {
+				return 0, err
+			}
+			if op != "=" {
+				cur, err := a.variable(name)
+				if err != nil {
+					return 0, err
+				}
+				if n, err = a.apply(op[:len(op)-1], cur, n); err != nil {
+					return 0, err
+				}
+			}
+			return n, a.setVariable(name, n)
+		}
+	}
+	return a.conditional()
+}
+
+func (a *arith) conditional() (int64, error) {
+	cond, err := a.binary(0)
+	if err != nil || a.peek() != "?" {
+		return cond, err
+	}
+	a.pos++
+
+	if cond == 0 {
+		a.skip++
+	}
+	then, err := a.assignment()
+	if cond == 0 {
+		a.skip--
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if a.peek() != ":" {
+		return 0, a.syntaxError()
+	}
+	a.pos++
+
+	if cond != 0 {
+		a.skip++
+	}
+	otherwise, err := a.assignment()
+	if cond != 0 {
+		a.skip--
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if cond != 0 {
+		return then, nil
+	}
+	return otherwise, nil
+}
+
+func (a *arith) binary(level int) (int64, error) {
+	if level == len(arithLevels) {
+		return a.power()
+	}
+
+	left, err := a.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for slices.Contains(arithLevels[level], a.peek()) {
+		op := a.peek()
+		a.pos++
+
+		// The right side of a short-circuited "&&" or "||" is parsed but
+		// not evaluated
+		short := (op == "&&" && left == 0) || (op == "||" && left != 0)
+		if short {
+			a.skip++
+		}
+		right, err := a.binary(level + 1)
+		if short {
+			a.skip--
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if left, err = a.apply(op, left, right); err != nil {
+			return 0, err
+		}
+	}
+	return left, nil
+}
+
+// power parses the right-associative "**".
+func (a *arith) power() (int64, error) {
+	base, err := a.unary()
+	if err != nil || a.peek() != "**" {
+		return base, err
+	}
+	a.pos++
+
+	exp, err := a.power()
+	if err != nil {
+		return 0, err
+	}
+	return a.apply("**", base, exp)
+}
+
+func (a *arith) unary() (int64, error) {
+	switch op := a.peek(); op {
+	case "++", "--":
+		a.pos++
+		name := a.peek()
+		if !isName(name) {
+			return 0, a.syntaxError()
+		}
+		a.pos++
+
+		n, err := a.variable(name)
+		if err != nil {
+			return 0, err
+		}
+		if op == "++" {
+			n++
+		} else {
+			n--
+		}
+		return n, a.setVariable(name, n)
+
+	case "-", "+", "!", "~":
+		a.pos++
+		n, err := a.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "-":
+			return -n, nil
+		case "!":
+			return btoi64(n == 0), nil
+		case "~":
+			return ^n, nil
+		}
+		return n, nil
+	}
+
+	return a.postfix()
+}
+
+func (a *arith) postfix() (int64, error) {
+	tok := a.peek()
+	switch {
+	case tok == "(":
+		a.pos++
+		n, err := a.comma()
+		if err != nil {
+			return 0, err
+		}
+		if a.peek() != ")" {
+			return 0, a.syntaxError()
+		}
+		a.pos++
+		return n, nil
+
+	case isName(tok):
+		a.pos++
+		n, err := a.variable(tok)
+		if err != nil {
+			return 0, err
+		}
+		if op := a.peek(); op == "++" || op == "--" {
+			a.pos++
+			next := n + 1
+			if op == "--" {
+				next = n - 1
+			}
+			if err := a.setVariable(tok, next); err != nil {
+				return 0, err
+			}
+		}
+		return n, nil
+
+	case tok != "" && tok[0] >= '0' && tok[0] <= '9':
+		a.pos++
+		return parseArithNumber(a.expr, tok)
+	}
+
+	return 0, a.syntaxError()
+}
+
+// variable returns the value of a variable in an expression. Unset and empty
+// variables are 0, and a value that isn't a number is evaluated as an
+// expression in turn.
+func (a *arith) variable(name string) (int64, error) {
+	value, _ := a.sh.getVar(name)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n, nil
+	}
+	return a.sh.evalArithDepth(value, a.depth+1)
+}
+
+func (a *arith) setVariable(name string, n int64) error {
+	if a.skip > 0 {
+		return nil
+	}
+	return a.sh.assignVar(name, strconv.FormatInt(n, 10))
+}
+
+// apply applies a binary operator.
+func (a *arith) apply(op string, x, y int64) (int64, error) {
+	switch op {
+	case "||":
+		return btoi64(x != 0 || y != 0), nil
+	case "&&":
+		return btoi64(x != 0 && y != 0), nil
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	case "&":
+		return x & y, nil
+	case "==":
+		return btoi64(x == y), nil
+	case "!=":
+		return btoi64(x != y), nil
+	case "<":
+		return btoi64(x < y), nil
+	case ">":
+		return btoi64(x > y), nil
+	case "<=":
+		return btoi64(x <= y), nil
+	case ">=":
+		return btoi64(x >= y), nil
+	case "<<":
+		return x << uint64(y&63), nil
+	case ">>":
+		return x >> uint64(y&63), nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			if a.skip > 0 {
+				return 0, nil
+			}
+			return 0, fmt.Errorf("%s: division by 0", a.expr)
+		}
+		if op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "**":
+		if y < 0 {
+			return 0, fmt.Errorf("%s: exponent less than 0", a.expr)
+		}
+		n := int64(1)
+		for ; y > 0; y-- {
+			n *= x
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("%s: syntax error in expression (error token is \"%s\")", a.expr, op)
+}
+
+// parseArithNumber parses an integer constant: decimal, octal with a leading
+// 0, hexadecimal with a leading 0x, or in any base from 2 to 64 as base#n.
+func parseArithNumber(expr, tok string) (int64, error) {
+	invalid := fmt.Errorf("%s: value too great for base (error token is \"%s\")", expr, tok)
+
+	if base, digits, ok := strings.Cut(tok, "#"); ok {
+		b, err := strconv.Atoi(base)
+		if err != nil || b < 2 || b > 64 || digits == "" {
+			return 0, fmt.Errorf("%s: invalid arithmetic base (error token is \"%s\")", expr, tok)
+		}
+
+		// Past base 36, lowercase letters come before uppercase ones, then
+		// "@" and "_"
+		var n int64
+		for _, c := range digits {
+			var d int
+			switch {
+			case c >= '0' && c <= '9':
+				d = int(c - '0')
+			case c >= 'a' && c <= 'z':
+				d = int(c-'a') + 10
+			case c >= 'A' && c <= 'Z':
+				d = int(c-'A') + 10
+				if b > 36 {
+					d += 26
+				}
+			case c == '@':
+				d = 62
+			case c == '_':
+				d = 63
+			default:
+				return 0, invalid
+			}
+			if d >= b {
+				return 0, invalid
+			}
+			n = n*int64(b) + int64(d)
+		}
+		return n, nil
+	}
+
+	base, digits := 10, tok
+	switch {
+	case strings.HasPrefix(tok, "0x") || strings.HasPrefix(tok, "0X"):
+		base, digits = 16, tok[2:]
+	case len(tok) > 1 && tok[0] == '0':
+		base, digits = 8, tok[1:]
+	}
+
+	n, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return 0, invalid
+	}
+	return n, nil
+}
+
+func btoi64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestLet(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"assignment", "let \"x = 2 + 3\"\necho $x $?\n", "5 0\n"},
+		{"increment", "x=5\nlet x++\necho $x\nlet x--\nlet x--\necho $x\n", "6\n4\n"},
+		{"compound assignment", "x=4\nlet x+=10 x-=2\necho $x\nlet 'x *= 2'\necho $x\n", "12\n24\n"},
+		{"several expressions", "let \"z = 3 * 2\" \"w = z % 4\"\necho $z $w\n", "6 2\n"},
+		{"zero result", "let \"y = 0\"; echo $? $y\nlet 0; echo $?\nlet x=0 1; echo $?\nlet 1 0; echo $?\n", "1 0\n1\n0\n1\n"},
+		{"post-increment of zero", "i=0\nlet i++; echo $? $i\nlet ++i; echo $? $i\n", "1 1\n0 2\n"},
+		{"as a condition", "i=0\nwhile let \"i < 3\"; do let i++; done\necho $i\n", "3\n"},
+		{"errors", "let 2>/dev/null; echo $?\nlet '1 +' 2>/dev/null; echo $?\n", "1\n1\n"},
+	})
+}
+
+func TestArithCommand(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"if condition", "count=2\nif (( count > 0 )); then echo positive; fi\nif ((count > 5)); then echo big; else echo small; fi\n", "positive\nsmall\n"},
+		{"while condition", "i=0\nwhile (( i < 3 )); do echo $i; (( i++ )); done\n", "0\n1\n2\n"},
+		{"status", "(( 5 )); echo $?\n(( 0 )); echo $?\n(( x = 0 )); echo $? $x\n", "0\n1\n1 0\n"},
+		{"side effects", "i=4\n(( i++ ))\n((j = i * 2))\necho $i $j\n", "5 10\n"},
+		{"logical operators", "(( 1 && 0 )) || echo or\n(( (1 + 2) * 3 == 9 )) && echo and\n", "or\nand\n"},
+		{"parameters", "n=3\n(( $n == 3 )) && echo expanded\n", "expanded\n"},
+		{"syntax error", "(( 1 + )) 2>/dev/null; echo $?\n", "1\n"},
+	})
+}
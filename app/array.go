@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// indexedArray is the value of an indexed array. Arrays may be sparse, so
+// only the elements that are set are kept, in the order of their indexes.
+type indexedArray struct {
+	indexes []int
+	values  []string
+}
+
+// newArray returns an array of the elements, indexed from 0.
+func newArray(elems []string) *indexedArray {
+	a := &indexedArray{indexes: make([]int, len(elems)), values: slices.Clone(elems)}
+	for i := range elems {
+		a.indexes[i] = i
+	}
+	if a.values == nil {
+		a.values = []string{}
+	}
+	return a
+}
+
+func (a *indexedArray) clone() *indexedArray {
+	return &indexedArray{indexes: slices.Clone(a.indexes), values: slices.Clone(a.values)}
+}
+
+// end returns the index past the last element, where negative subscripts
+// count back from.
+func (a *indexedArray) end() int {
+	if len(a.indexes) == 0 {
+		return 0
+	}
+	return a.indexes[len(a.indexes)-1] + 1
+}
+
+func (a *indexedArray) get(i int) (string, bool) {
+	if j, ok := slices.BinarySearch(a.indexes, i); ok {
+		return a.values[j], true
+	}
+	return "", false
+}
+
+func (a *indexedArray) set(i int, value string) {
+	j, ok := slices.BinarySearch(a.indexes, i)
+	if ok {
+		a.values[j] = value
+		return
+	}
+	a.indexes = slices.Insert(a.indexes, j, i)
+	a.values = slices.Insert(a.values, j, value)
+}
+
+func (a *indexedArray) unset(i int) {
+	if j, ok := slices.BinarySearch(a.indexes, i); ok {
+		a.indexes = slices.Delete(a.indexes, j, j+1)
+		a.values = slices.Delete(a.values, j, j+1)
+	}
+}
+
+// cutSubscript splits a reference to an array element, "NAME[subscript]",
+// into the name and the subscript.
+func cutSubscript(s string) (string, string, bool) {
+	i := strings.IndexByte(s, '[')
+	if i < 0 || !strings.HasSuffix(s, "]") || !isName(s[:i]) {
+		return "", "", false
+	}
+	return s[:i], s[i+1 : len(s)-1], true
+}
+
+// getArray returns the array of a variable. Any other variable is an array
+// of a single element, and an unset one an empty array. The array is only
+// for reading.
+func (sh *Shell) getArray(name string) *indexedArray {
+	v, ok := sh.vars[name]
+	switch {
+	case !ok:
+		return &indexedArray{}
+	case v.array != nil:
+		return v.array
+	}
+	return newArray([]string{v.value})
+}
+
+// arrayElements returns the values of the elements of a variable set, in
+// the order of their indexes.
+func (sh *Shell) arrayElements(name string) []string {
+	return sh.getArray(name).values
+}
+
+// arrayIndexes returns the indexes of the elements of a variable set.
+func (sh *Shell) arrayIndexes(name string) []string {
+	var indexes []string
+	for _, i := range sh.getArray(name).indexes {
+		indexes = append(indexes, strconv.Itoa(i))
+	}
+	return indexes
+}
+
+// arrayIndex evaluates the subscript of an element of an array, counting
+// back from end, the index past its last element, if negative.
+func (sh *Shell) arrayIndex(sub string, end int) (int, error) {
+	i, err := sh.evalArithWord(sub)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		i += int64(end)
+	}
+	return int(i), nil
+}
+
+// getElement returns an element of an array. A variable that isn't an array
+// is one of a single element.
+func (sh *Shell) getElement(name, sub string) (string, bool) {
+	a := sh.getArray(name)
+	if sub == "@" || sub == "*" {
+		return strings.Join(a.values, " "), len(a.values) > 0
+	}
+	i, err := sh.arrayIndex(sub, a.end())
+	if err != nil {
+		return "", false
+	}
+	return a.get(i)
+}
+
+// setArray sets a variable to an array of elements, keeping it exported if
+// it already was.
+func (sh *Shell) setArray(name string, elems []string) {
+	if v, ok := sh.vars[name]; ok {
+		v.value, v.array = "", newArray(elems)
+	} else {
+		sh.vars[name] = &variable{array: newArray(elems)}
+	}
+}
+
+// setElement sets element i of an array, making the variable an array if it
+// wasn't one.
+func (sh *Shell) setElement(name string, i int, value string) {
+	v, ok := sh.vars[name]
+	if !ok {
+		sh.setArray(name, nil)
+		v = sh.vars[name]
+	} else if v.array == nil {
+		sh.setArray(name, []string{v.value})
+	}
+	v.array.set(i, value)
+}
+
+// assignArray performs an array assignment, with raw the "(word ...)" part
+// of "NAME=(word ...)". The words are expanded like the arguments of a
+// command. With appending set, for "NAME+=(word ...)", they're added after
+// the elements already there.
+func (sh *Shell) assignArray(name, raw string, appending bool) error {
+	tokens, err := tokenize(strings.TrimSuffix(strings.TrimPrefix(raw, "("), ")"))
+	if err != nil {
+		return err
+	}
+	var words []string
+	for _, tok := range tokens {
+		if tok.kind == tokWord {
+			words = append(words, tok.text)
+		}
+	}
+
+	elems, err := sh.expandWords(words)
+	if err != nil {
+		return err
+	}
+	if _, ok := sh.vars[name]; ok && appending {
+		end := sh.getArray(name).end()
+		for i, elem := range elems {
+			sh.setElement(name, end+i, elem)
+		}
+		return nil
+	}
+	sh.setArray(name, elems)
+	return nil
+}
+
+// assignElement performs the assignment of an array element,
+// "NAME[subscript]=value".
+func (sh *Shell) assignElement(name, sub, value string) error {
+	i, err := sh.arrayIndex(sub, sh.getArray(name).end())
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return fmt.Errorf("%s[%s]: bad array subscript", name, sub)
+	}
+	sh.setElement(name, i, value)
+	return nil
+}
+
+// executeMapfileCmd reads lines of input into an array. With -C, a callback
+// command is evaluated every -c lines, 5000 by default, with the index of the
+// element to be assigned and the line as arguments.
+func (sh *Shell) executeMapfileCmd(cmd *Command) int {
+	args := cmd.Args
+	trim, count, skip := false, 0, 0 // a count of 0 reads every line
+	callback, quantum := "", 5000
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		switch opt {
+		case "-t":
+			trim = true
+		case "-C":
+			if len(args) == 0 {
+				fmt.Fprintf(cmd.Stderr, "%s: %s: option requires an argument\n", cmd.Exec, opt)
+				return 2
+			}
+			callback, args = args[0], args[1:]
+		case "-c":
+			if len(args) == 0 {
+				fmt.Fprintf(cmd.Stderr, "%s: %s: option requires an argument\n", cmd.Exec, opt)
+				return 2
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				fmt.Fprintf(cmd.Stderr, "%s: %s: invalid callback quantum\n", cmd.Exec, args[0])
+				return 1
+			}
+			quantum, args = n, args[1:]
+		case "-n", "-s":
+			if len(args) == 0 {
+				fmt.Fprintf(cmd.Stderr, "%s: %s: option requires an argument\n", cmd.Exec, opt)
+				return 2
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 0 {
+				fmt.Fprintf(cmd.Stderr, "%s: %s: invalid line count\n", cmd.Exec, args[0])
+				return 1
+			}
+			if opt == "-n" {
+				count = n
+			} else {
+				skip = n
+			}
+			args = args[1:]
+		default:
+			fmt.Fprintf(cmd.Stderr, "%s: %s: invalid option\n", cmd.Exec, opt)
+			fmt.Fprintf(cmd.Stderr, "%s: usage: %s [-t] [-n count] [-s count] [-C callback] [-c quantum] [array]\n", cmd.Exec, cmd.Exec)
+			return 2
+		}
+	}
+
+	name := "MAPFILE"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if !isName(name) {
+		fmt.Fprintf(cmd.Stderr, "%s: `%s': not a valid identifier\n", cmd.Exec, name)
+		return 1
+	}
+	if err := sh.checkWritable(name); err != nil {
+		fmt.Fprintf(cmd.Stderr, "%s: %v\n", cmd.Exec, err)
+		return 1
+	}
+
+	var lines []string
+	for count == 0 || len(lines) < count {
+		line, err := readLine(cmd.Stdin)
+		if line == "" && err != nil {
+			break
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if trim {
+			line = strings.TrimSuffix(line, "\n")
+		}
+		if callback != "" && (len(lines)+1)%quantum == 0 {
+			sh.mapfileCallback(cmd, callback, len(lines), line)
+		}
+		lines = append(lines, line)
+	}
+
+	sh.setArray(name, lines)
+	return 0
+}
+
+// mapfileCallback evaluates the callback command of mapfile, before element
+// i is assigned the line.
+func (sh *Shell) mapfileCallback(cmd *Command, callback string, i int, line string) {
+	list, err := sh.parse(callback + " " + strconv.Itoa(i) + " " + quoteString(line))
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "%v\n", err)
+		return
+	}
+	sh.runList(list, cmd.Streams)
+}
+
+// readLine reads a line of input, along with its newline if any. It reads
+// a byte at a time so as not to consume input past the line, which may be
+// left for another command.
+func readLine(r io.Reader) (string, error) {
+	var (
+		line []byte
+		b    [1]byte
+	)
+	for {
+		n, err := r.Read(b[:])
+		if n > 0 {
+			line = append(line, b[0])
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestReadarray(t *testing.T) {
+	file := "printf 'one\\ntwo words\\n\\nlast' >f.txt\n"
+	runScriptTests(t, []scriptTest{
+		{"lines", file + "readarray -t lines <f.txt\necho ${#lines[@]}\nprintf '[%s]' \"${lines[@]}\"\n", "4\n[one][two words][][last]"},
+		{"indexing", file + "readarray -t lines <f.txt\necho \"${lines[1]}\" \"${lines[3]}\" \"[${lines[9]}]\"\n", "two words last []\n"},
+		{"newlines kept", file + "mapfile lines <f.txt\nprintf '[%s]' \"${lines[@]}\"\n", "[one\n][two words\n][\n][last]"},
+		{"MAPFILE", "printf 'a\\nb\\n' | { mapfile -t; echo ${#MAPFILE[@]} ${MAPFILE[1]}; }\n", "2 b\n"},
+		{"no input", "readarray -t x </dev/null\necho ${#x[@]}\n", "0\n"},
+	})
+}
+
+func TestArrays(t *testing.T) {
+	arr := "a=(a 'b c' d)\n"
+	runScriptTests(t, []scriptTest{
+		{"assignment", arr + "echo ${a[0]} ${a[1]} ${a[2]} $a\n", "a b c d a\n"},
+		{"length", arr + "echo ${#a[@]} ${#a[*]} ${#a[1]}\n", "3 3 3\n"},
+		{"full expansion", arr + "printf '[%s]' \"${a[@]}\" ${a[*]}\necho\n", "[a][b c][d][a][b][c][d]\n"},
+		{"update", arr + "a[1]=x\na[-1]=last\necho ${a[@]}\n", "a x last\n"},
+		{"out of range", arr + "echo \"[${a[3]}]\" \"[${a[-9]}]\"\n", "[] []\n"},
+		{"appending", arr + "a+=(e f)\necho ${#a[@]} ${a[4]}\n", "5 f\n"},
+		{"plain variable", "b=plain\nb[2]=two\necho ${#b[@]} ${b[@]} $b\n", "2 plain two plain\n"},
+		{"empty", "c=()\necho ${#c[@]} \"[${c[@]}]\"\n", "0 []\n"},
+	})
+}
+
+func TestSparseArrays(t *testing.T) {
+	arr := "a=(a b c)\na[10]=z\n"
+	runScriptTests(t, []scriptTest{
+		{"length counts set elements", arr + "echo ${#a[@]}\n", "4\n"},
+		{"indexes", arr + "echo ${!a[@]}\nfor i in \"${!a[*]}\"; do echo \"[$i]\"; done\n", "0 1 2 10\n[0 1 2 10]\n"},
+		{"values", arr + "echo ${a[@]} \"[${a[5]}]\"\n", "a b c z []\n"},
+		{"negative index", arr + "echo ${a[-1]} \"[${a[-2]}]\"\n", "z []\n"},
+		{"appending after the last", arr + "a+=(n)\necho ${!a[@]}\n", "0 1 2 10 11\n"},
+		{"unset", arr + "unset 'a[1]' 'a[10]'\necho ${#a[@]} ${!a[@]} ${a[@]}\n", "2 0 2 a c\n"},
+		{"huge index", "a[4000000000]=big\necho ${#a[@]} ${!a[@]} ${a[4000000000]}\n", "1 4000000000 big\n"},
+		{"declare -p", arr + "declare -p a\n", "declare -a a=([0]=\"a\" [1]=\"b\" [2]=\"c\" [10]=\"z\")\n"},
+	})
+}
+
+func TestMapfileOptions(t *testing.T) {
+	file := "printf 'a\\nb\\nc\\nd\\n' >f.txt\n"
+	runScriptTests(t, []scriptTest{
+		{"trimmed", file + "mapfile -t lines <f.txt\necho ${#lines[@]}\nprintf '[%s]' \"${lines[@]}\"\n", "4\n[a][b][c][d]"},
+		{"count", file + "mapfile -t -n 2 lines <f.txt\necho \"${lines[@]}\"\n", "a b\n"},
+		{"count of zero", file + "mapfile -t -n 0 lines <f.txt\necho \"${lines[@]}\"\n", "a b c d\n"},
+		{"skipped", file + "mapfile -t -s 3 lines <f.txt\necho \"${lines[@]}\"\n", "d\n"},
+		{"skipped and counted", file + "mapfile -t -s 1 -n 2 lines <f.txt\necho \"${lines[@]}\"\n", "b c\n"},
+		{"all skipped", file + "mapfile -t -s 9 lines <f.txt\necho ${#lines[@]}\n", "0\n"},
+		{"from a pipe", "printf 'x\\ny\\nz\\n' | { mapfile -t -s 1 lines; echo \"${lines[@]}\"; }\n", "y z\n"},
+		{"bad counts", "mapfile -n x lines </dev/null; echo $?\nmapfile -s -1 lines </dev/null; echo $?\n", "1\n1\n"},
+	})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expandBraces performs brace expansion on a raw word: "a{b,c}d" expands to
+// "abd" and "acd", and "{1..3}" to "1", "2" and "3". Braces in quotes or in
+// a ${...} expansion are left alone.
+func expandBraces(word string) []string {
+	runes := []rune(word)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+			continue
+
+		case '\'', '"':
+			i = skipQuoted(runes, i)
+			continue
+
+		case '$':
+			if end, _ := readSubst(runes, i); end > i {
+				i = end - 1
+			}
+			continue
+
+		case '{':
+		default:
+			continue
+		}
+
+		end, alts := readBraces(runes, i)
+		if end < 0 {
+			continue
+		}
+
+		prefix, suffix := string(runes[:i]), string(runes[end+1:])
+		var words []string
+		for _, alt := range alts {
+			for _, rest := range expandBraces(alt + suffix) {
+				words = append(words, prefix+rest)
+			}
+		}
+		return words
+	}
+
+	return []string{word}
+}
+
+// skipQuoted returns the index of the quote closing the one at runes[i], or
+// the end of the runes if it's unterminated.
+func skipQuoted(runes []rune, i int) int {
+	quote := runes[i]
+	for i++; i < len(runes) && runes[i] != quote; i++ {
+		if quote == '"' && runes[i] == '\\' {
+			i++
+		}
+	}
+	return i
+}
+
+// readBraces reads the brace expression opened at runes[open], returning the
+// index of its closing brace along with the alternatives it expands to. It
+// returns -1 when the braces aren't a valid brace expression and stand for
+// themselves.
+func readBraces(runes []rune, open int) (int, []string) {
+	var (
+		alts  []string
+		start = open + 1
+		depth = 0
+	)
+
+	for i := open; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+
+		case '\'', '"':
+			i = skipQuoted(runes, i)
+
+		case '$':
+			if end, _ := readSubst(runes, i); end > i {
+				i = end - 1
+			}
+
+		case '{':
+			depth++
+
+		case ',':
+			if depth == 1 {
+				alts = append(alts, string(runes[start:i]))
+				start = i + 1
+			}
+
+		case '}':
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			if alts == nil {
+				seq, ok := braceSequence(string(runes[open+1 : i]))
+				if !ok {
+					return -1, nil
+				}
+				return i, seq
+			}
+			return i, append(alts, string(runes[start:i]))
+		}
+	}
+
+	return -1, nil
+}
+
+// braceSequence expands a sequence expression, "x..y[..step]", where x and
+// y are either both integers or both single letters.
+func braceSequence(expr string) ([]string, bool) {
+	parts := strings.Split(expr, "..")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, false
+	}
+
+	step := 1
+	if len(parts) == 3 {
+		n, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, false
+		}
+		step = max(n, -n, 1)
+	}
+
+	// Letters
+	if len(parts[0]) == 1 && len(parts[1]) == 1 && isLetter(parts[0][0]) && isLetter(parts[1][0]) {
+		var seq []string
+		for _, n := range sequence(int(parts[0][0]), int(parts[1][0]), step) {
+			seq = append(seq, string(rune(n)))
+		}
+		return seq, true
+	}
+
+	from, err1 := strconv.Atoi(parts[0])
+	to, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return nil, false
+	}
+
+	// Zero-padded bounds pad every number to the same width
+	width := 0
+	if isZeroPadded(parts[0]) || isZeroPadded(parts[1]) {
+		width = max(len(parts[0]), len(parts[1]))
+	}
+
+	var seq []string
+	for _, n := range sequence(from, to, step) {
+		seq = append(seq, fmt.Sprintf("%0*d", width, n))
+	}
+	return seq, true
+}
+
+// sequence returns the numbers from one bound to the other, in steps.
+func sequence(from, to, step int) []int {
+	var seq []int
+	if from <= to {
+		for n := from; n <= to; n += step {
+			seq = append(seq, n)
+		}
+	} else {
+		for n := from; n >= to; n -= step {
+			seq = append(seq, n)
+		}
+	}
+	return seq
+}
+
+func isZeroPadded(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
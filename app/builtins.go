@@ -0,0 +1,762 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Command is a simple command after expansion, ready to run.
+type Command struct {
+	Exec      string
+	Args      []string
+	Redirects []Redirect
+
+	// ownPath is set when PATH is assigned for the command alone, which
+	// is then looked up there rather than in the hash table
+	ownPath bool
+
+	Streams
+}
+
+// builtins maps the name of every builtin command to its implementation,
+// which returns the command's exit status.
+var builtins map[string]func(*Shell, *Command) int
+
+func init() {
+	builtins = map[string]func(*Shell, *Command) int{
+		"exit":      (*Shell).executeExitCmd,
+		"logout":    (*Shell).executeLogoutCmd,
+		"echo":      (*Shell).executeEchoCmd,
+		"type":      (*Shell).executeTypeCmd,
+		"pwd":       (*Shell).executePwdCmd,
+		"cd":        (*Shell).executeCdCmd,
+		"pushd":     (*Shell).executePushdCmd,
+		"popd":      (*Shell).executePopdCmd,
+		"dirs":      (*Shell).executeDirsCmd,
+		"jobs":      (*Shell).executeJobsCmd,
+		"fg":        (*Shell).executeFgCmd,
+		"bg":        (*Shell).executeBgCmd,
+		"wait":      (*Shell).executeWaitCmd,
+		"disown":    (*Shell).executeDisownCmd,
+		"suspend":   (*Shell).executeSuspendCmd,
+		"kill":      (*Shell).executeKillCmd,
+		"trap":      (*Shell).executeTrapCmd,
+		"set":       (*Shell).executeSetCmd,
+		"shopt":     (*Shell).executeShoptCmd,
+		"alias":     (*Shell).executeAliasCmd,
+		"unalias":   (*Shell).executeUnaliasCmd,
+		"complete":  (*Shell).executeCompleteCmd,
+		"hash":      (*Shell).executeHashCmd,
+		"break":     (*Shell).executeBreakCmd,
+		"continue":  (*Shell).executeContinueCmd,
+		"shift":     (*Shell).executeShiftCmd,
+		"return":    (*Shell).executeReturnCmd,
+		"local":     (*Shell).executeLocalCmd,
+		"declare":   (*Shell).executeDeclareCmd,
+		"typeset":   (*Shell).executeDeclareCmd,
+		"readonly":  (*Shell).executeReadonlyCmd,
+		"unset":     (*Shell).executeUnsetCmd,
+		"getopts":   (*Shell).executeGetoptsCmd,
+		"history":   (*Shell).executeHistoryCmd,
+		"fc":        (*Shell).executeFcCmd,
+		"mapfile":   (*Shell).executeMapfileCmd,
+		"readarray": (*Shell).executeMapfileCmd,
+		"command":   (*Shell).executeCommandCmd,
+		"builtin":   (*Shell).executeBuiltinCmd,
+		"eval":      (*Shell).executeEvalCmd,
+		"source":    (*Shell).executeSourceCmd,
+		".":         (*Shell).executeSourceCmd,
+		"let":       (*Shell).executeLetCmd,
+		"repeat":    (*Shell).executeRepeatCmd,
+		"exec":      (*Shell).executeExecCmd,
+		"times":     (*Shell).executeTimesCmd,
+		"caller":    (*Shell).executeCallerCmd,
+		"enable":    (*Shell).executeEnableCmd,
+	}
+}
+
+// builtinNames returns the names of all builtins, sorted.
+func builtinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// builtin returns the implementation of the builtin named name, unless it's
+// been disabled.
+func (sh *Shell) builtin(name string) (func(*Shell, *Command) int, bool) {
+	builtin, ok := builtins[name]
+	if !ok || sh.disabled[name] {
+		return nil, false
+	}
+	return builtin, true
+}
+
+// executeEnableCmd enables the builtins named, or disables them with -n, so
+// that the programs of the same names run instead. Without names, it lists
+// the enabled builtins, the disabled ones with -n, or all of them with -a.
+func (sh *Shell) executeEnableCmd(cmd *Command) int {
+	args := cmd.Args
+	var disable, all bool
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+		for _, c := range opt[1:] {
+			switch c {
+			case 'n':
+				disable = true
+			case 'a':
+				all = true
+			case 'p':
+			default:
+				fmt.Fprintf(cmd.Stderr, "enable: -%c: invalid option\n", c)
+				fmt.Fprintln(cmd.Stderr, "enable: usage: enable [-anp] [name ...]")
+				return 2
+			}
+		}
+	}
+
+	if len(args) == 0 {
+		for _, name := range builtinNames() {
+			switch {
+			case sh.disabled[name] && (all || disable):
+				fmt.Fprintf(cmd.Stdout, "enable -n %s\n", name)
+			case !sh.disabled[name] && (all || !disable):
+				fmt.Fprintf(cmd.Stdout, "enable %s\n", name)
+			}
+		}
+		return 0
+	}
+
+	status := 0
+	for _, name := range args {
+		if _, ok := builtins[name]; !ok {
+			fmt.Fprintf(cmd.Stderr, "enable: %s: not a shell builtin\n", name)
+			status = 1
+			continue
+		}
+		if disable {
+			if sh.disabled == nil {
+				sh.disabled = make(map[string]bool)
+			}
+			sh.disabled[name] = true
+		} else {
+			delete(sh.disabled, name)
+		}
+	}
+	return status
+}
+
+func (sh *Shell) executeExitCmd(cmd *Command) int {
+	if len(cmd.Args) <= 0 {
+		sh.exit(sh.status)
+		return sh.status
+	}
+
+	// Parse the exit code
+	exitCode, err := strconv.Atoi(cmd.Args[0])
+	if err != nil {
+		fmt.Fprintln(cmd.Stderr, "Error reading exit code: ", err)
+		exitCode = 1
+	}
+	sh.exit(exitCode)
+	return exitCode
+}
+
+func (sh *Shell) executeLogoutCmd(cmd *Command) int {
+	if !sh.login {
+		fmt.Fprintln(cmd.Stderr, "logout: not login shell: use 'exit'")
+		return 1
+	}
+	return sh.executeExitCmd(cmd)
+}
+
+func (sh *Shell) executeEchoCmd(cmd *Command) int {
+	args := cmd.Args
+	newline, escapes := true, sh.opts.xpgEcho
+	for len(args) > 0 && isEchoOptions(args[0]) {
+		for _, c := range args[0][1:] {
+			switch c {
+			case 'n':
+				newline = false
+			case 'e':
+				escapes = true
+			case 'E':
+				escapes = false
+			}
+		}
+		args = args[1:]
+	}
+
+	out := strings.Join(args, " ")
+	if escapes {
+		var stop bool
+		if out, stop = expandEscapes(out, false); stop {
+			newline = false
+		}
+	}
+	if newline {
+		out += "\n"
+	}
+	if _, err := fmt.Fprint(cmd.Stdout, out); err != nil {
+		// Like with its output closed by ">&-"
+		if errors.Is(err, os.ErrClosed) {
+			err = errors.New("Bad file descriptor")
+		}
+		fmt.Fprintf(cmd.Stderr, "echo: write error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// isEchoOptions reports whether an argument of echo is a group of its
+// options, like "-ne", rather than text to print.
+func isEchoOptions(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-' && strings.Trim(arg[1:], "neE") == ""
+}
+
+// expandEscapes interprets the backslash escapes of "echo -e" in s, reporting
+// whether a "\c" cut the output short. With ansiC set, it interprets those of
+// $'...' quoting instead, where octal values need no leading 0, "\cX" is the
+// control character for X, and quotes and "?" can be escaped.
+func expandEscapes(s string, ansiC bool) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+
+		if ansiC {
+			switch c := s[i]; {
+			case c == '\'' || c == '"' || c == '?':
+				b.WriteByte(c)
+				continue
+			case c == 'c' && i+1 < len(s):
+				i++
+				b.WriteByte(s[i] & 0x1f)
+				continue
+			case c >= '0' && c <= '7':
+				n, width := escapeDigits(s[i:], 3, 8)
+				b.WriteByte(byte(n))
+				i += width - 1
+				continue
+			}
+		}
+
+		switch c := s[i]; c {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'c':
+			return b.String(), true
+		case 'e', 'E':
+			b.WriteByte(0x1b)
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '\\':
+			b.WriteByte('\\')
+		case '0':
+			n, width := escapeDigits(s[i+1:], 3, 8)
+			b.WriteByte(byte(n))
+			i += width
+		case 'x', 'u', 'U':
+			size := 2
+			if c == 'u' {
+				size = 4
+			} else if c == 'U' {
+				size = 8
+			}
+			n, width := escapeDigits(s[i+1:], size, 16)
+			switch {
+			case width == 0:
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c == 'x':
+				b.WriteByte(byte(n))
+			default:
+				b.WriteRune(rune(n))
+			}
+			i += width
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), false
+}
+
+// escapeDigits reads the value of up to max digits in base at the start of
+// s, returning it along with the number of digits read.
+func escapeDigits(s string, max, base int) (int, int) {
+	n, width := 0, 0
+	for width < max && width < len(s) {
+		d, err := strconv.ParseInt(s[width:width+1], base, 0)
+		if err != nil {
+			break
+		}
+		n = n*base + int(d)
+		width++
+	}
+	return n, width
+}
+
+// isShellKeyword reports whether name is a reserved word, which the shell
+// reads as part of a command's syntax before looking for a command by name.
+func isShellKeyword(name string) bool {
+	return name == "!" || slices.Contains(reservedWords, name)
+}
+
+func (sh *Shell) executeTypeCmd(cmd *Command) int {
+	status := 0
+	for _, name := range cmd.Args {
+		if value, ok := sh.aliases[name]; ok {
+			fmt.Fprintf(cmd.Stdout, "%s is aliased to `%s'\n", name, value)
+			continue
+		}
+		if isShellKeyword(name) {
+			fmt.Fprintf(cmd.Stdout, "%s is a shell keyword\n", name)
+			continue
+		}
+		if fn, ok := sh.funcs[name]; ok {
+			fmt.Fprintf(cmd.Stdout, "%s is a function\n%s\n", name, fn.Source)
+			continue
+		}
+		if _, ok := sh.builtin(name); ok {
+			fmt.Fprintf(cmd.Stdout, "%s is a shell builtin\n", name)
+			continue
+		}
+		if e, ok := sh.hashed[name]; ok {
+			fmt.Fprintf(cmd.Stdout, "%s is hashed (%s)\n", name, e.path)
+			continue
+		}
+
+		exePath, err := sh.getExecutablePath(name)
+		if errors.Is(err, errPermissionDenied) || errors.Is(err, errIsDirectory) {
+			fmt.Fprintf(cmd.Stderr, "%s: not found\n", name)
+			status = 1
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(cmd.Stderr, "%v\n", err)
+			status = 1
+			continue
+		}
+
+		fmt.Fprintf(cmd.Stdout, "%v is %v\n", name, exePath)
+	}
+	return status
+}
+
+func (sh *Shell) executeCommandCmd(cmd *Command) int {
+	args := cmd.Args
+	describe := rune(0)
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		for _, c := range opt[1:] {
+			switch c {
+			case 'v', 'V':
+				describe = c
+			case 'p':
+			default:
+				fmt.Fprintf(cmd.Stderr, "command: -%c: invalid option\n", c)
+				fmt.Fprintln(cmd.Stderr, "command: usage: command [-pVv] command [arg ...]")
+				return 2
+			}
+		}
+	}
+	if len(args) == 0 {
+		return 0
+	}
+
+	switch describe {
+	case 'V':
+		return sh.executeTypeCmd(&Command{Args: args, Streams: cmd.Streams})
+
+	case 'v':
+		status := 0
+		for _, name := range args {
+			_, isFunc := sh.funcs[name]
+			_, isBuiltin := sh.builtin(name)
+			if value, ok := sh.aliases[name]; ok {
+				fmt.Fprintln(cmd.Stdout, aliasDefinition(name, value))
+			} else if isFunc || isBuiltin || isShellKeyword(name) {
+				fmt.Fprintln(cmd.Stdout, name)
+			} else if path, err := sh.getExecutablePath(name); err == nil {
+				fmt.Fprintln(cmd.Stdout, path)
+			} else {
+				status = 1
+			}
+		}
+		return status
+	}
+
+	// Functions are left out, for them to call the command they wrap
+	run := &Command{Exec: args[0], Args: args[1:], Redirects: cmd.Redirects, Streams: cmd.Streams}
+	if builtin, ok := sh.builtin(run.Exec); ok {
+		return builtin(sh, run)
+	}
+	return sh.runProgram(run)
+}
+
+func (sh *Shell) executeBuiltinCmd(cmd *Command) int {
+	if len(cmd.Args) == 0 {
+		return 0
+	}
+
+	builtin, ok := sh.builtin(cmd.Args[0])
+	if !ok {
+		fmt.Fprintf(cmd.Stderr, "builtin: %s: not a shell builtin\n", cmd.Args[0])
+		return 1
+	}
+	return builtin(sh, &Command{Exec: cmd.Args[0], Args: cmd.Args[1:], Redirects: cmd.Redirects, Streams: cmd.Streams})
+}
+
+func (sh *Shell) executeEvalCmd(cmd *Command) int {
+	list, err := sh.parse(strings.Join(cmd.Args, " "))
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "%v\n", err)
+		return 2
+	}
+	if len(list.Items) == 0 {
+		return 0
+	}
+	return sh.runList(list, cmd.Streams)
+}
+
+// executeSourceCmd runs the commands of a file in the shell. The arguments
+// following the file name are the positional parameters while it runs.
+func (sh *Shell) executeSourceCmd(cmd *Command) int {
+	if len(cmd.Args) == 0 {
+		fmt.Fprintf(cmd.Stderr, "%s: filename argument required\n", cmd.Exec)
+		fmt.Fprintf(cmd.Stderr, "%s: usage: %s filename [arguments]\n", cmd.Exec, cmd.Exec)
+		return 2
+	}
+
+	path := sh.findSourceFile(cmd.Args[0])
+	if info, err := os.Stat(sh.path(path)); err == nil && info.IsDir() {
+		fmt.Fprintf(cmd.Stderr, "%s: %s: is a directory\n", cmd.Exec, path)
+		return 1
+	}
+
+	// The caller's positional parameters come back after, unless the file
+	// set others
+	if len(cmd.Args) > 1 {
+		args := sh.args
+		sh.args = cmd.Args[1:]
+		defer func() {
+			if slices.Equal(sh.args, cmd.Args[1:]) {
+				sh.args = args
+			}
+		}()
+	}
+
+	status, err := sh.sourceFile(path)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(cmd.Stderr, "%s: No such file or directory\n", cmd.Args[0])
+	} else if err != nil {
+		fmt.Fprintf(cmd.Stderr, "%v\n", err)
+	}
+	return status
+}
+
+// findSourceFile returns the path of the file a source command names: one
+// in $PATH for a name without a slash, or else the name itself.
+func (sh *Shell) findSourceFile(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	path, _ := sh.getVar("PATH")
+	for dir := range strings.SplitSeq(path, string(os.PathListSeparator)) {
+		if info, err := os.Stat(sh.path(filepath.Join(dir, name))); err == nil && info.Mode().IsRegular() {
+			return filepath.Join(dir, name)
+		}
+	}
+	return name
+}
+
+// executeRepeatCmd runs a command a number of times, stopping at the first
+// run that fails. Its status is that of the last run.
+func (sh *Shell) executeRepeatCmd(cmd *Command) int {
+	if len(cmd.Args) < 2 {
+		fmt.Fprintln(cmd.Stderr, "repeat: usage: repeat count command [arg ...]")
+		return 2
+	}
+	count, err := strconv.Atoi(cmd.Args[0])
+	if err != nil || count < 0 {
+		fmt.Fprintf(cmd.Stderr, "repeat: %s: numeric argument required\n", cmd.Args[0])
+		return 1
+	}
+
+	// The command runs as it was given, its arguments expanded once
+	status := 0
+	for range count {
+		if sh.unwinding() || sh.interrupted() {
+			break
+		}
+		if status = sh.dispatch(&Command{Exec: cmd.Args[1], Args: cmd.Args[2:], Streams: cmd.Streams}); status != 0 {
+			break
+		}
+	}
+	return status
+}
+
+// executeTimesCmd prints the user and system CPU times used by the shell,
+// then by the children it waited for.
+func (sh *Shell) executeTimesCmd(cmd *Command) int {
+	for _, who := range []int{syscall.RUSAGE_SELF, syscall.RUSAGE_CHILDREN} {
+		var usage syscall.Rusage
+		if err := syscall.Getrusage(who, &usage); err != nil {
+			fmt.Fprintf(cmd.Stderr, "times: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(cmd.Stdout, "%s %s\n", formatCPUTime(usage.Utime), formatCPUTime(usage.Stime))
+	}
+	return 0
+}
+
+// formatCPUTime formats a CPU time as minutes and seconds, "1m2.345s".
+func formatCPUTime(t syscall.Timeval) string {
+	d := time.Duration(t.Nano())
+	minutes := int(d / time.Minute)
+	return fmt.Sprintf("%dm%.3fs", minutes, (d - time.Duration(minutes)*time.Minute).Seconds())
+}
+
+func (sh *Shell) executeExecCmd(cmd *Command) int {
+	// A subshell shares its process with the shell, so it runs the command
+	// and ends instead, and redirects only its own streams without one
+	if sh.subshell {
+		if len(cmd.Args) == 0 {
+			if err := sh.redirectShell(cmd.Streams); err != nil {
+				fmt.Fprintf(cmd.Stderr, "exec: %v\n", err)
+				return 1
+			}
+			return 0
+		}
+		sh.exit(sh.runProgram(&Command{Exec: cmd.Args[0], Args: cmd.Args[1:], Streams: cmd.Streams}))
+	}
+
+	// Without a command, the redirections apply to the shell from now on
+	if err := sh.redirectShell(cmd.Streams); err != nil {
+		fmt.Fprintf(cmd.Stderr, "exec: %v\n", err)
+		return 1
+	}
+	if len(cmd.Args) == 0 {
+		return 0
+	}
+
+	path, err := sh.getExecutablePath(cmd.Args[0])
+	status := lookupStatus(err)
+	if err == nil {
+		// The program starts out in the shell's working directory
+		if sh.dir != "" {
+			os.Chdir(sh.dir)
+		}
+		for fd, f := range cmd.Files {
+			syscall.Dup2(int(f.Fd()), fd)
+		}
+		err = syscall.Exec(path, cmd.Args, sh.environ())
+		err = fmt.Errorf("%s: %v", cmd.Args[0], err)
+		status = 126
+	}
+
+	// Only a failure gets here, which ends a non-interactive shell
+	fmt.Fprintf(cmd.Stderr, "exec: %v\n", err)
+	if !sh.interactive {
+		sh.exit(status)
+	}
+	return status
+}
+
+func (sh *Shell) executePwdCmd(cmd *Command) int {
+	curDir := sh.dir
+	if curDir == "" {
+		var err error
+		if curDir, err = os.Getwd(); err != nil {
+			fmt.Fprintf(cmd.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+
+	// Prefer the logical path cd took, as long as it's still the way here
+	if pwd, _ := sh.getVar("PWD"); filepath.IsAbs(pwd) && sameFile(pwd, curDir) {
+		curDir = pwd
+	}
+
+	fmt.Fprintln(cmd.Stdout, curDir)
+	return 0
+}
+
+// sameFile reports whether both paths name the same existing file.
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+func (sh *Shell) executeCdCmd(cmd *Command) int {
+	args := cmd.Args
+	physical := false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		for _, c := range opt[1:] {
+			switch c {
+			case 'L':
+				physical = false
+			case 'P':
+				physical = true
+			default:
+				fmt.Fprintf(cmd.Stderr, "cd: -%c: invalid option\n", c)
+				fmt.Fprintln(cmd.Stderr, "cd: usage: cd [-L|-P] [dir]")
+				return 2
+			}
+		}
+	}
+
+	home, _ := sh.getVar("HOME")
+	dir := home
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	// Handle tilde (home directory)
+	if dir == "~" {
+		dir = home
+	}
+
+	if err := sh.changeDir(dir, physical); err != nil {
+		fmt.Fprintf(cmd.Stderr, "cd: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// changeDir makes dir the working directory of the shell, updating $PWD and
+// $OLDPWD.
+func (sh *Shell) changeDir(dir string, physical bool) error {
+	path := dir
+	if !filepath.IsAbs(dir) {
+		pwd, _ := sh.getVar("PWD")
+		if !filepath.IsAbs(pwd) {
+			pwd = sh.dir
+		}
+		path = pwd + "/" + dir
+	}
+
+	// The logical path follows the one that led to the current directory,
+	// with ".." going back up it rather than to the physical parent
+	absPath, err := cleanLogical(path)
+	if err == nil && physical {
+		absPath, err = filepath.EvalSymlinks(path)
+	}
+	if err == nil {
+		err = checkDir(absPath)
+	}
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Errorf("%s: No such file or directory", dir)
+	case errors.Is(err, syscall.ENOTDIR):
+		return fmt.Errorf("%s: Not a directory", dir)
+	case errors.Is(err, syscall.EACCES):
+		return fmt.Errorf("%s: Permission denied", dir)
+	case err != nil:
+		return err
+	}
+
+	sh.dir = absPath
+	oldPwd, _ := sh.getVar("PWD")
+	sh.exportVar("OLDPWD", oldPwd)
+	sh.exportVar("PWD", absPath)
+	return nil
+}
+
+// checkDir returns the error chdir would fail with for path, nil if path is
+// a directory that can be made the working directory.
+func checkDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return syscall.ENOTDIR
+	}
+	return syscall.Access(path, 1)
+}
+
+// cleanLogical drops the "." elements of an absolute path, and the ".."
+// ones along with the element before, without resolving symlinks. The
+// directory a ".." leaves has to exist still.
+func cleanLogical(path string) (string, error) {
+	var elems []string
+	for _, elem := range strings.Split(path, "/") {
+		switch elem {
+		case "", ".":
+		case "..":
+			if len(elems) == 0 {
+				continue // the parent of the root is the root
+			}
+			info, err := os.Stat("/" + strings.Join(elems, "/"))
+			if err != nil {
+				return "", err
+			}
+			if !info.IsDir() {
+				return "", syscall.ENOTDIR
+			}
+			elems = elems[:len(elems)-1]
+		default:
+			elems = append(elems, elem)
+		}
+	}
+	return "/" + strings.Join(elems, "/"), nil
+}
+
+func (sh *Shell) executeShiftCmd(cmd *Command) int {
+	n := 1
+	if len(cmd.Args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(cmd.Args[0]); err != nil {
+			fmt.Fprintf(cmd.Stderr, "shift: %s: numeric argument required\n", cmd.Args[0])
+			return 1
+		}
+	}
+
+	// Shifting more parameters than there are leaves them alone
+	if n < 0 || n > len(sh.args) {
+		return 1
+	}
+	sh.args = sh.args[n:]
+	return 0
+}
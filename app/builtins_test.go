@@ -0,0 +1,159 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCdInSubshell(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"command substitution", "x=$(cd /usr; pwd); echo $x; [ \"$(pwd)\" = \"$HOME\" ] && echo same\n", "/usr\nsame\n"},
+		{"pipeline", "mkdir sub\ncd sub | true; [ \"$(pwd)\" = \"$HOME\" ] && echo same\n", "same\n"},
+		{"background", "mkdir sub\n{ cd sub; } & wait; [ \"$PWD\" = \"$HOME\" ] && echo same\n", "same\n"},
+		{"relative paths", "mkdir sub\ncd sub\necho hi > f; cat < f; cat f; echo *; [[ -e f ]] && echo exists\necho 'echo sourced' > s.sh; . ./s.sh\n", "hi\nhi\nf\nexists\nsourced\n"},
+	})
+}
+
+func TestShift(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"loop", "set -- a b c\nwhile [ $# -gt 0 ]; do echo $1; shift; done\n", "a\nb\nc\n"},
+		{"by two", "set -- a b c\nshift 2; echo $# $1\n", "1 c\n"},
+		{"too many", "set -- a b\nshift 3; echo $? $# $1\n", "1 2 a\n"},
+	})
+}
+
+func TestPwdVars(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"cd", "start=$PWD\ncd /tmp; echo $PWD; [ \"$OLDPWD\" = \"$start\" ] && echo old\n", "/tmp\nold\n"},
+		{"exported", "cd /tmp; sh -c 'echo $PWD $OLDPWD' | sed \"s|$HOME|HOME|\"\n", "/tmp HOME\n"},
+		{"failed cd", "cd /tmp; cd /nonexistent 2>/dev/null; echo $PWD\n", "/tmp\n"},
+	})
+}
+
+func TestBuiltinBuiltin(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"cd wrapper", "mkdir sub\ncd() { echo \"going to $1\"; builtin cd \"$1\"; }\ncd sub\necho ${PWD##*/}\n", "going to sub\nsub\n"},
+		{"skips functions", "echo() { printf 'function\\n'; }\nbuiltin echo builtin\n", "builtin\n"},
+		{"not a builtin", "builtin ls 2>/dev/null\necho $?\n", "1\n"},
+	})
+}
+
+func TestEval(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"unquoted argument", "x='echo hi'\neval $x\n", "hi\n"},
+		{"in the shell", "eval 'y=1; echo $y'\necho $y\n", "1\n1\n"},
+		{"status", "eval false\necho $?\neval 'f() { return 3; }'\nf\necho $?\n", "1\n3\n"},
+		{"joined arguments", "eval echo a '\"b   c\"'\n", "a b   c\n"},
+		{"nothing", "false\neval\necho $?\n", "0\n"},
+		{"expanded once more", "v='$UNSET'\neval \"echo \\$v\"\n", "$UNSET\n"},
+		{"compound command", "eval 'if true; then echo in; fi'\n", "in\n"},
+	})
+}
+
+func TestExec(t *testing.T) {
+	out, errOut, status := runScript(t, "exec nosuchcmd\necho not reached\n", "")
+	if out != "" || errOut != "exec: nosuchcmd: not found\n" || status != 127 {
+		t.Errorf("bad command: got %q, %q and status %d", out, errOut, status)
+	}
+
+	runScriptTests(t, []scriptTest{
+		{"replaces the shell", "exec sh -c 'echo replaced'\necho not reached\n", "replaced\n"},
+		{"redirections only", "exec 3>out.txt\necho to fd 3 >&3\nexec 3>&-\ncat out.txt\n", "to fd 3\n"},
+		{"redirected stdout", "exec 4>&1 >out.txt\necho to file\nexec >&4\necho back\ncat out.txt\n", "back\nto file\n"},
+	})
+}
+
+func TestExecInSubshell(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"pipeline stage", "{ exec >out.txt; echo x; } | cat\necho after\ncat out.txt\n", "after\nx\n"},
+		{"stderr into the pipe", "{ exec 2>&1; echo err >&2; } | tr a-z A-Z\n", "ERR\n"},
+		{"stdin", "printf 'one\\ntwo\\n' >in.txt\n{ exec <in.txt; head -n 1; } | cat\n", "one\n"},
+		{"fd 3", "printf 'one\\ntwo\\n' >in.txt\n{ exec 3<in.txt; cat <&3; } | wc -l\n", "2\n"},
+		{"subshell", "(exec >out.txt; echo y)\necho main\ncat out.txt\n", "main\ny\n"},
+		{"shell's fd left open", "exec 3>top.txt\n(exec 3>sub.txt; echo s >&3)\necho t >&3\ncat top.txt sub.txt\n", "t\ns\n"},
+		{"substitution", "v=$(exec 2>&1; echo e >&2)\necho \"[$v]\"\n", "[e]\n"},
+	})
+}
+
+func TestCdPhysical(t *testing.T) {
+	links := "mkdir real\nln -s real link\n"
+	runScriptTests(t, []scriptTest{
+		{"logical by default", links + "cd link\necho ${PWD##*/}\n", "link\n"},
+		{"-L", links + "cd -L link\necho ${PWD##*/}\ncd -L ..\nls -d l* ${OLDPWD##*/}\n", "link\nlink\nlink\n"},
+		{"-P", links + "cd -P link\necho ${PWD##*/}\n", "real\n"},
+		{"last flag wins", links + "cd -P -L link\necho ${PWD##*/}\ncd -L -P ../link\necho ${PWD##*/}\n", "link\nreal\n"},
+	})
+}
+
+func TestCdLogical(t *testing.T) {
+	dirs := "mkdir -p a/b a/c real/sub\nln -s real link\nshow() { echo \"${PWD#$HOME}\"; }\n"
+	runScriptTests(t, []scriptTest{
+		{"trailing slash", dirs + "cd a/\nshow\n", "/a\n"},
+		{"dot segments", dirs + "cd ./a/b/../c\nshow\n", "/a/c\n"},
+		{"absolute", dirs + "cd $HOME/a/./b/../c/\nshow\n", "/a/c\n"},
+		{"doubled slashes", dirs + "cd a//b\nshow\n", "/a/b\n"},
+		{"through a link", dirs + "cd link/sub/..\nshow\ncd ..\nshow\n", "/link\n\n"},
+		{"physically through a link", dirs + "cd -P link/sub/..\nshow\n", "/real\n"},
+		{"up from the root", "cd /\ncd ..\necho $PWD\ncd /tmp/../\necho $PWD\n", "/\n/\n"},
+		{"missing directory", dirs + "cd missing/.. 2>/dev/null; echo $?\nshow\n", "1\n\n"},
+	})
+}
+
+func TestXpgEcho(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"off", "echo 'a\\tb'\necho -e 'a\\tb'\n", "a\\tb\na\tb\n"},
+		{"on", "shopt -s xpg_echo\necho 'a\\tb' 'c\\nd'\n", "a\tb c\nd\n"},
+		{"-E", "shopt -s xpg_echo\necho -E 'a\\tb'\n", "a\\tb\n"},
+		{"off again", "shopt -s xpg_echo\nshopt -u xpg_echo\necho 'a\\tb'\n", "a\\tb\n"},
+		{"state", "shopt xpg_echo\nshopt -s xpg_echo\nshopt xpg_echo\n", "xpg_echo       \toff\nxpg_echo       \ton\n"},
+	})
+}
+
+func TestRepeat(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"repeated", "repeat 3 echo hi\n", "hi\nhi\nhi\n"},
+		{"arguments expanded once", "x='a  $y'\nrepeat 2 echo \"$x\"\n", "a  $y\na  $y\n"},
+		{"zero times", "repeat 0 echo no\necho $?\n", "0\n"},
+		{"early abort", "n=0\nf() { n=$((n + 1)); echo run $n; [ $n -lt 2 ]; }\nrepeat 5 f\necho status $? runs $n\n", "run 1\nrun 2\nstatus 1 runs 2\n"},
+		{"last status", "repeat 2 true; echo $?\nrepeat 2 sh -c 'exit 3'; echo $?\n", "0\n3\n"},
+		{"bad counts", "repeat x echo; echo $?\nrepeat -1 echo; echo $?\nrepeat 1; echo $?\n", "1\n1\n2\n"},
+	})
+}
+
+func TestTypeKeywords(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"type", "type if [[ !\n", "if is a shell keyword\n[[ is a shell keyword\n! is a shell keyword\n"},
+		{"command -V", "command -V while\n", "while is a shell keyword\n"},
+		{"command -v", "command -v done\n", "done\n"},
+		{"quoted", "type 'then'\n", "then is a shell keyword\n"},
+	})
+}
+
+func TestSourceArgs(t *testing.T) {
+	lib := "printf 'echo \"in $# $1 $2\"\\n' >lib.sh\nset -- outer x\n"
+	runScriptTests(t, []scriptTest{
+		{"arguments", lib + "source ./lib.sh a b\necho \"after $# $1 $2\"\n", "in 2 a b\nafter 2 outer x\n"},
+		{"dot", lib + ". ./lib.sh c\necho \"after $# $1\"\n", "in 1 c \nafter 2 outer\n"},
+		{"without arguments", lib + ". ./lib.sh\n", "in 2 outer x\n"},
+		{"in a function", lib + "f() { . ./lib.sh inner; echo \"f $1\"; }\nf fa\n", "in 1 inner \nf fa\n"},
+		{"returning", lib + "printf 'return 3\\n' >r.sh\n. ./r.sh q\necho \"$? $1\"\n", "3 outer\n"},
+	})
+}
+
+func TestTimes(t *testing.T) {
+	script := "sh -c 'i=0; while [ $i -lt 20000 ]; do i=$((i + 1)); done'\ntimes\necho $?\n"
+	out, _, _ := runScript(t, script, "")
+	if !regexp.MustCompile(`^(\d+m\d+\.\d{3}s \d+m\d+\.\d{3}s\n){2}0\n$`).MatchString(out) {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestEnable(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"listed", "enable | grep -x 'enable cd'\nenable -n | wc -l\n", "enable cd\n0\n"},
+		{"disabled", "enable -n echo\ntype echo | grep -c 'is /'\ncommand -v echo | grep -c ^/\nenable -n\nenable echo\ntype echo\nenable -n | wc -l\n", "1\n1\nenable -n echo\necho is a shell builtin\n0\n"},
+		{"no external", "enable -n type\ntype echo 2>/dev/null || echo \"status $?\"\nenable type\ntype type\n", "status 127\ntype is a shell builtin\n"},
+		{"all", "enable -n pwd\nenable -a | grep -x 'enable -n pwd'\nenable | grep -c -x 'enable pwd'\n", "enable -n pwd\n0\n"},
+		{"not a builtin", "enable nosuch 2>/dev/null; echo $?\nenable -n nosuch 2>/dev/null; echo $?\n", "1\n1\n"},
+	})
+}
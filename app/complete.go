@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// completeWords returns the completions of the word the line ends with, for
+// the line editor, along with the index in line where the word starts. The
+// command name completes to builtins, functions and programs, and the
+// arguments to the word list registered for the command with complete, or
+// to file names.
+func (sh *Shell) completeWords(line string) (int, []string) {
+	start := strings.LastIndexAny(line, " \t|;&()<>") + 1
+	word := line[start:]
+
+	// The name of the command comes first, or right after an operator
+	before := strings.TrimRight(line[:start], " \t")
+	if before == "" || strings.ContainsAny(before[len(before)-1:], "|;&(") {
+		if strings.Contains(word, "/") {
+			return start, sh.completeFiles(word)
+		}
+		return start, sh.completeCommands(word)
+	}
+
+	segment := before[strings.LastIndexAny(before, "|;&(")+1:]
+	if fields := strings.Fields(segment); len(fields) > 0 {
+		if wordlist, ok := sh.completions[fields[0]]; ok {
+			return start, sh.completeWordlist(wordlist, word)
+		}
+	}
+	return start, sh.completeFiles(word)
+}
+
+// completeCommands returns the names of the builtins, functions and programs
+// in $PATH starting with prefix.
+func (sh *Shell) completeCommands(prefix string) []string {
+	var names []string
+	add := func(name string) {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	for name := range builtins {
+		if !sh.disabled[name] {
+			add(name)
+		}
+	}
+	for name := range sh.funcs {
+		add(name)
+	}
+
+	path, _ := sh.getVar("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		entries, _ := os.ReadDir(sh.path(dir))
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil && !info.IsDir() && info.Mode().Perm()&0100 != 0 {
+				add(entry.Name())
+			}
+		}
+	}
+
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// completeFiles returns the paths starting with prefix. Those of directories
+// end with a slash.
+func (sh *Shell) completeFiles(prefix string) []string {
+	dir, base := filepath.Split(prefix)
+	root := dir
+	if root == "" {
+		root = "."
+	}
+	entries, _ := os.ReadDir(sh.path(root))
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if info, err := os.Stat(sh.path(filepath.Join(root, name))); err == nil && info.IsDir() {
+			name += "/"
+		}
+		paths = append(paths, dir+name)
+	}
+	return paths
+}
+
+// completeWordlist returns the words of a word list from "complete -W"
+// starting with prefix. The list is expanded anew every time.
+func (sh *Shell) completeWordlist(wordlist, prefix string) []string {
+	expanded, err := sh.expandWord(wordlist)
+	if err != nil {
+		return nil
+	}
+	var words []string
+	for _, word := range strings.Fields(expanded) {
+		if strings.HasPrefix(word, prefix) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func (sh *Shell) executeCompleteCmd(cmd *Command) int {
+	args := cmd.Args
+	var wordlist string
+	hasWordlist, remove, print := false, false, false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		switch opt {
+		case "-W":
+			if len(args) == 0 {
+				fmt.Fprintln(cmd.Stderr, "complete: -W: option requires an argument")
+				return 2
+			}
+			wordlist, hasWordlist, args = args[0], true, args[1:]
+		case "-r":
+			remove = true
+		case "-p":
+			print = true
+		default:
+			fmt.Fprintf(cmd.Stderr, "complete: %s: invalid option\n", opt)
+			fmt.Fprintln(cmd.Stderr, "complete: usage: complete [-pr] [-W wordlist] [name ...]")
+			return 2
+		}
+	}
+
+	switch {
+	case remove:
+		if len(args) == 0 {
+			clear(sh.completions)
+		}
+		status := 0
+		for _, name := range args {
+			if _, ok := sh.completions[name]; !ok {
+				fmt.Fprintf(cmd.Stderr, "complete: %s: no completion specification\n", name)
+				status = 1
+			}
+			delete(sh.completions, name)
+		}
+		return status
+
+	case print || !hasWordlist:
+		names := args
+		if len(names) == 0 {
+			for name := range sh.completions {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+		}
+		status := 0
+		for _, name := range names {
+			wordlist, ok := sh.completions[name]
+			if !ok {
+				fmt.Fprintf(cmd.Stderr, "complete: %s: no completion specification\n", name)
+				status = 1
+				continue
+			}
+			fmt.Fprintf(cmd.Stdout, "complete -W %s %s\n", quoteString(wordlist), name)
+		}
+		return status
+	}
+
+	for _, name := range args {
+		sh.completions[name] = wordlist
+	}
+	return 0
+}
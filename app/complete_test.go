@@ -0,0 +1,53 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompleteWordlist(t *testing.T) {
+	sh := newShell(false, "gosh", nil)
+	sh.dir = t.TempDir()
+	sh.setVar("MODES", "fast slow")
+	var errOut strings.Builder
+	for _, args := range [][]string{{"-W", "start stop restart status", "svc"}, {"-W", "$MODES", "run", "walk"}} {
+		if status := sh.executeCompleteCmd(&Command{Args: args, Streams: Streams{Stderr: &errOut}}); status != 0 {
+			t.Fatalf("complete %q: status %d: %s", args, status, errOut.String())
+		}
+	}
+
+	tests := []struct {
+		line  string
+		start int
+		want  []string
+	}{
+		{"svc st", 4, []string{"start", "stop", "status"}},
+		{"svc re", 4, []string{"restart"}},
+		{"svc ", 4, []string{"start", "stop", "restart", "status"}},
+		{"svc x", 4, nil},
+		{"svc start sto", 10, []string{"stop"}},
+		{"echo a; svc sta", 12, []string{"start", "status"}},
+		{"run f", 4, []string{"fast"}},
+		{"walk ", 5, []string{"fast", "slow"}},
+		{"other st", 6, nil},
+	}
+	for _, tt := range tests {
+		start, got := sh.completeWords(tt.line)
+		if start != tt.start || !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %d, %q, want %d, %q", tt.line, start, got, tt.start, tt.want)
+		}
+	}
+
+	// Removed, the command's arguments complete to files again
+	sh.executeCompleteCmd(&Command{Args: []string{"-r", "svc"}, Streams: Streams{Stderr: &errOut}})
+	if _, got := sh.completeWords("svc st"); got != nil {
+		t.Errorf("after complete -r, got %q", got)
+	}
+
+	var out strings.Builder
+	sh.executeCompleteCmd(&Command{Args: []string{"-p"}, Streams: Streams{Stdout: &out}})
+	if want := "complete -W '$MODES' run\ncomplete -W '$MODES' walk\n"; out.String() != want {
+		t.Errorf("complete -p printed %q, want %q", out.String(), want)
+	}
+}
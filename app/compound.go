@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// runIf runs the body of the first branch whose condition succeeds. Its
+// status is that of the body, or 0 when no branch is taken.
+func (sh *Shell) runIf(node *If, s Streams) int {
+	for i, cond := range node.Conds {
+		if sh.runCondition(true, func() int { return sh.runList(cond, s) }) == 0 {
+			return sh.runList(node.Bodies[i], s)
+		}
+	}
+
+	if node.Else != nil {
+		return sh.runList(node.Else, s)
+	}
+	return 0
+}
+
+// runLoop runs the body of a while loop for as long as its condition
+// succeeds, or of an until loop for as long as it fails. Its status is that
+// of the last run of the body, or 0 when it never runs.
+func (sh *Shell) runLoop(cond, body *List, while bool, s Streams) int {
+	sh.loops++
+	defer func() { sh.loops-- }()
+
+	status := 0
+	for !sh.interrupted() {
+		ok := sh.runCondition(true, func() int { return sh.runList(cond, s) }) == 0
+		if sh.endIteration() {
+			break
+		}
+		if ok != while {
+			break
+		}
+
+		status = sh.runList(body, s)
+		if sh.endIteration() {
+			break
+		}
+	}
+	return status
+}
+
+// runFor runs the body of the loop for each of the fields its words expand
+// to. Its status is that of the last run of the body, or 0 when it never
+// runs.
+func (sh *Shell) runFor(node *For, s Streams) int {
+	// Without a word list, the loop goes over the positional parameters
+	fields := sh.args
+	if node.Words != nil {
+		var err error
+		if fields, err = sh.expandWords(node.Words); err != nil {
+			fmt.Fprintf(s.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+
+	sh.loops++
+	defer func() { sh.loops-- }()
+
+	status := 0
+	for _, field := range fields {
+		if sh.interrupted() {
+			break
+		}
+		if err := sh.assignVar(node.Var, field); err != nil {
+			fmt.Fprintf(s.Stderr, "%v\n", err)
+			return 1
+		}
+		status = sh.runList(node.Body, s)
+		if sh.endIteration() {
+			break
+		}
+	}
+	return status
+}
+
+// runArithFor runs a C-style for loop. Its status is that of the last run of
+// the body, 0 when it never runs, or 1 when an expression fails.
+func (sh *Shell) runArithFor(node *ArithFor, s Streams) int {
+	eval := func(raw string) (int64, bool) {
+		expr, err := sh.expandWord(raw)
+		if err != nil {
+			fmt.Fprintf(s.Stderr, "%v\n", err)
+			return 0, false
+		}
+		n, err := sh.evalArith(expr)
+		if err != nil {
+			fmt.Fprintf(s.Stderr, "((: %v\n", err)
+			return 0, false
+		}
+		return n, true
+	}
+
+	if _, ok := eval(node.Init); !ok {
+		return 1
+	}
+
+	sh.loops++
+	defer func() { sh.loops-- }()
+
+	status := 0
+	for !sh.interrupted() {
+		// An empty condition evaluates to 0, yet means to loop forever
+		if strings.TrimSpace(node.Cond) != "" {
+			n, ok := eval(node.Cond)
+			if !ok {
+				return 1
+			}
+			if n == 0 {
+				break
+			}
+		}
+
+		status = sh.runList(node.Body, s)
+		if sh.endIteration() {
+			break
+		}
+		if _, ok := eval(node.Update); !ok {
+			return 1
+		}
+	}
+	return status
+}
+
+// runSelect shows a numbered menu of the fields its words expand to, then
+// reads choices from the input, prompting with $PS3. For every line read,
+// it sets $REPLY to the line and the variable to the field chosen, or to ""
+// for an invalid choice, then runs the body. An empty line shows the menu
+// again. Its status is that of the last run of the body, or 1 when the
+// input ends.
+func (sh *Shell) runSelect(node *Select, s Streams) int {
+	fields := sh.args
+	if node.Words != nil {
+		var err error
+		if fields, err = sh.expandWords(node.Words); err != nil {
+			fmt.Fprintf(s.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+	if len(fields) == 0 {
+		return 0
+	}
+
+	sh.loops++
+	defer func() { sh.loops-- }()
+
+	status, menu := 0, true
+	width := len(strconv.Itoa(len(fields)))
+	for !sh.interrupted() {
+		if menu {
+			for i, field := range fields {
+				fmt.Fprintf(s.Stderr, "%*d) %s\n", width, i+1, field)
+			}
+			menu = false
+		}
+		ps3, ok := sh.getVar("PS3")
+		if !ok {
+			ps3 = "#? "
+		}
+		fmt.Fprint(s.Stderr, ps3)
+
+		line, err := readLine(s.Stdin)
+		if line == "" && err != nil {
+			fmt.Fprintln(s.Stderr)
+			return 1
+		}
+		reply := strings.Trim(line, " \t\n")
+		sh.setVar("REPLY", reply)
+		if reply == "" {
+			menu = true
+			continue
+		}
+
+		choice := ""
+		if n, err := strconv.Atoi(reply); err == nil && n >= 1 && n <= len(fields) {
+			choice = fields[n-1]
+		}
+		if err := sh.assignVar(node.Var, choice); err != nil {
+			fmt.Fprintf(s.Stderr, "%v\n", err)
+			return 1
+		}
+		status = sh.runList(node.Body, s)
+		if sh.endIteration() {
+			break
+		}
+	}
+	return status
+}
+
+// endIteration takes care of a break or continue at the end of an iteration
+// of a loop, reporting whether the loop stops.
+func (sh *Shell) endIteration() bool {
+	if sh.returning {
+		return true
+	}
+	if sh.breaking > 0 {
+		sh.breaking--
+		return true
+	}
+	if sh.continuing > 0 {
+		sh.continuing--
+		return sh.continuing > 0
+	}
+	return false
+}
+
+func (sh *Shell) executeBreakCmd(cmd *Command) int {
+	n, status := sh.loopCount(cmd)
+	sh.breaking = n
+	return status
+}
+
+func (sh *Shell) executeContinueCmd(cmd *Command) int {
+	n, status := sh.loopCount(cmd)
+	sh.continuing = n
+	return status
+}
+
+// loopCount returns the number of enclosing loops a break or continue applies
+// to, along with its exit status.
+func (sh *Shell) loopCount(cmd *Command) (int, int) {
+	if sh.loops == 0 {
+		fmt.Fprintf(cmd.Stderr, "%s: only meaningful in a `for', `while', or `until' loop\n", cmd.Exec)
+		return 0, 0
+	}
+	if len(cmd.Args) == 0 {
+		return 1, 0
+	}
+
+	n, err := strconv.Atoi(cmd.Args[0])
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "%s: %s: numeric argument required\n", cmd.Exec, cmd.Args[0])
+		return 1, 128
+	}
+	if n < 1 {
+		fmt.Fprintf(cmd.Stderr, "%s: %s: loop count out of range\n", cmd.Exec, cmd.Args[0])
+		return 1, 1
+	}
+	return min(n, sh.loops), 0
+}
+
+// runCase runs the body of the first item with a pattern matching the word.
+// Its status is that of the body, or 0 when no pattern matches.
+func (sh *Shell) runCase(node *Case, s Streams) int {
+	word, err := sh.expandWord(node.Word)
+	if err != nil {
+		fmt.Fprintf(s.Stderr, "%v\n", err)
+		return 1
+	}
+
+	for _, item := range node.Items {
+		for _, raw := range item.Patterns {
+			frags, err := sh.expandFragments(raw)
+			if err != nil {
+				fmt.Fprintf(s.Stderr, "%v\n", err)
+				return 1
+			}
+
+			if pattern, _ := globPattern(frags); matchPattern(pattern, word) {
+				return sh.runList(item.Body, s)
+			}
+		}
+	}
+	return 0
+}
+
+// runRedirected runs a compound command with its redirections applied to
+// the streams of everything within it.
+func (sh *Shell) runRedirected(node *Redirected, s Streams) int {
+	cmd := &Command{Streams: s}
+	for _, r := range node.Redirects {
+		target, err := sh.expandWord(r.Target)
+		if err != nil {
+			fmt.Fprintf(s.Stderr, "%v\n", err)
+			return 1
+		}
+		r.Target = target
+		cmd.Redirects = append(cmd.Redirects, r)
+	}
+	defer sh.addProcessFiles(&cmd.Streams)()
+
+	closeFiles, err := sh.applyRedirects(cmd)
+	if err != nil {
+		fmt.Fprintf(s.Stderr, "%v\n", err)
+		return 1
+	}
+	defer closeFiles()
+
+	return sh.runCommand(node.Cmd, cmd.Streams)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIf(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"true", "if true; then echo yes; else echo no; fi\n", "yes\n"},
+		{"false", "if false; then echo yes; else echo no; fi\n", "no\n"},
+		{"no else", "if false; then echo yes; fi; echo $?\n", "0\n"},
+		{"elif", "x=2\nif [ $x = 1 ]; then echo one\nelif [ $x = 2 ]; then echo two\nelse echo other\nfi\n", "two\n"},
+		{"condition status", "if sh -c 'exit 3'; then echo yes; else echo $?; fi\n", "3\n"},
+		{"nested", "if true; then if false; then echo a; else echo b; fi; fi\n", "b\n"},
+	})
+}
+
+// scriptedInput returns a lineReader giving out lines one at a time, and the
+// prompts it was called with.
+func scriptedInput(lines ...string) (lineReader, *[]string) {
+	var prompts []string
+	return func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		if len(lines) == 0 {
+			return "", io.EOF
+		}
+		line := lines[0]
+		lines = lines[1:]
+		return line, nil
+	}, &prompts
+}
+
+func TestIfContinuation(t *testing.T) {
+	sh := newShell(false, "gosh", nil)
+	sh.setVar("PS1", "$ ")
+	sh.setVar("PS2", "> ")
+	readLine, prompts := scriptedInput("if true", "then echo yes", "fi")
+	command, err := readCommand(readLine, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "if true\nthen echo yes\nfi"; command != want {
+		t.Errorf("got command %q, want %q", command, want)
+	}
+	if want := []string{"$ ", "> ", "> "}; !slices.Equal(*prompts, want) {
+		t.Errorf("got prompts %q, want %q", *prompts, want)
+	}
+}
+
+func TestSubshell(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"variables stay inside", "x=1\n(x=2; y=3; echo in $x)\necho out $x $y.\n", "in 2\nout 1 .\n"},
+		{"exit stays inside", "(echo a; exit 4; echo b)\necho after $?\n", "a\nafter 4\n"},
+		{"directory stays inside", "mkdir d\n(cd d; echo ${PWD##*/})\necho ${PWD##*/} | grep -vc ^d$\n", "d\n1\n"},
+		{"in a pipeline", "(echo a; echo b) | tr a-z A-Z\n", "A\nB\n"},
+		{"redirected", "(echo one; echo two >&2) >out.txt 2>&1\ncat out.txt\n", "one\ntwo\n"},
+		{"nested", "( (exit 5) )\necho $?\n", "5\n"},
+		{"function body", "f() ( x=$1; echo f $x )\nx=0\nf 7\necho $x\n", "f 7\n0\n"},
+		{"own exit trap", "(trap 'echo sub exit' EXIT; echo body)\necho after\n", "body\nsub exit\nafter\n"},
+		{"across lines", "(\n  echo multi\n  false\n)\necho $?\n", "multi\n1\n"},
+		{"not arithmetic", "( (echo inner) )\n(( 2 > 1 )) && echo arith\n", "inner\narith\n"},
+	})
+}
+
+func TestUntil(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"becomes true", "i=0\nuntil [ $i -ge 3 ]; do echo $i; i=$((i+1)); done\n", "0\n1\n2\n"},
+		{"true at once", "until true; do echo never; done; echo $?\n", "0\n"},
+		{"break", "i=0\nuntil false; do i=$((i+1)); [ $i = 2 ] && break; done; echo $i\n", "2\n"},
+		{"continue", "i=0\nuntil [ $i = 3 ]; do i=$((i+1)); [ $i = 2 ] && continue; echo $i; done\n", "1\n3\n"},
+	})
+}
+
+func TestBreakContinue(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"break 2", "for i in 1 2 3; do for j in a b c; do [ $j = b ] && break 2; echo $i$j; done; done; echo end\n", "1a\nend\n"},
+		{"break", "for i in 1 2; do for j in a b c; do [ $j = b ] && break; echo $i$j; done; done\n", "1a\n2a\n"},
+		{"continue 2", "for i in 1 2; do for j in a b; do [ $j = b ] && continue 2; echo $i$j; done; echo never; done\n", "1a\n2a\n"},
+		{"outside a loop", "break 2>&1; echo $?\n", "break: only meaningful in a `for', `while', or `until' loop\n0\n"},
+	})
+}
+
+func TestArithFor(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"counting", "for (( i=0; i<3; i++ )); do echo $i; done\n", "0\n1\n2\n"},
+		{"on several lines", "for ((i = 3; i > 0; i--))\ndo\n  echo $i\ndone\n", "3\n2\n1\n"},
+		{"break", "for ((i = 0; i < 10; i++)); do (( i == 2 )) && break; echo $i; done\necho after $i\n", "0\n1\nafter 2\n"},
+		{"continue", "for ((i = 0; i < 5; i++)); do (( i % 2 )) && continue; echo $i; done\n", "0\n2\n4\n"},
+		{"empty condition", "for ((i = 0; ; i++)); do (( i == 3 )) && break; done\necho $i\n", "3\n"},
+		{"empty header", "for (( ; ; )); do echo once; break; done\n", "once\n"},
+		{"nested continue", "for ((i = 0; i < 2; i++)); do for ((j = 0; j < 2; j++)); do (( j == 1 )) && continue 2; echo $i$j; done; done\n", "00\n10\n"},
+		{"not run", "false\nfor ((i = 0; i < 0; i++)); do echo no; done\necho $?\n", "0\n"},
+	})
+}
+
+func TestSelect(t *testing.T) {
+	menu := "1) apple\n2) banana split\n3) cherry\n"
+	script := "PS3='pick: '\nselect f in apple 'banana split' cherry; do echo \"[$f] [$REPLY]\"; [ \"$REPLY\" = 3 ] && break; done\necho after $?\n"
+	tests := []struct {
+		name       string
+		stdin      string
+		out, menus string
+	}{
+		{"choice", "2\n3\n", "[banana split] [2]\n[cherry] [3]\nafter 0\n", menu + "pick: pick: "},
+		{"invalid choices", "9\nx\n3\n", "[] [9]\n[] [x]\n[cherry] [3]\nafter 0\n", menu + "pick: pick: pick: "},
+		{"empty line", "\n3\n", "[cherry] [3]\nafter 0\n", menu + "pick: " + menu + "pick: "},
+		{"end of input", "1\n", "[apple] [1]\nafter 1\n", menu + "pick: pick: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, menus, _ := runScript(t, script, tt.stdin)
+			if out != tt.out || !strings.HasPrefix(menus, tt.menus) {
+				t.Errorf("got %q with menus %q, want %q with %q", out, menus, tt.out, tt.menus)
+			}
+		})
+	}
+
+	runScriptTests(t, []scriptTest{
+		{"positional parameters", "set -- a b\necho 2 | { select x; do echo $x; break; done; } 2>/dev/null\n", "b\n"},
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// runCond evaluates a conditional command. Its status is 0 when the
+// expression is true, 1 when it's false, and 2 on an error.
+func (sh *Shell) runCond(node *Cond, s Streams) int {
+	ok, err := sh.evalCond(node.Expr)
+	if err != nil {
+		fmt.Fprintf(s.Stderr, "%v\n", err)
+		return 2
+	}
+	return btoi(!ok)
+}
+
+// evalCond evaluates a conditional expression. Its words are expanded
+// without field splitting or pathname expansion, and the right side of "=="
+// and "!=" is a pattern, of "=~" a regular expression.
+func (sh *Shell) evalCond(e *CondExpr) (bool, error) {
+	switch e.Op {
+	case "!":
+		ok, err := sh.evalCond(e.Left)
+		return !ok, err
+	case "&&", "||":
+		ok, err := sh.evalCond(e.Left)
+		if err != nil || ok == (e.Op == "||") {
+			return ok, err
+		}
+		return sh.evalCond(e.Right)
+	}
+
+	left, err := sh.expandWord(e.Words[0])
+	if err != nil {
+		return false, err
+	}
+	if len(e.Words) == 1 {
+		if e.Op == "" {
+			return left != "", nil
+		}
+		return sh.testUnary(e.Op, left), nil
+	}
+
+	switch e.Op {
+	case "==", "=", "!=":
+		frags, err := sh.expandFragments(e.Words[1])
+		if err != nil {
+			return false, err
+		}
+		pattern, _ := globPattern(frags)
+		return matchPattern(pattern, left) == (e.Op != "!="), nil
+	case "=~":
+		return sh.matchRegex(left, e.Words[1])
+	}
+
+	right, err := sh.expandWord(e.Words[1])
+	if err != nil {
+		return false, err
+	}
+	return sh.testBinary(e.Op, left, right)
+}
+
+// testUnary applies a unary test operator to its operand.
+func (sh *Shell) testUnary(op, arg string) bool {
+	switch op {
+	case "-z":
+		return arg == ""
+	case "-n":
+		return arg != ""
+	case "-v":
+		_, ok := sh.getVar(arg)
+		return ok
+	case "-o":
+		opt := findOption(setOptions, arg)
+		return opt != nil && *opt.get(&sh.opts)
+	case "-t":
+		var t syscall.Termios
+		fd, err := strconv.Atoi(arg)
+		return err == nil && ioctlTermios(fd, syscall.TCGETS, &t) == nil
+	case "-r":
+		return syscall.Access(sh.path(arg), 4) == nil
+	case "-w":
+		return syscall.Access(sh.path(arg), 2) == nil
+	case "-x":
+		return syscall.Access(sh.path(arg), 1) == nil
+	}
+
+	// The other tests are on the type and mode of a file
+	stat := os.Stat
+	if op == "-h" || op == "-L" {
+		stat = os.Lstat
+	}
+	info, err := stat(sh.path(arg))
+	if err != nil {
+		return false
+	}
+	mode := info.Mode()
+	sys, _ := info.Sys().(*syscall.Stat_t)
+
+	switch op {
+	case "-a", "-e":
+		return true
+	case "-f":
+		return mode.IsRegular()
+	case "-d":
+		return mode.IsDir()
+	case "-b":
+		return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0
+	case "-c":
+		return mode&os.ModeCharDevice != 0
+	case "-p":
+		return mode&os.ModeNamedPipe != 0
+	case "-S":
+		return mode&os.ModeSocket != 0
+	case "-h", "-L":
+		return mode&os.ModeSymlink != 0
+	case "-s":
+		return info.Size() > 0
+	case "-g":
+		return mode&os.ModeSetgid != 0
+	case "-u":
+		return mode&os.ModeSetuid != 0
+	case "-k":
+		return mode&os.ModeSticky != 0
+	case "-O":
+		return sys != nil && int(sys.Uid) == os.Geteuid()
+	case "-G":
+		return sys != nil && int(sys.Gid) == os.Getegid()
+	case "-N":
+		// Modified since it was last read
+		return sys != nil && (sys.Mtim.Sec > sys.Atim.Sec ||
+			(sys.Mtim.Sec == sys.Atim.Sec && sys.Mtim.Nsec > sys.Atim.Nsec))
+	}
+	return false
+}
+
+// testBinary applies a binary test operator, other than the matching ones,
+// to its operands. Those of the numeric comparisons are arithmetic
+// expressions.
+func (sh *Shell) testBinary(op, left, right string) (bool, error) {
+	switch op {
+	case "<":
+		return left < right, nil
+	case ">":
+		return left > right, nil
+	case "-nt", "-ot":
+		// A file that exists is newer than one that doesn't
+		if op == "-ot" {
+			left, right = right, left
+		}
+		l, lerr := os.Stat(sh.path(left))
+		r, rerr := os.Stat(sh.path(right))
+		return lerr == nil && (rerr != nil || l.ModTime().After(r.ModTime())), nil
+	case "-ef":
+		l, lerr := os.Stat(sh.path(left))
+		r, rerr := os.Stat(sh.path(right))
+		return lerr == nil && rerr == nil && os.SameFile(l, r), nil
+	}
+
+	x, err := sh.evalArith(left)
+	if err != nil {
+		return false, err
+	}
+	y, err := sh.evalArith(right)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "-eq":
+		return x == y, nil
+	case "-ne":
+		return x != y, nil
+	case "-lt":
+		return x < y, nil
+	case "-le":
+		return x <= y, nil
+	case "-gt":
+		return x > y, nil
+	}
+	return x >= y, nil
+}
+
+// matchRegex matches a string against the extended regular expression right
+// of "=~", whose quoted parts match literally. BASH_REMATCH is set to the
+// matched text followed by that of the subexpressions, or emptied without a
+// match.
+func (sh *Shell) matchRegex(s, raw string) (bool, error) {
+	frags, err := sh.expandFragments(raw)
+	if err != nil {
+		return false, err
+	}
+	var expr strings.Builder
+	for _, frag := range frags {
+		if frag.quoted {
+			expr.WriteString(regexp.QuoteMeta(frag.text))
+		} else {
+			expr.WriteString(frag.text)
+		}
+	}
+
+	re, err := regexp.CompilePOSIX(expr.String())
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid regular expression", expr.String())
+	}
+	match := re.FindStringSubmatch(s)
+	sh.setArray("BASH_REMATCH", match)
+	return match != nil, nil
+}
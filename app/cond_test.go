@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestCondPatterns(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"glob", "x='a b*'\n[[ $x == a\\ b* ]] && echo yes\n[[ abc == a?d ]] || echo no\n", "yes\nno\n"},
+		{"quoted pattern", "x='a b*'\n[[ $x == \"a b*\" ]] && echo literal\n[[ 'a bc' == \"a b*\" ]] || echo no\n", "literal\nno\n"},
+		{"partly quoted", "[[ abc == \"a\"* ]] && echo yes\n", "yes\n"},
+		{"not equal", "[[ abc != a?d ]] && echo yes\n[[ abc != a* ]] || echo no\n", "yes\nno\n"},
+		{"no splitting", "z='1 2'\n[[ $z == \"1 2\" ]] && echo yes\ny=\n[[ $y == '' ]] && echo empty\n", "yes\nempty\n"},
+	})
+}
+
+func TestCondRegex(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"captures", "[[ foo123bar =~ ([a-z]+)([0-9]+) ]] && echo \"${BASH_REMATCH[0]} ${BASH_REMATCH[1]} ${BASH_REMATCH[2]}\"\n", "foo123 foo 123\n"},
+		{"from a variable", "re='^v([0-9]+)\\.([0-9]+)$'\n[[ v1.22 =~ $re ]] && echo \"${BASH_REMATCH[1]}-${BASH_REMATCH[2]}\"\n", "1-22\n"},
+		{"quoted is literal", "[[ a.b =~ \"a.b\" ]] && echo yes\n[[ axb =~ \"a.b\" ]] || echo no\n", "yes\nno\n"},
+		{"no match", "[[ abc =~ ^b ]]; echo $? ${#BASH_REMATCH[@]}\n", "1 0\n"},
+	})
+}
+
+func TestCondLogical(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"and", "x=abc\n[[ -n $x && $x == a* ]] && echo yes\n[[ -n $x && $x == b* ]] || echo no\n", "yes\nno\n"},
+		{"or", "x=abc\n[[ -z $x || $x == a* ]] && echo yes\n", "yes\n"},
+		{"not", "x=abc\n[[ ! -z $x ]] && echo yes\n", "yes\n"},
+		{"grouped", "[[ ( a == b || a == a ) && b == b ]] && echo yes\n[[ a == b || ( a == a && b == c ) ]] || echo no\n", "yes\nno\n"},
+		{"short circuit", "[[ a == b && $(echo run >&2) ]] 2>&1 || echo skipped\n", "skipped\n"},
+		{"other tests", "[[ 10 -gt 9 && abc < abd ]] && echo yes\n[[ -f script.sh && -d . ]] && echo files\n", "yes\nfiles\n"},
+	})
+}
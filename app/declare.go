@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+func (sh *Shell) executeDeclareCmd(cmd *Command) int {
+	return sh.declare(cmd, len(sh.locals) > 0)
+}
+
+// declare sets the attributes and values of variables, for the declare and
+// local builtins. With local set, the variables are made local to the
+// function running.
+func (sh *Shell) declare(cmd *Command, local bool) int {
+	args := cmd.Args
+	var on, off string
+	print := false
+	for len(args) > 0 && len(args[0]) > 1 && (args[0][0] == '-' || args[0][0] == '+') {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		for _, c := range opt[1:] {
+			switch {
+			case c == 'p' && opt[0] == '-':
+				print = true
+			case strings.ContainsRune("airx", c) && opt[0] == '-':
+				on += string(c)
+			case strings.ContainsRune("airx", c):
+				off += string(c)
+			default:
+				fmt.Fprintf(cmd.Stderr, "%s: %c%c: invalid option\n", cmd.Exec, opt[0], c)
+				fmt.Fprintf(cmd.Stderr, "%s: usage: %s [-airx] [-p] [name[=value] ...]\n", cmd.Exec, cmd.Exec)
+				return 2
+			}
+		}
+	}
+
+	if print || len(args) == 0 {
+		return sh.printDeclarations(cmd, args, on)
+	}
+
+	status := 0
+	for _, arg := range args {
+		if err := sh.declareVar(arg, on, off, local); err != nil {
+			fmt.Fprintf(cmd.Stderr, "%s: %v\n", cmd.Exec, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// declareVar declares a variable, "NAME[=value]", turning on the attributes
+// in on and off those in off.
+func (sh *Shell) declareVar(arg, on, off string, local bool) error {
+	target, value, appending := cutAssignment(arg)
+	hasValue := strings.Contains(arg, "=")
+	name, sub, isElement := cutSubscript(target)
+	if !isElement {
+		name = target
+	}
+	if !isName(name) {
+		return fmt.Errorf("`%s': not a valid identifier", arg)
+	}
+	if hasValue || strings.Contains(off, "r") {
+		if err := sh.checkWritable(name); err != nil {
+			return err
+		}
+	}
+	if local {
+		if err := sh.makeLocal(name); err != nil {
+			return err
+		}
+	}
+
+	v, ok := sh.vars[name]
+	if !ok {
+		// A variable declared without a value stays unset, unless it has
+		// attributes to keep
+		if !hasValue && on == "" {
+			return nil
+		}
+		v = &variable{}
+		sh.vars[name] = v
+	}
+
+	if strings.Contains(off, "a") && v.array != nil {
+		return fmt.Errorf("%s: cannot destroy array variables in this way", name)
+	}
+	if strings.Contains(on, "a") && v.array == nil {
+		if ok {
+			v.array = newArray([]string{v.value})
+		} else {
+			v.array = newArray(nil)
+		}
+		v.value = ""
+	}
+	v.integer = (v.integer || strings.Contains(on, "i")) && !strings.Contains(off, "i")
+	v.exported = (v.exported || strings.Contains(on, "x")) && !strings.Contains(off, "x")
+
+	if hasValue {
+		isArrayValue := !isElement && strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")")
+		var err error
+		if appending && !isArrayValue {
+			value, err = sh.appendedValue(target, value)
+		}
+		switch {
+		case err != nil:
+		case isArrayValue:
+			err = sh.assignArray(name, value, appending)
+		case isElement:
+			err = sh.assignElement(name, sub, value)
+		default:
+			err = sh.assignVar(name, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if strings.Contains(on, "r") {
+		v.readonly = true
+	}
+	return nil
+}
+
+// printDeclarations prints the declare commands that recreate variables:
+// those named, or all those with the attributes in attrs if none are.
+func (sh *Shell) printDeclarations(cmd *Command, names []string, attrs string) int {
+	if len(names) == 0 {
+		for name, v := range sh.vars {
+			if !strings.ContainsFunc(attrs, func(c rune) bool { return !strings.ContainsRune(v.attributes(), c) }) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+	}
+
+	status := 0
+	for _, name := range names {
+		v, ok := sh.vars[name]
+		if !ok {
+			fmt.Fprintf(cmd.Stderr, "%s: %s: not found\n", cmd.Exec, name)
+			status = 1
+			continue
+		}
+
+		flags := v.attributes()
+		if flags == "" {
+			flags = "-"
+		}
+		if v.array == nil {
+			fmt.Fprintf(cmd.Stdout, "declare -%s %s=%s\n", flags, name, doubleQuote(v.value))
+			continue
+		}
+		elems := make([]string, len(v.array.values))
+		for j, elem := range v.array.values {
+			elems[j] = fmt.Sprintf("[%d]=%s", v.array.indexes[j], doubleQuote(elem))
+		}
+		fmt.Fprintf(cmd.Stdout, "declare -%s %s=(%s)\n", flags, name, strings.Join(elems, " "))
+	}
+	return status
+}
+
+// attributes returns the letters of the options of declare that give a
+// variable its attributes.
+func (v *variable) attributes() string {
+	var attrs string
+	if v.array != nil {
+		attrs += "a"
+	}
+	if v.integer {
+		attrs += "i"
+	}
+	if v.readonly {
+		attrs += "r"
+	}
+	if v.exported {
+		attrs += "x"
+	}
+	return attrs
+}
+
+// doubleQuote double-quotes s so that the shell reads it back unchanged.
+func doubleQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if strings.ContainsRune("\"$\\`", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (sh *Shell) executeReadonlyCmd(cmd *Command) int {
+	args := cmd.Args
+	attrs := "r"
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		for _, c := range opt[1:] {
+			switch c {
+			case 'p':
+			case 'a':
+				attrs = "ar"
+			default:
+				fmt.Fprintf(cmd.Stderr, "readonly: -%c: invalid option\n", c)
+				fmt.Fprintln(cmd.Stderr, "readonly: usage: readonly [-ap] [name[=value] ...]")
+				return 2
+			}
+		}
+	}
+
+	if len(args) == 0 {
+		return sh.printDeclarations(cmd, nil, attrs)
+	}
+
+	status := 0
+	for _, arg := range args {
+		if err := sh.declareVar(arg, attrs, "", false); err != nil {
+			fmt.Fprintf(cmd.Stderr, "readonly: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func (sh *Shell) executeUnsetCmd(cmd *Command) int {
+	args := cmd.Args
+	vars, funcs := true, true
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		for _, c := range opt[1:] {
+			switch c {
+			case 'v':
+				vars, funcs = true, false
+			case 'f':
+				vars, funcs = false, true
+			default:
+				fmt.Fprintf(cmd.Stderr, "unset: -%c: invalid option\n", c)
+				fmt.Fprintln(cmd.Stderr, "unset: usage: unset [-f] [-v] [name ...]")
+				return 2
+			}
+		}
+	}
+
+	status := 0
+	for _, name := range args {
+		// Without an option, a name that isn't a variable is a function's
+		if _, isVar := sh.vars[name]; funcs && (!vars || !isVar) {
+			if _, ok := sh.funcs[name]; ok {
+				delete(sh.funcs, name)
+				continue
+			}
+			if !vars {
+				continue
+			}
+		}
+
+		if err := sh.unsetVar(name); err != nil {
+			fmt.Fprintf(cmd.Stderr, "unset: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// unsetVar unsets a variable, or an element of an array. Arrays being dense,
+// only the last element is removed, and the others are emptied instead.
+func (sh *Shell) unsetVar(name string) error {
+	array, sub, isElement := cutSubscript(name)
+	if !isElement {
+		array = name
+	}
+	if !isName(array) {
+		return fmt.Errorf("`%s': not a valid identifier", name)
+	}
+	v, ok := sh.vars[array]
+	if !ok {
+		return nil
+	}
+	if v.readonly {
+		return fmt.Errorf("%s: cannot unset: readonly variable", array)
+	}
+	if !isElement {
+		delete(sh.vars, name)
+		return nil
+	}
+
+	i, err := sh.arrayIndex(sub, sh.getArray(array).end())
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return fmt.Errorf("%s: bad array subscript", name)
+	}
+	if v.array == nil {
+		sh.setArray(array, []string{v.value})
+	}
+	v.array.unset(i)
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestDeclareInteger(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"assignment", "declare -i n\nn=2+3\necho $n\n", "5\n"},
+		{"appending adds", "declare -i n=5\nn+=4\necho $n\n", "9\n"},
+		{"with a value", "declare -i m=7*6\necho $m\n", "42\n"},
+		{"variables", "x=3\ndeclare -i n=x*2\necho $n\n", "6\n"},
+		{"not a number", "declare -i n\nn=abc\necho $n\n", "0\n"},
+		{"attribute removed", "declare -i m\ndeclare +i m\nm=1+1\necho $m\n", "1+1\n"},
+		{"printed", "declare -i n=1\ndeclare -p n\n", "declare -i n=\"1\"\n"},
+	})
+}
+
+func TestDeclareReadonly(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"assignment", "declare -r c=5\nc=6 2>/dev/null\necho $? $c\n", "1 5\n"},
+		{"declare again", "declare -r c=5\ndeclare c=7 2>/dev/null\necho $? $c\n", "1 5\n"},
+		{"unset", "declare -r c=5\nunset c 2>/dev/null\necho $? $c\n", "1 5\n"},
+		{"printed", "declare -r c=5\ndeclare -p c\n", "declare -r c=\"5\"\n"},
+		{"array", "declare -a arr\narr[2]=x\ndeclare -p arr\n", "declare -a arr=([2]=\"x\")\n"},
+	})
+
+	_, errOut, _ := runScript(t, "declare -r c=5\nc=6\n", "")
+	if want := "c: readonly variable\n"; errOut != want {
+		t.Errorf("got %q, want %q", errOut, want)
+	}
+}
+
+func TestReadonly(t *testing.T) {
+	tests := []struct {
+		name, script, out, err string
+	}{
+		{"reassignment", "readonly r=1\nr=2\necho $? $r\n", "1 1\n", "r: readonly variable\n"},
+		{"unset", "readonly r=1\nunset r\necho $? $r\n", "1 1\n", "unset: r: cannot unset: readonly variable\n"},
+		{"readonly again", "readonly r=1\nreadonly r=3\necho $? $r\n", "1 1\n", "readonly: r: readonly variable\n"},
+		{"existing variable", "r=1\nreadonly r\nr=2\necho $? $r\n", "1 1\n", "r: readonly variable\n"},
+		{"listed", "readonly r=1\nreadonly -p | grep ' r='\n", "declare -r r=\"1\"\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errOut, _ := runScript(t, tt.script, "")
+			if out != tt.out || errOut != tt.err {
+				t.Errorf("got %q and %q, want %q and %q", out, errOut, tt.out, tt.err)
+			}
+		})
+	}
+}
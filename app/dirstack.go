@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// dirStack returns the directory stack, the current directory first.
+func (sh *Shell) dirStack() []string {
+	pwd, _ := sh.getVar("PWD")
+	return append([]string{pwd}, sh.dirs...)
+}
+
+// stackIndex resolves a "+N" or "-N" argument to the index of an entry of a
+// stack of n entries, counting from the top or from the bottom. It reports
+// whether arg is one, with an error if it's out of range.
+func stackIndex(arg string, n int) (int, bool, error) {
+	if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+		return 0, false, nil
+	}
+	i, err := strconv.Atoi(arg[1:])
+	if err != nil || i < 0 || arg[1] == '+' || arg[1] == '-' {
+		return 0, false, nil
+	}
+
+	if i >= n {
+		return 0, true, fmt.Errorf("%s: directory stack index out of range", arg)
+	}
+	if arg[0] == '-' {
+		i = n - 1 - i
+	}
+	return i, true, nil
+}
+
+// printDirStack prints the directory stack on one line, as pushd and popd
+// do after changing it.
+func (sh *Shell) printDirStack(cmd *Command) {
+	stack := sh.dirStack()
+	for i, dir := range stack {
+		stack[i] = sh.tildeDir(dir)
+	}
+	fmt.Fprintln(cmd.Stdout, strings.Join(stack, " "))
+}
+
+// executePushdCmd pushes a directory onto the stack and changes to it. With
+// "+N" or "-N", it rotates the stack so that entry N is on top instead, and
+// without arguments it swaps the top two entries.
+func (sh *Shell) executePushdCmd(cmd *Command) int {
+	stack := sh.dirStack()
+	if len(cmd.Args) > 0 {
+		i, isIndex, err := stackIndex(cmd.Args[0], len(stack))
+		if isIndex && len(stack) == 1 {
+			err = errors.New("directory stack empty")
+		}
+		switch {
+		case err != nil:
+			fmt.Fprintf(cmd.Stderr, "pushd: %v\n", err)
+			return 1
+		case isIndex:
+			return sh.rotateDirStack(cmd, i)
+		case len(cmd.Args[0]) > 1 && cmd.Args[0][0] == '-':
+			fmt.Fprintf(cmd.Stderr, "pushd: %s: invalid number\n", cmd.Args[0])
+			fmt.Fprintln(cmd.Stderr, "pushd: usage: pushd [dir | +N | -N]")
+			return 2
+		}
+	}
+
+	if len(cmd.Args) == 0 {
+		// Swap the top two directories
+		if len(stack) < 2 {
+			fmt.Fprintln(cmd.Stderr, "pushd: no other directory")
+			return 1
+		}
+		if err := sh.changeDir(stack[1], false); err != nil {
+			fmt.Fprintf(cmd.Stderr, "pushd: %v\n", err)
+			return 1
+		}
+		sh.dirs[0] = stack[0]
+		sh.printDirStack(cmd)
+		return 0
+	}
+
+	if err := sh.changeDir(cmd.Args[0], false); err != nil {
+		fmt.Fprintf(cmd.Stderr, "pushd: %v\n", err)
+		return 1
+	}
+	sh.dirs = append([]string{stack[0]}, sh.dirs...)
+	sh.printDirStack(cmd)
+	return 0
+}
+
+// rotateDirStack rotates the directory stack so that entry i is on top,
+// changing to it.
+func (sh *Shell) rotateDirStack(cmd *Command, i int) int {
+	stack := sh.dirStack()
+	if err := sh.changeDir(stack[i], false); err != nil {
+		fmt.Fprintf(cmd.Stderr, "pushd: %v\n", err)
+		return 1
+	}
+	rotated := append(stack[i:], stack[:i]...)
+	sh.dirs = rotated[1:]
+	sh.printDirStack(cmd)
+	return 0
+}
+
+// executePopdCmd removes the top entry of the directory stack and changes
+// to the next one. With "+N" or "-N", it removes entry N instead, only
+// changing directory when that's the top one.
+func (sh *Shell) executePopdCmd(cmd *Command) int {
+	if len(sh.dirs) == 0 {
+		fmt.Fprintln(cmd.Stderr, "popd: directory stack empty")
+		return 1
+	}
+
+	if len(cmd.Args) > 0 {
+		i, isIndex, err := stackIndex(cmd.Args[0], len(sh.dirs)+1)
+		if err != nil {
+			fmt.Fprintf(cmd.Stderr, "popd: %v\n", err)
+			return 1
+		}
+		if !isIndex {
+			fmt.Fprintf(cmd.Stderr, "popd: %s: invalid number\n", cmd.Args[0])
+			fmt.Fprintln(cmd.Stderr, "popd: usage: popd [+N | -N]")
+			return 2
+		}
+		if i > 0 {
+			sh.dirs = slices.Delete(sh.dirs, i-1, i)
+			sh.printDirStack(cmd)
+			return 0
+		}
+	}
+
+	if err := sh.changeDir(sh.dirs[0], false); err != nil {
+		fmt.Fprintf(cmd.Stderr, "popd: %v\n", err)
+		return 1
+	}
+	sh.dirs = sh.dirs[1:]
+	sh.printDirStack(cmd)
+	return 0
+}
+
+func (sh *Shell) executeDirsCmd(cmd *Command) int {
+	var clear, long, perLine, verbose bool
+	stack := sh.dirStack()
+	entry := -1
+	for _, arg := range cmd.Args {
+		i, isIndex, err := stackIndex(arg, len(stack))
+		if err != nil {
+			fmt.Fprintf(cmd.Stderr, "dirs: %v\n", err)
+			return 1
+		}
+		if isIndex {
+			entry = i
+			continue
+		}
+
+		if len(arg) < 2 || arg[0] != '-' {
+			fmt.Fprintf(cmd.Stderr, "dirs: %s: invalid option\n", arg)
+			fmt.Fprintln(cmd.Stderr, "dirs: usage: dirs [-clpv] [+N] [-N]")
+			return 2
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'c':
+				clear = true
+			case 'l':
+				long = true
+			case 'p':
+				perLine = true
+			case 'v':
+				verbose = true
+			default:
+				fmt.Fprintf(cmd.Stderr, "dirs: -%c: invalid option\n", c)
+				fmt.Fprintln(cmd.Stderr, "dirs: usage: dirs [-clpv] [+N] [-N]")
+				return 2
+			}
+		}
+	}
+
+	if clear {
+		sh.dirs = nil
+		return 0
+	}
+
+	// Directories under $HOME are shown with a "~", unless long
+	for i, dir := range stack {
+		if !long {
+			stack[i] = sh.tildeDir(dir)
+		}
+	}
+	switch {
+	case entry >= 0:
+		fmt.Fprintln(cmd.Stdout, stack[entry])
+	case verbose:
+		for i, dir := range stack {
+			fmt.Fprintf(cmd.Stdout, "%2d  %s\n", i, dir)
+		}
+	case perLine:
+		for _, dir := range stack {
+			fmt.Fprintln(cmd.Stdout, dir)
+		}
+	default:
+		fmt.Fprintln(cmd.Stdout, strings.Join(stack, " "))
+	}
+	return 0
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+// dirsSetup makes three directories in $HOME and pushes them in turn, for
+// a stack of ~/c ~/b ~/a ~.
+const dirsSetup = "mkdir a b c\npushd a >/dev/null\npushd ../b >/dev/null\npushd ../c >/dev/null\n"
+
+func TestDirs(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"listed", dirsSetup + "dirs\n", "~/c ~/b ~/a ~\n"},
+		{"long", dirsSetup + "dirs -l | sed \"s#$HOME#H#g\"\n", "H/c H/b H/a H\n"},
+		{"verbose", dirsSetup + "dirs -v\n", " 0  ~/c\n 1  ~/b\n 2  ~/a\n 3  ~\n"},
+		{"one per line", dirsSetup + "dirs -p\n", "~/c\n~/b\n~/a\n~\n"},
+		{"entry", dirsSetup + "dirs +1\ndirs -0\ndirs +0\n", "~/b\n~\n~/c\n"},
+		{"out of range", dirsSetup + "dirs +4 2>/dev/null; echo $?\ndirs -4 2>/dev/null; echo $?\n", "1\n1\n"},
+		{"cleared", dirsSetup + "dirs -c\ndirs\ndirs -v\necho ${PWD#$HOME/}\n", "~/c\n 0  ~/c\nc\n"},
+	})
+}
+
+func TestDirsIndexes(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"rotated", dirsSetup + "pushd +1\necho ${PWD#$HOME/}\n", "~/b ~/a ~ ~/c\nb\n"},
+		{"rotated from the bottom", dirsSetup + "pushd -0\n[ \"$PWD\" = \"$HOME\" ] && echo home\n", "~ ~/c ~/b ~/a\nhome\n"},
+		{"removed", dirsSetup + "popd +2\necho ${PWD#$HOME/}\n", "~/c ~/b ~\nc\n"},
+		{"removed from the bottom", dirsSetup + "popd -1\necho ${PWD#$HOME/}\n", "~/c ~/b ~\nc\n"},
+		{"top removed", dirsSetup + "popd +0\necho ${PWD#$HOME/}\n", "~/b ~/a ~\nb\n"},
+		{"out of range", dirsSetup + "pushd +4 2>/dev/null; echo $?\npopd -4 2>/dev/null; echo $?\ndirs\n", "1\n1\n~/c ~/b ~/a ~\n"},
+	})
+}
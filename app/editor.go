@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+)
+
+// errInterrupted is returned by the line editor when the user discards the
+// line with Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineBuffer is the line being edited, along with the cursor position. It
+// spans several lines of the terminal when a command is continued on more
+// lines.
+type lineBuffer struct {
+	text   []rune
+	cursor int // index in text the cursor is before
+}
+
+func (b *lineBuffer) String() string {
+	return string(b.text)
+}
+
+// set replaces the whole line, with the cursor at its end.
+func (b *lineBuffer) set(s string) {
+	b.text = []rune(s)
+	b.cursor = len(b.text)
+}
+
+// insert inserts r before the cursor.
+func (b *lineBuffer) insert(r rune) {
+	b.text = append(b.text[:b.cursor], append([]rune{r}, b.text[b.cursor:]...)...)
+	b.cursor++
+}
+
+// backspace deletes the character before the cursor.
+func (b *lineBuffer) backspace() {
+	if b.cursor > 0 {
+		b.text = append(b.text[:b.cursor-1], b.text[b.cursor:]...)
+		b.cursor--
+	}
+}
+
+// deleteChar deletes the character under the cursor.
+func (b *lineBuffer) deleteChar() {
+	if b.cursor < len(b.text) {
+		b.text = append(b.text[:b.cursor], b.text[b.cursor+1:]...)
+	}
+}
+
+// lineStart and lineEnd return the indexes of the start and the end of the
+// line of the buffer the cursor is on.
+func (b *lineBuffer) lineStart() int {
+	start := b.cursor
+	for start > 0 && b.text[start-1] != '\n' {
+		start--
+	}
+	return start
+}
+
+func (b *lineBuffer) lineEnd() int {
+	end := b.cursor
+	for end < len(b.text) && b.text[end] != '\n' {
+		end++
+	}
+	return end
+}
+
+// killToStart deletes from the start of the line up to the cursor.
+func (b *lineBuffer) killToStart() {
+	start := b.lineStart()
+	b.text = append(b.text[:start], b.text[b.cursor:]...)
+	b.cursor = start
+}
+
+// killToEnd deletes from the cursor up to the end of the line.
+func (b *lineBuffer) killToEnd() {
+	b.text = append(b.text[:b.cursor], b.text[b.lineEnd():]...)
+}
+
+// killWordBack deletes the whitespace-delimited word before the cursor.
+func (b *lineBuffer) killWordBack() {
+	start := b.cursor
+	for start > 0 && isBlank(b.text[start-1]) {
+		start--
+	}
+	for start > 0 && !isBlank(b.text[start-1]) {
+		start--
+	}
+	b.text = append(b.text[:start], b.text[b.cursor:]...)
+	b.cursor = start
+}
+
+// moveLeft and moveRight move the cursor by a character.
+func (b *lineBuffer) moveLeft() {
+	b.cursor = max(b.cursor-1, 0)
+}
+
+func (b *lineBuffer) moveRight() {
+	b.cursor = min(b.cursor+1, len(b.text))
+}
+
+// moveHome and moveEnd move the cursor to the start and the end of the line.
+func (b *lineBuffer) moveHome() {
+	b.cursor = b.lineStart()
+}
+
+func (b *lineBuffer) moveEnd() {
+	b.cursor = b.lineEnd()
+}
+
+// moveWordBack moves the cursor to the start of the word before it, words
+// being made of letters and digits.
+func (b *lineBuffer) moveWordBack() {
+	for b.cursor > 0 && !isWordRune(b.text[b.cursor-1]) {
+		b.cursor--
+	}
+	for b.cursor > 0 && isWordRune(b.text[b.cursor-1]) {
+		b.cursor--
+	}
+}
+
+// moveWordForward moves the cursor to the end of the word after it.
+func (b *lineBuffer) moveWordForward() {
+	for b.cursor < len(b.text) && !isWordRune(b.text[b.cursor]) {
+		b.cursor++
+	}
+	for b.cursor < len(b.text) && isWordRune(b.text[b.cursor]) {
+		b.cursor++
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isBlank(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// completer returns the completions of the word a line ends with, along
+// with the index in the line where the word starts.
+type completer func(line string) (int, []string)
+
+// continuer returns the prompt to continue an incomplete command on another
+// line with, reporting whether the command is incomplete.
+type continuer func(text string) (string, bool)
+
+// lineEditor reads lines from the terminal in raw mode, with emacs-style
+// editing keys, the history a keystroke away and Tab completion. A command
+// left incomplete goes on to another line, edited along with the first ones.
+type lineEditor struct {
+	fd        int
+	out       io.Writer
+	complete  completer
+	continued continuer
+
+	ps2 string // prompt of the lines continuing the command
+	row int    // line of the command the terminal cursor is on
+}
+
+func newLineEditor(fd int, complete completer, continued continuer) *lineEditor {
+	return &lineEditor{fd: fd, out: os.Stdout, complete: complete, continued: continued}
+}
+
+// readLine prints the prompt and reads a line, without its newline. It
+// returns io.EOF on Ctrl-D at an empty line, and errInterrupted on Ctrl-C.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	state, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restoreTerminal(e.fd, state)
+
+	var (
+		buf     lineBuffer
+		histPos = len(history.entries) // entry shown, len for the new line
+		pending string                 // the new line while browsing history
+		tabs    int                    // Tab presses in a row
+	)
+
+	e.ps2 = "> "
+	fmt.Fprint(e.out, prompt)
+	e.row, _ = screenPos(prompt, termColumns(e.fd))
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		if key == "\t" {
+			tabs++
+		} else {
+			tabs = 0
+		}
+
+		switch key {
+		case "\r", "\n":
+			if ps2, ok := e.continued(buf.String()); ok {
+				e.ps2 = ps2
+				buf.insert('\n')
+				break
+			}
+			e.redraw(prompt, &buf, len(buf.text))
+			fmt.Fprint(e.out, "\n")
+			return buf.String(), nil
+
+		case "\x03": // Ctrl-C
+			fmt.Fprint(e.out, "^C\n")
+			return "", errInterrupted
+
+		case "\x04": // Ctrl-D
+			if len(buf.text) == 0 {
+				fmt.Fprint(e.out, "\n")
+				return "", io.EOF
+			}
+			buf.deleteChar()
+
+		case "\x7f", "\x08": // Backspace
+			buf.backspace()
+		case "\x1b[3~": // Delete
+			buf.deleteChar()
+		case "\x15": // Ctrl-U
+			buf.killToStart()
+		case "\x0b": // Ctrl-K
+			buf.killToEnd()
+		case "\x17": // Ctrl-W
+			buf.killWordBack()
+
+		case "\x1b[D", "\x02": // Left, Ctrl-B
+			buf.moveLeft()
+		case "\x1b[C", "\x06": // Right, Ctrl-F
+			buf.moveRight()
+		case "\x01", "\x1b[H", "\x1bOH", "\x1b[1~", "\x1b[7~": // Ctrl-A, Home
+			buf.moveHome()
+		case "\x05", "\x1b[F", "\x1bOF", "\x1b[4~", "\x1b[8~": // Ctrl-E, End
+			buf.moveEnd()
+		case "\x1bb", "\x1b[1;5D", "\x1b[1;3D": // Alt-B, Ctrl-Left
+			buf.moveWordBack()
+		case "\x1bf", "\x1b[1;5C", "\x1b[1;3C": // Alt-F, Ctrl-Right
+			buf.moveWordForward()
+
+		case "\t":
+			e.completeWord(prompt, &buf, tabs)
+
+		case "\x1b[A", "\x10": // Up, Ctrl-P
+			if histPos > 0 {
+				if histPos == len(history.entries) {
+					pending = buf.String()
+				}
+				histPos--
+				buf.set(history.entries[histPos])
+			}
+		case "\x1b[B", "\x0e": // Down, Ctrl-N
+			if histPos < len(history.entries) {
+				histPos++
+				if histPos == len(history.entries) {
+					buf.set(pending)
+				} else {
+					buf.set(history.entries[histPos])
+				}
+			}
+
+		default:
+			r, _ := utf8.DecodeRuneInString(key)
+			if len(key) == utf8.RuneLen(r) && r >= ' ' {
+				buf.insert(r)
+			}
+		}
+
+		e.redraw(prompt, &buf, buf.cursor)
+	}
+}
+
+// completeWord completes the word before the cursor. A single completion
+// replaces it, followed by a space unless it's a directory, and several ones
+// extend it as far as they agree. When that gets nowhere, the bell rings,
+// and a second Tab in a row lists the completions.
+func (e *lineEditor) completeWord(prompt string, buf *lineBuffer, tabs int) {
+	if e.complete == nil {
+		return
+	}
+	before := string(buf.text[:buf.cursor])
+	start, words := e.complete(before)
+	if len(words) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return
+	}
+
+	word := words[0]
+	if len(words) == 1 && !strings.HasSuffix(word, "/") {
+		word += " "
+	}
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, word) {
+			_, size := utf8.DecodeLastRuneInString(word)
+			word = word[:len(word)-size]
+		}
+	}
+
+	if word != before[start:] {
+		rest := string(buf.text[buf.cursor:])
+		buf.set(before[:start] + word + rest)
+		buf.cursor = utf8.RuneCountInString(before[:start] + word)
+		return
+	}
+
+	if tabs < 2 {
+		fmt.Fprint(e.out, "\a")
+		return
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(words, "  "))
+	e.row = 0 // the command is drawn anew below the list
+}
+
+// redraw rewrites the prompt and the line, leaving the terminal cursor at
+// index cursor of the line. The lines continuing the command get the PS2
+// prompt. Lines wider than the terminal wrap, so the rows to go back up are
+// counted from the visible width of what was written.
+func (e *lineEditor) redraw(prompt string, buf *lineBuffer, cursor int) {
+	cols := termColumns(e.fd)
+	if e.row > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dA", e.row)
+	}
+	shown := prompt + strings.ReplaceAll(buf.String(), "\n", "\n"+e.ps2)
+	fmt.Fprint(e.out, "\r\x1b[J", strings.ReplaceAll(shown, "\n", "\r\n"))
+
+	// A line filling the last column leaves the terminal cursor there, until
+	// the next character goes on the row below
+	row, col := screenPos(shown, cols)
+	if col == cols {
+		fmt.Fprint(e.out, "\r\n")
+		row++
+	}
+
+	before := prompt + strings.ReplaceAll(string(buf.text[:cursor]), "\n", "\n"+e.ps2)
+	curRow, curCol := screenPos(before, cols)
+	if curCol == cols {
+		curRow, curCol = curRow+1, 0
+	}
+	if up := row - curRow; up > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dA", up)
+	}
+	fmt.Fprint(e.out, "\r")
+	if curCol > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dC", curCol)
+	}
+	e.row = curRow
+}
+
+// screenPos returns the row and the column the terminal cursor ends up at
+// after writing s from the start of a row, on a terminal cols wide. The color
+// sequences and the other control characters take no room. The column is
+// cols when the last row written is full.
+func screenPos(s string, cols int) (row, col int) {
+	for _, r := range stripColors(s) {
+		switch {
+		case r == '\n':
+			row, col = row+1, 0
+		case unicode.IsControl(r):
+		default:
+			if col == cols {
+				row, col = row+1, 0
+			}
+			col++
+		}
+	}
+	return row, col
+}
+
+// readKey reads a single key press: one character, or a whole escape
+// sequence for the special keys.
+func (e *lineEditor) readKey() (string, error) {
+	b, err := e.readByte()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case b == 0x1b:
+		next, err := e.readByte()
+		if err != nil {
+			return "", err
+		}
+		if next != '[' && next != 'O' {
+			return string([]byte{b, next}), nil
+		}
+
+		// A CSI sequence ends with its first letter or "~"
+		seq := []byte{b, next}
+		for {
+			c, err := e.readByte()
+			if err != nil {
+				return "", err
+			}
+			seq = append(seq, c)
+			if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || c == '~' {
+				return string(seq), nil
+			}
+		}
+
+	case b >= 0x80:
+		// The rest of a UTF-8 encoded character
+		seq := []byte{b}
+		for !utf8.FullRune(seq) {
+			c, err := e.readByte()
+			if err != nil {
+				return "", err
+			}
+			seq = append(seq, c)
+		}
+		return string(seq), nil
+	}
+
+	return string([]byte{b}), nil
+}
+
+func (e *lineEditor) readByte() (byte, error) {
+	var b [1]byte
+	for {
+		n, err := syscall.Read(e.fd, b[:])
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, io.EOF
+		}
+		return b[0], nil
+	}
+}
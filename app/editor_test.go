@@ -0,0 +1,236 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// editBuffer returns a buffer holding text, with the cursor where the "|" is.
+func editBuffer(text string) *lineBuffer {
+	b := &lineBuffer{}
+	b.set(strings.Replace(text, "|", "", 1))
+	b.cursor = len([]rune(text[:strings.Index(text, "|")]))
+	return b
+}
+
+// shownBuffer returns the text of b with a "|" where its cursor is.
+func shownBuffer(b *lineBuffer) string {
+	return string(b.text[:b.cursor]) + "|" + string(b.text[b.cursor:])
+}
+
+func TestKillKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*lineBuffer)
+		text string
+		want string
+	}{
+		{"Ctrl-U", (*lineBuffer).killToStart, "echo he|llo", "|llo"},
+		{"Ctrl-U at the start", (*lineBuffer).killToStart, "|echo", "|echo"},
+		{"Ctrl-U on a continued line", (*lineBuffer).killToStart, "if x\nthen ec|ho", "if x\n|ho"},
+		{"Ctrl-K", (*lineBuffer).killToEnd, "echo he|llo", "echo he|"},
+		{"Ctrl-K at the end", (*lineBuffer).killToEnd, "echo|", "echo|"},
+		{"Ctrl-K on a continued line", (*lineBuffer).killToEnd, "if| x\nthen", "if|\nthen"},
+		{"Ctrl-W", (*lineBuffer).killWordBack, "echo hello|", "echo |"},
+		{"Ctrl-W after blanks", (*lineBuffer).killWordBack, "echo a/b  |c", "echo |c"},
+		{"Ctrl-W at the start", (*lineBuffer).killWordBack, "|echo", "|echo"},
+		{"Ctrl-W of UTF-8", (*lineBuffer).killWordBack, "echo héllo wörld|", "echo héllo |"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := editBuffer(tt.text)
+			tt.edit(b)
+			if got := shownBuffer(b); got != tt.want {
+				t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedrawWraps(t *testing.T) {
+	var out strings.Builder
+	e := &lineEditor{fd: -1, out: &out, ps2: "> "} // not a terminal, 80 columns
+	b := editBuffer("echo " + strings.Repeat("x", 100) + "|")
+
+	// The line takes two rows after the prompt, the cursor being on the
+	// second one
+	e.redraw("$ ", b, b.cursor)
+	if e.row != 1 {
+		t.Errorf("cursor drawn on row %d, want 1", e.row)
+	}
+
+	// Redrawing goes back up to the first row, and leaves the cursor after
+	// the prompt
+	out.Reset()
+	b.moveHome()
+	e.redraw("$ ", b, b.cursor)
+	if got := out.String(); !strings.HasPrefix(got, "\x1b[1A\r\x1b[J$ echo") || !strings.HasSuffix(got, "\x1b[1A\r\x1b[2C") {
+		t.Errorf("got %q", got)
+	}
+	if e.row != 0 {
+		t.Errorf("cursor drawn on row %d, want 0", e.row)
+	}
+}
+
+func TestScreenPos(t *testing.T) {
+	tests := []struct {
+		s        string
+		row, col int
+	}{
+		{"", 0, 0},
+		{"$ echo", 0, 6},
+		{"\x1b[1;32m$\x1b[0m ", 0, 2},
+		{strings.Repeat("x", 10), 0, 10},
+		{strings.Repeat("x", 11), 1, 1},
+		{strings.Repeat("x", 25), 2, 5},
+		{"a\nb\n", 2, 0},
+		{strings.Repeat("x", 10) + "\nb", 1, 1},
+		{"héllo wörld", 1, 1},
+	}
+	for _, tt := range tests {
+		if row, col := screenPos(tt.s, 10); row != tt.row || col != tt.col {
+			t.Errorf("screenPos(%q, 10) = %d, %d, want %d, %d", tt.s, row, col, tt.row, tt.col)
+		}
+	}
+}
+
+func TestMoveKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*lineBuffer)
+		text string
+		want string
+	}{
+		{"Ctrl-A", (*lineBuffer).moveHome, "echo he|llo", "|echo hello"},
+		{"Ctrl-A on a continued line", (*lineBuffer).moveHome, "if x\nthen e|cho", "if x\n|then echo"},
+		{"Ctrl-E", (*lineBuffer).moveEnd, "ec|ho hello", "echo hello|"},
+		{"Ctrl-E on a first line", (*lineBuffer).moveEnd, "i|f x\nthen", "if x|\nthen"},
+		{"Left", (*lineBuffer).moveLeft, "ab|c", "a|bc"},
+		{"Left at the start", (*lineBuffer).moveLeft, "|abc", "|abc"},
+		{"Right", (*lineBuffer).moveRight, "ab|c", "abc|"},
+		{"Right at the end", (*lineBuffer).moveRight, "abc|", "abc|"},
+		{"Alt-B", (*lineBuffer).moveWordBack, "echo hello|", "echo |hello"},
+		{"Alt-B inside a word", (*lineBuffer).moveWordBack, "echo hel|lo", "echo |hello"},
+		{"Alt-B over punctuation", (*lineBuffer).moveWordBack, "cd /usr/lo|", "cd /usr/|lo"},
+		{"Alt-B at the start", (*lineBuffer).moveWordBack, "|echo", "|echo"},
+		{"Alt-F", (*lineBuffer).moveWordForward, "|echo hello", "echo| hello"},
+		{"Alt-F between words", (*lineBuffer).moveWordForward, "echo| hello", "echo hello|"},
+		{"Alt-F over UTF-8", (*lineBuffer).moveWordForward, "|héllo wörld", "héllo| wörld"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := editBuffer(tt.text)
+			tt.edit(b)
+			if got := shownBuffer(b); got != tt.want {
+				t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedrawContinued(t *testing.T) {
+	var out strings.Builder
+	e := &lineEditor{fd: -1, out: &out, ps2: "> "} // not a terminal, 80 columns
+
+	// The first line wraps onto a second row, and the continued one comes
+	// after the PS2 prompt on the third
+	b := editBuffer("for x in " + strings.Repeat("y ", 40) + "\ndo echo $x|")
+	e.redraw("$ ", b, b.cursor)
+	if got := out.String(); !strings.Contains(got, "\r\n> do echo $x") {
+		t.Errorf("got %q", got)
+	}
+	if e.row != 2 {
+		t.Errorf("cursor drawn on row %d, want 2", e.row)
+	}
+
+	// Going to the start of the continued line stays on its row, after PS2
+	out.Reset()
+	b.moveHome()
+	e.redraw("$ ", b, b.cursor)
+	if got := out.String(); !strings.HasPrefix(got, "\x1b[2A\r\x1b[J") || !strings.HasSuffix(got, "\r\x1b[2C") {
+		t.Errorf("got %q", got)
+	}
+	if e.row != 2 {
+		t.Errorf("cursor drawn on row %d, want 2", e.row)
+	}
+
+	// A prompt of two lines puts the command a row lower
+	out.Reset()
+	e.row = 0
+	b.moveEnd()
+	e.redraw("~\n$ ", b, b.cursor)
+	if e.row != 3 {
+		t.Errorf("cursor drawn on row %d, want 3", e.row)
+	}
+}
+
+func TestEditKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*lineBuffer)
+		text string
+		want string
+	}{
+		{"insert", func(b *lineBuffer) { b.insert('x') }, "ec|ho", "ecx|ho"},
+		{"insert UTF-8", func(b *lineBuffer) { b.insert('é') }, "caf|", "café|"},
+		{"backspace", (*lineBuffer).backspace, "echo|", "ech|"},
+		{"backspace at the start", (*lineBuffer).backspace, "|echo", "|echo"},
+		{"backspace into the line before", (*lineBuffer).backspace, "echo \"a\n|b\"", "echo \"a|b\""},
+		{"delete", (*lineBuffer).deleteChar, "e|cho", "e|ho"},
+		{"delete at the end", (*lineBuffer).deleteChar, "echo|", "echo|"},
+		{"delete the line break", (*lineBuffer).deleteChar, "if x|\nthen", "if x|then"},
+		{"Ctrl-A on a continued line", (*lineBuffer).moveHome, "if x\nthen ec|ho", "if x\n|then echo"},
+		{"Ctrl-E on the first line", (*lineBuffer).moveEnd, "i|f x\nthen", "if x|\nthen"},
+		{"left into the line before", (*lineBuffer).moveLeft, "a\n|b", "a|\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := editBuffer(tt.text)
+			tt.edit(b)
+			if got := shownBuffer(b); got != tt.want {
+				t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadContinuedLines(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"complete", "echo hi\r", "echo hi"},
+		{"open quote", "echo \"a\rb\"\r", "echo \"a\nb\""},
+		{"line continuation", "echo a \\\rb\r", "echo a \\\nb"},
+		{"compound command", "for x in 1 2\rdo echo $x\rdone\r", "for x in 1 2\ndo echo $x\ndone"},
+		{"backspace joins the lines", "echo \"ab\r\x7fc\"\r", "echo \"abc\""},
+		{"edit the first line", "echo 'x\r\x02\x01\x1b[3~\x1b[3~\x1b[3~\x1b[3~printf\x05\x06\x05done'\r", "printf 'x\ndone'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pty, tty := openPty(t)
+			defer pty.Close()
+			defer tty.Close()
+
+			// The keys are typed ahead, past the terminal's own line editing
+			fd := int(tty.Fd())
+			state, err := makeRaw(fd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer restoreTerminal(fd, state)
+
+			sh := newShell(false, "gosh", nil)
+			e := &lineEditor{fd: fd, out: io.Discard, continued: sh.continuationPrompt}
+			if _, err := pty.WriteString(tt.keys); err != nil {
+				t.Fatal(err)
+			}
+			got, err := e.readLine("$ ")
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// runPipeline runs the commands of the pipeline with the output of each one
+// connected to the input of the next, and returns the status of the last.
+func (sh *Shell) runPipeline(pipeline *Pipeline, s Streams) int {
+	// The status of a negated pipeline is tested, so its failure doesn't
+	// count as one either
+	if pipeline.Negate {
+		negated := *pipeline
+		negated.Negate = false
+		status := sh.runCondition(true, func() int { return sh.runPipeline(&negated, s) })
+		return btoi(status == 0)
+	}
+
+	if len(pipeline.Cmds) == 1 {
+		return sh.runCommand(pipeline.Cmds[0], s)
+	}
+
+	// Every stage runs on its own copy of the shell, all of them as part
+	// of the same job
+	job := sh.job
+	if job == nil {
+		job = &Job{Command: pipeline.Source, foreground: true, noGroup: !sh.opts.monitor}
+	}
+
+	// Register all the stages up front, so that the last one is the job's
+	// main process before any of them gets to start a program
+	tasks := make([]*process, len(pipeline.Cmds))
+	for i := range tasks {
+		tasks[i] = job.addTask()
+	}
+	if sh.job == nil {
+		job.main = tasks[len(tasks)-1]
+	}
+
+	stdin := s.Stdin
+	for i, node := range pipeline.Cmds {
+		stage := s
+		stage.Stdin = stdin
+
+		var pipeR, pipeW *os.File
+		if i < len(pipeline.Cmds)-1 {
+			var err error
+			if pipeR, pipeW, err = os.Pipe(); err != nil {
+				fmt.Fprintf(s.Stderr, "%v\n", err)
+				for _, task := range tasks[i:] {
+					job.finishTask(task, 1)
+				}
+				break
+			}
+			stage.Stdout = pipeWriter{pipeW}
+			if pipeline.PipeStderr[i] {
+				stage.Stderr = stage.Stdout
+			}
+		}
+
+		c := sh.newSubshell(stage)
+		c.job = job
+		go func() {
+			status := c.runSubshell(func() int {
+				return c.runCommand(node, stage)
+			})
+
+			// Let the neighbouring stages see the end of their streams
+			if pipeW != nil {
+				pipeW.Close()
+			}
+			if f, ok := stage.Stdin.(*os.File); ok && f != s.Stdin {
+				f.Close()
+			}
+			job.finishTask(tasks[i], status)
+		}()
+
+		stdin = pipeR
+	}
+
+	var status int
+	if sh.job == nil {
+		status = waitForeground(job, s.Stderr)
+		sh.runPendingTraps()
+	} else {
+		status = waitProcess(tasks[len(tasks)-1])
+	}
+
+	// With pipefail, the pipeline fails when any of its stages does
+	jobs.Lock()
+	defer jobs.Unlock()
+	if sh.opts.pipefail && job.State == jobDone {
+		for i := len(tasks) - 1; i >= 0; i-- {
+			if tasks[i].status != 0 {
+				return tasks[i].status
+			}
+		}
+	}
+	return status
+}
+
+// pipeWriter is the output of a pipeline stage into the pipe to the next
+// one. Once nothing reads from the pipe anymore, writing to it ends the
+// stage's subshell, as SIGPIPE would a forked one, so that a loop feeding
+// the pipeline stops along with the command reading from it.
+type pipeWriter struct {
+	*os.File
+}
+
+func (w pipeWriter) Write(p []byte) (int, error) {
+	n, err := w.File.Write(p)
+	if errors.Is(err, syscall.EPIPE) {
+		panic(subshellExit{128 + int(syscall.SIGPIPE)})
+	}
+	return n, err
+}
+
+// unwrapPipe returns the pipe behind the output of a pipeline stage, for
+// programs to write to directly.
+func unwrapPipe(w io.Writer) io.Writer {
+	if pw, ok := w.(pipeWriter); ok {
+		return pw.File
+	}
+	return w
+}
+
+// runCommand runs a single command of a pipeline.
+func (sh *Shell) runCommand(node Node, s Streams) int {
+	switch node := node.(type) {
+	case *SimpleCommand:
+		return sh.runSimpleCommand(node, s)
+	case *If:
+		return sh.runIf(node, s)
+	case *While:
+		return sh.runLoop(node.Cond, node.Body, true, s)
+	case *Until:
+		return sh.runLoop(node.Cond, node.Body, false, s)
+	case *For:
+		return sh.runFor(node, s)
+	case *ArithFor:
+		return sh.runArithFor(node, s)
+	case *Select:
+		return sh.runSelect(node, s)
+	case *Case:
+		return sh.runCase(node, s)
+	case *Group:
+		return sh.runList(node.Body, s)
+	case *Subshell:
+		c := sh.newSubshell(s)
+		return c.runSubshell(func() int {
+			return c.runList(node.Body, s)
+		})
+	case *Arith:
+		return sh.runArith(node, s)
+	case *Cond:
+		return sh.runCond(node, s)
+	case *Coproc:
+		return sh.runCoproc(node, s)
+	case *FuncDef:
+		sh.funcs[node.Name] = node
+		return 0
+	case *Redirected:
+		return sh.runRedirected(node, s)
+	}
+
+	panic(fmt.Sprintf("unexpected node %T", node))
+}
+
+// runSimpleCommand expands the words of the command and runs it as either a
+// builtin or an external program.
+func (sh *Shell) runSimpleCommand(sc *SimpleCommand, s Streams) int {
+	sh.substStatus = 0
+	sh.lineno = sc.Line
+	words, err := sh.expandCommandWords(sc.Words)
+	if err != nil {
+		fmt.Fprintf(s.Stderr, "%v\n", err)
+		return 1
+	}
+
+	cmd := &Command{Streams: s}
+	for _, r := range sc.Redirects {
+		target, err := sh.expandWord(r.Target)
+		if err != nil {
+			fmt.Fprintf(s.Stderr, "%v\n", err)
+			return 1
+		}
+		r.Target = target
+		cmd.Redirects = append(cmd.Redirects, r)
+	}
+
+	defer sh.addProcessFiles(&cmd.Streams)()
+
+	closeFiles, err := sh.applyRedirects(cmd)
+	if err != nil {
+		fmt.Fprintf(s.Stderr, "%v\n", err)
+		return 1
+	}
+	defer closeFiles()
+
+	// Without a command, the assignments are for the shell itself
+	restore, err := sh.assign(sc.Assigns, len(words) > 0)
+	if err != nil {
+		fmt.Fprintf(s.Stderr, "%v\n", err)
+		return 1
+	}
+	if len(words) == 0 {
+		// The status is that of the last command substitution, if any
+		sh.lastArg = ""
+		return sh.substStatus
+	}
+	defer restore()
+	defer func() { sh.lastArg = words[len(words)-1] }()
+
+	cmd.Exec = words[0]
+	cmd.Args = words[1:]
+	cmd.ownPath = slices.ContainsFunc(sc.Assigns, func(assign string) bool {
+		name, _, _ := cutAssignment(assign)
+		return name == "PATH"
+	})
+
+	status := sh.dispatch(cmd)
+	sh.runPendingTraps()
+	return status
+}
+
+// dispatch runs the command as a function, a builtin or an external program,
+// in that order of precedence.
+func (sh *Shell) dispatch(cmd *Command) int {
+	if fn, ok := sh.funcs[cmd.Exec]; ok {
+		return sh.callFunc(fn, cmd)
+	}
+	if builtin, ok := sh.builtin(cmd.Exec); ok {
+		return builtin(sh, cmd)
+	}
+	return sh.runProgram(cmd)
+}
+
+// Errors from looking up the program a command runs.
+var (
+	errNotFound         = errors.New("not found")
+	errIsDirectory      = errors.New("Is a directory")
+	errPermissionDenied = errors.New("Permission denied")
+)
+
+func (sh *Shell) getExecutablePath(file string) (string, error) {
+	// A name with a slash is a path already, not looked up in PATH
+	if strings.Contains(file, "/") {
+		info, err := os.Stat(sh.path(file))
+		if err == nil && info.IsDir() {
+			return "", fmt.Errorf("%s: %w", file, errIsDirectory)
+		}
+		if err == nil && info.Mode().Perm()&0100 != 0 {
+			return file, nil
+		}
+		if err == nil {
+			return "", fmt.Errorf("%s: %w", file, errPermissionDenied)
+		}
+		return "", fmt.Errorf("%s: %w", file, errNotFound)
+	}
+
+	// Look for executable files with "command" name
+	// Get the path, without which there is nowhere to look
+	path, ok := sh.getVar("PATH")
+	if !ok {
+		return "", fmt.Errorf("%s: %w", file, errNotFound)
+	}
+
+	// Get directory paths
+	dirs := strings.SplitSeq(path, string(os.PathListSeparator))
+	for dir := range dirs {
+		// Read the directory, skipping those that can't be read or aren't
+		// directories at all
+		entries, err := os.ReadDir(sh.path(dir))
+		if err != nil {
+			continue
+		}
+
+		// Loop over directory items
+		for _, entry := range entries {
+			if entry.IsDir() { // Skip if directory, we need file
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to get file info: %v\n", err)
+				continue
+			}
+
+			// Check if the file owner has executable permission on it
+			// and is the file that we are looking for
+			if entry.Name() == file && (info.Mode().Perm()&0100) != 0 {
+				return fmt.Sprintf("%v/%v", dir, file), nil
+			}
+		}
+	}
+
+	// Nor is a directory of the current one a program
+	if info, err := os.Stat(sh.path(file)); err == nil && info.IsDir() {
+		return "", fmt.Errorf("%s: %w", file, errIsDirectory)
+	}
+	return "", fmt.Errorf("%s: %w", file, errNotFound)
+}
+
+// lookupStatus returns the exit status for a failure to find the program a
+// command runs: 126 if there is one that can't be run, 127 otherwise.
+func lookupStatus(err error) int {
+	if errors.Is(err, errIsDirectory) || errors.Is(err, errPermissionDenied) {
+		return 126
+	}
+	return 127
+}
+
+// runProgram runs an external program and returns its exit status. Unless
+// the shell runs as part of a job already, the program is a foreground job
+// of its own.
+func (sh *Shell) runProgram(cmd *Command) int {
+	lookup := sh.hashedPath
+	if cmd.ownPath {
+		lookup = sh.getExecutablePath
+	}
+	path, err := lookup(cmd.Exec)
+	if errors.Is(err, errNotFound) {
+		fmt.Fprintln(cmd.Stderr, cmd.Exec+": command not found")
+		return 127
+	}
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "%v\n", err)
+		return lookupStatus(err)
+	}
+
+	proc := sh.programCmd(cmd, sh.path(path), append([]string{cmd.Exec}, cmd.Args...))
+
+	// With job control, run the program in its own process group, owning
+	// the terminal while it runs, so that keyboard signals reach it and its
+	// children only
+	job := sh.job
+	if job == nil {
+		job = &Job{
+			Command:    strings.Join(append([]string{cmd.Exec}, cmd.Args...), " "),
+			foreground: true,
+			noGroup:    !sh.opts.monitor,
+		}
+	}
+
+	// A non-zero exit status is the program's own business, only report
+	// failures to run it at all
+	p, err := job.start(proc)
+	if errors.Is(err, syscall.ENOEXEC) {
+		// A script the system can't run itself
+		var interp []string
+		if interp, err = interpreterArgs(sh.path(path)); err == nil {
+			proc = sh.programCmd(cmd, interp[0], append(append(interp, path), cmd.Args...))
+			p, err = job.start(proc)
+		}
+	}
+	if errors.Is(err, errBinaryFile) {
+		fmt.Fprintf(cmd.Stderr, "%s: %v\n", cmd.Exec, err)
+		return 126
+	}
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "%v\n", err)
+		return 126
+	}
+	defer proc.Process.Release()
+
+	if sh.job == nil {
+		return waitForeground(job, cmd.Stderr)
+	}
+	return waitProcess(p)
+}
+
+// programCmd returns the process to run the program at path with args, in
+// the shell's directory and environment and with the files of the command.
+func (sh *Shell) programCmd(cmd *Command, path string, args []string) *exec.Cmd {
+	proc := &exec.Cmd{
+		Path: path,
+		Args: args,
+		Env:  sh.environ(),
+		Dir:  sh.dir,
+
+		ExtraFiles: cmd.extraFiles(),
+	}
+	proc.Stdin = cmd.Stdin
+	proc.Stdout = unwrapPipe(cmd.Stdout)
+	proc.Stderr = unwrapPipe(cmd.Stderr)
+	return proc
+}
+
+// errBinaryFile is the error for a file the system can't execute that isn't
+// a script either.
+var errBinaryFile = errors.New("cannot execute binary file")
+
+// binaryMagic are the starts of the executable formats of other systems, or
+// other machines, that don't make sense as scripts.
+var binaryMagic = [][]byte{
+	[]byte("\x7fELF"),
+	{0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf}, // Mach-O
+	{0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe}, // Mach-O universal
+}
+
+// interpreterArgs returns the command line to run the script at path with,
+// when the system can't execute it: the interpreter of its "#!" line along
+// with its argument, if any, or the shell itself without one. Binary files
+// can't be run this way.
+func interpreterArgs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	head := buf[:n]
+
+	if line, ok := bytes.CutPrefix(head, []byte("#!")); ok {
+		line, _, _ = bytes.Cut(line, []byte("\n"))
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s: bad interpreter", path)
+		}
+		// Everything after the interpreter makes a single argument
+		if len(fields) > 1 {
+			fields = []string{fields[0], strings.Join(fields[1:], " ")}
+		}
+		return fields, nil
+	}
+
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, errBinaryFile
+	}
+	for _, magic := range binaryMagic {
+		if bytes.HasPrefix(head, magic) {
+			return nil, errBinaryFile
+		}
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return []string{self}, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPipelineStatus(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"last stage", "false | true; echo $?\ntrue | false; echo $?\n", "0\n1\n"},
+		{"pipefail", "set -o pipefail\nfalse | true; echo $?\nsh -c 'exit 3' | sh -c 'exit 2' | true; echo $?\ntrue | true; echo $?\n", "1\n2\n0\n"},
+		{"pipefail off", "set -o pipefail\nset +o pipefail\nfalse | true; echo $?\n", "0\n"},
+	})
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    int
+	}{
+		{"builtin", "true", 0},
+		{"failing builtin", "false", 1},
+		{"program", "sh -c 'exit 7'", 7},
+		{"not found", "nope 2>/dev/null", 127},
+		{"not executable", "./script.sh 2>/dev/null", 126},
+		{"empty name", "'' 2>/dev/null", 127},
+		{"pipeline", "true | false", 1},
+		{"pipeline's last stage", "false | true", 0},
+		{"negated", "! true", 1},
+		{"function return", "f() { return 5; }; f", 5},
+		{"function's last command", "g() { false; }; g", 1},
+		{"assignment", "x=1", 0},
+		{"assignment with a substitution", "x=$(exit 3)", 3},
+		{"last substitution", "x=$(exit 3) y=$(exit 4)", 4},
+		{"empty command", "$(exit 4)", 4},
+		{"syntax error", "eval 'if' 2>/dev/null", 2},
+		{"group", "{ false; }", 1},
+		{"subshell exit", "(exit 3)", 3},
+		{"failing subshell", "(false)", 1},
+		{"if without a branch", "if false; then false; fi", 0},
+		{"if branch", "if true; then sh -c 'exit 3'; fi", 3},
+		{"loop not run", "while false; do :; done", 0},
+		{"loop body", "for i in 1; do false; done", 1},
+		{"case without a match", "case x in y) false;; esac", 0},
+		{"arithmetic", "(( 0 ))", 1},
+		{"conditional", "[[ a == b ]]", 1},
+		{"background", "false &", 0},
+		{"waited for", "false & wait $!", 1},
+		{"and list", "false && true", 1},
+		{"or list", "false || sh -c 'exit 6'", 6},
+		{"redirection failure", "true <missing 2>/dev/null", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _, _ := runScript(t, tt.command+"\necho $?\n", "")
+			if want := strconv.Itoa(tt.want) + "\n"; out != want {
+				t.Errorf("%s: got $? %q, want %q", tt.command, out, want)
+			}
+		})
+	}
+}
+
+func TestPipelineErrexit(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"and-or lists", "true | false && echo yes || echo no\nfalse | true && echo yes\n", "no\nyes\n"},
+		{"negated", "! false | false; echo $?\n! true | true; echo $?\n", "0\n1\n"},
+		{"if condition", "set -e\nif false | false; then echo t; else echo f; fi\necho after\n", "f\nafter\n"},
+		{"while condition", "set -e\nwhile true | false; do echo loop; done\necho after\n", "after\n"},
+		{"tested with ||", "set -e\nfalse | false || echo handled $?\necho after\n", "handled 1\nafter\n"},
+		{"failing pipeline", "set -e\necho before\ntrue | false\necho not reached\n", "before\n"},
+		{"last stage succeeding", "set -e\nfalse | true\necho after\n", "after\n"},
+		{"pipefail", "set -eo pipefail\nfalse | true\necho not reached\n", ""},
+	})
+
+	_, _, status := runScript(t, "set -e\ntrue | sh -c 'exit 3'\n", "")
+	if status != 3 {
+		t.Errorf("exit status %d, want 3", status)
+	}
+}
+
+func TestBrokenPipe(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"program", "yes | head -n 3\necho $?\n", "y\ny\ny\n0\n"},
+		{"builtin", "while true; do echo y; done | head -n 2\necho $?\n", "y\ny\n0\n"},
+		{"function", "f() { yes; }\nf | head -n 1\n", "y\n"},
+		{"pipefail", "set -o pipefail\nyes | head -n 1\necho $?\n", "y\n141\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, stderr, status := runScript(t, tt.script, "")
+			if out != tt.want || stderr != "" || status != 0 {
+				t.Errorf("got %q, errors %q, status %d, want %q", out, stderr, status, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunScriptFile(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"shebang", "printf '#!/bin/sh -e\\necho \"sh $# $1\"\\n' >s\nchmod +x s\n./s a\n", "sh 1 a\n"},
+		{"gosh shebang", "printf '#!%s\\n# a comment\\necho \"gosh $# $1\" # and another\\n' \"$GOSH\" >s\nchmod +x s\n./s a\n", "gosh 1 a\n"},
+		{"no shebang", "printf 'echo \"plain $# $1 ${0##*/}\"\\nexit 3\\n' >s\nchmod +x s\n./s b\necho $?\n", "plain 1 b s\n3\n"},
+	})
+
+	for name, content := range map[string]string{"ELF": `\177ELF\002\001`, "NUL": `MZ\0\0x`} {
+		t.Run(name, func(t *testing.T) {
+			_, errOut, status := runScript(t, "printf '"+content+"' >bin\nchmod +x bin\n./bin\n", "")
+			if errOut != "./bin: cannot execute binary file\n" || status != 126 {
+				t.Errorf("got %q and status %d", errOut, status)
+			}
+		})
+	}
+}
+
+func TestNoPath(t *testing.T) {
+	out, errOut, status := runScript(t, "unset PATH\nls\necho $?\necho still here\n", "")
+	if out != "127\nstill here\n" || errOut != "ls: command not found\n" || status != 0 {
+		t.Errorf("got %q, %q and status %d", out, errOut, status)
+	}
+}
+
+func TestRunDirectory(t *testing.T) {
+	for _, dir := range []string{"mydir", "./mydir", "mydir/sub"} {
+		t.Run(dir, func(t *testing.T) {
+			out, errOut, _ := runScript(t, "mkdir -p mydir/sub\n"+dir+"\necho $?\n", "")
+			if want := dir + ": Is a directory\n"; out != "126\n" || errOut != want {
+				t.Errorf("got %q and %q, want status 126 and %q", out, errOut, want)
+			}
+		})
+	}
+}
+
+func TestLookupErrors(t *testing.T) {
+	tests := []struct {
+		name, script, err string
+		status            int
+	}{
+		{"not executable", "touch nox\n./nox\n", "./nox: Permission denied\n", 126},
+		{"not executable in PATH", "mkdir bin\ntouch bin/nox\nPATH=$PWD/bin:$PATH\nnox\n", "nox: command not found\n", 127},
+		{"missing command", "nosuchcmd\n", "nosuchcmd: command not found\n", 127},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errOut, _ := runScript(t, tt.script+"echo $?\n", "")
+			if want := strconv.Itoa(tt.status) + "\n"; out != want || errOut != tt.err {
+				t.Errorf("got %q and %q, want %q and %q", out, errOut, want, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// dqEscapable lists the characters a backslash escapes inside double quotes.
+// Before any other character the backslash is kept literally.
+var dqEscapable = []rune{'"', '\\', '$', '`', '\n'}
+
+// unquote performs quote removal on a raw word.
+func unquote(word string) string {
+	var (
+		out             strings.Builder
+		seenSingleQuote bool
+		seenDoubleQuote bool
+	)
+
+	runes := []rune(word)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case seenSingleQuote:
+			if r == '\'' {
+				seenSingleQuote = false
+			} else {
+				out.WriteRune(r)
+			}
+
+		case r == '\\' && i+1 < len(runes):
+			if seenDoubleQuote && !slices.Contains(dqEscapable, runes[i+1]) {
+				out.WriteRune(r)
+			}
+			i++
+			out.WriteRune(runes[i])
+
+		case r == '"':
+			seenDoubleQuote = !seenDoubleQuote
+
+		case r == '\'' && !seenDoubleQuote:
+			seenSingleQuote = true
+
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	return out.String()
+}
+
+// fragment is a piece of an expanded word, remembering whether it came from
+// quoted text, and whether it's the result of an expansion, which is subject
+// to field splitting unless quoted.
+type fragment struct {
+	text     string
+	quoted   bool
+	expanded bool
+	fieldEnd bool // ends the field, between the parameters of "$@"
+}
+
+// expandWords expands raw words into fields, for the arguments of a command
+// or the list of a for loop. Beyond the expansions of expandWord, the words
+// go through brace expansion, then the unquoted results of the expansions are
+// split into fields, and pathname expansion replaces the fields with glob
+// patterns by the file names they match.
+func (sh *Shell) expandWords(words []string) ([]string, error) {
+	var fields []string
+	for _, word := range words {
+		for _, word := range expandBraces(word) {
+			frags, err := sh.expandFragments(word)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, field := range sh.splitFields(frags) {
+				matches, err := sh.globField(field)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, matches...)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// splitFields splits the unquoted results of expansions into fields at the
+// characters of $IFS, space, tab and newline if it's unset. Runs of IFS
+// whitespace count as one separator, while each other IFS character
+// separates a field of its own, empty if need be.
+func (sh *Shell) splitFields(frags []fragment) [][]fragment {
+	ifs, ok := sh.getVar("IFS")
+	if !ok {
+		ifs = " \t\n"
+	}
+
+	var (
+		fields [][]fragment
+		field  []fragment
+		inside bool // whether a field is in progress
+		spaced bool // whether IFS whitespace just ended a field
+	)
+
+	for _, frag := range frags {
+		if frag.fieldEnd {
+			if inside {
+				fields = append(fields, field)
+			}
+			field, inside, spaced = nil, false, false
+			continue
+		}
+		if frag.quoted || !frag.expanded || ifs == "" {
+			field = append(field, frag)
+			inside, spaced = true, false
+			continue
+		}
+
+		start := 0
+		for i, r := range frag.text {
+			if !strings.ContainsRune(ifs, r) {
+				continue
+			}
+			if i > start {
+				field = append(field, fragment{text: frag.text[start:i], expanded: true})
+				inside = true
+			}
+			start = i + len(string(r))
+
+			isSpace := strings.ContainsRune(" \t\n", r)
+			if inside || (!isSpace && !spaced) {
+				fields = append(fields, field)
+				field, inside = nil, false
+				spaced = isSpace
+			} else if !isSpace {
+				spaced = false
+			}
+		}
+		if start < len(frag.text) {
+			field = append(field, fragment{text: frag.text[start:], expanded: true})
+			inside, spaced = true, false
+		}
+	}
+	if inside {
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// expandCommandWords expands the words of a simple command. The arguments
+// of a declaration builtin that are assignments are expanded like
+// assignments instead, without splitting or globbing, and those assigning
+// arrays are left for the builtin to expand.
+func (sh *Shell) expandCommandWords(words []string) ([]string, error) {
+	if len(words) == 0 || !slices.Contains(declarationBuiltins, words[0]) {
+		return sh.expandWords(words)
+	}
+
+	fields := []string{words[0]}
+	for _, word := range words[1:] {
+		if !isAssignment(word) {
+			expanded, err := sh.expandWords([]string{word})
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, expanded...)
+			continue
+		}
+
+		name, raw, _ := strings.Cut(word, "=")
+		if strings.HasPrefix(raw, "(") {
+			fields = append(fields, word)
+			continue
+		}
+		value, err := sh.expandAssignment(raw)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, name+"="+value)
+	}
+	return fields, nil
+}
+
+// expandWord performs parameter and arithmetic expansion, command
+// substitution and quote removal on a raw word.
+func (sh *Shell) expandWord(word string) (string, error) {
+	frags, err := sh.expandFragments(word)
+	if err != nil {
+		return "", err
+	}
+	return joinFragments(frags), nil
+}
+
+// expandAssignment expands the value of an assignment like expandWord, and
+// the tilde prefixes after its unquoted colons as well, for lists of
+// directories like PATH=~/bin:~/go/bin.
+func (sh *Shell) expandAssignment(word string) (string, error) {
+	frags, err := sh.expandWordFragments(word, true)
+	if err != nil {
+		return "", err
+	}
+	return joinFragments(frags), nil
+}
+
+func joinFragments(frags []fragment) string {
+	var out strings.Builder
+	for _, frag := range frags {
+		if frag.fieldEnd {
+			out.WriteByte(' ')
+		}
+		out.WriteString(frag.text)
+	}
+	return out.String()
+}
+
+// expandFragments expands the parameters, arithmetic expressions and command
+// substitutions in a raw word, splitting the result into quoted and unquoted
+// fragments.
+func (sh *Shell) expandFragments(word string) ([]fragment, error) {
+	return sh.expandWordFragments(word, false)
+}
+
+// expandWordFragments is expandFragments, for the value of an assignment if
+// assignment is set.
+func (sh *Shell) expandWordFragments(word string, assignment bool) ([]fragment, error) {
+	var (
+		frags           []fragment
+		cur             strings.Builder
+		seenSingleQuote bool
+		seenDoubleQuote bool
+	)
+
+	flush := func(quoted bool) {
+		if cur.Len() > 0 {
+			frags = append(frags, fragment{text: cur.String(), quoted: quoted})
+			cur = strings.Builder{}
+		}
+	}
+
+	runes := []rune(word)
+	start := 0
+	if dir, n, ok := sh.expandTilde(runes, assignment); ok {
+		frags = append(frags, fragment{text: dir, quoted: true})
+		start = n
+	}
+
+	for i := start; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case seenSingleQuote:
+			if r == '\'' {
+				seenSingleQuote = false
+				flush(true)
+			} else {
+				cur.WriteRune(r)
+			}
+
+		case r == '\\' && i+1 < len(runes):
+			if seenDoubleQuote && !slices.Contains(dqEscapable, runes[i+1]) {
+				cur.WriteRune(r)
+				i++
+				cur.WriteRune(runes[i])
+				continue
+			}
+			flush(seenDoubleQuote)
+			i++
+			frags = append(frags, fragment{text: string(runes[i]), quoted: true})
+
+		case r == ':' && assignment && !seenDoubleQuote:
+			cur.WriteRune(r)
+			if dir, n, ok := sh.expandTilde(runes[i+1:], true); ok {
+				flush(false)
+				frags = append(frags, fragment{text: dir, quoted: true})
+				i += n
+			}
+
+		case r == '"':
+			flush(seenDoubleQuote)
+			seenDoubleQuote = !seenDoubleQuote
+
+			// Quotes make a field even with nothing in between
+			if seenDoubleQuote {
+				frags = append(frags, fragment{quoted: true})
+			}
+
+		case r == '\'' && !seenDoubleQuote:
+			flush(false)
+			seenSingleQuote = true
+			frags = append(frags, fragment{quoted: true})
+
+		case r == '$' && isArith(runes, i):
+			flush(seenDoubleQuote)
+			end := matchBracket(runes, i+1)
+			expr, err := sh.expandWord(string(runes[i+3 : end-1]))
+			if err != nil {
+				return nil, err
+			}
+			n, err := sh.evalArith(expr)
+			if err != nil {
+				return nil, err
+			}
+			frags = append(frags, fragment{text: strconv.FormatInt(n, 10), quoted: seenDoubleQuote, expanded: true})
+			i = end
+
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '(':
+			flush(seenDoubleQuote)
+			end := matchBracket(runes, i+1)
+			out, err := sh.substitute(string(runes[i+2 : end]))
+			if err != nil {
+				return nil, err
+			}
+			frags = append(frags, fragment{text: out, quoted: seenDoubleQuote, expanded: true})
+			i = end
+
+		case (r == '<' || r == '>') && !seenDoubleQuote && i+1 < len(runes) && runes[i+1] == '(':
+			flush(false)
+			end := matchBracket(runes, i+1)
+			f, err := sh.substituteProcess(string(runes[i+2:end]), r == '>')
+			if err != nil {
+				return nil, err
+			}
+			frags = append(frags, fragment{text: "/dev/fd/" + strconv.Itoa(int(f.Fd())), quoted: true, expanded: true})
+			i = end
+
+		case r == '$':
+			name, end := readParam(runes, i)
+			if end == i {
+				cur.WriteRune(r)
+				continue
+			}
+			flush(seenDoubleQuote)
+			i = end - 1
+
+			// "$@" expands to a field per positional parameter, and to no
+			// field at all without any. Unquoted, $@ and $* both expand to
+			// a field per parameter, each split in turn, while "$*" joins
+			// them into one
+			params, kind, err := sh.listParam(name)
+			if err != nil {
+				return nil, err
+			}
+			if kind == '@' || (kind == '*' && !seenDoubleQuote) {
+				if n := len(frags); len(params) == 0 && n > 0 && frags[n-1] == (fragment{quoted: true}) {
+					frags = frags[:n-1]
+				}
+				for j, param := range params {
+					if j > 0 {
+						frags = append(frags, fragment{fieldEnd: true})
+					}
+					frags = append(frags, fragment{text: param, quoted: seenDoubleQuote, expanded: true})
+				}
+				continue
+			}
+			if kind == '*' {
+				frags = append(frags, fragment{text: strings.Join(params, sh.ifsSeparator()), quoted: true, expanded: true})
+				continue
+			}
+
+			if !isPlainParam(name) {
+				value, err := sh.expandParam(name)
+				if err != nil {
+					return nil, err
+				}
+				frags = append(frags, fragment{text: value, quoted: seenDoubleQuote, expanded: true})
+				continue
+			}
+
+			value, _ := sh.getVar(name)
+			frags = append(frags, fragment{text: value, quoted: seenDoubleQuote, expanded: true})
+
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush(seenDoubleQuote || seenSingleQuote)
+
+	return frags, nil
+}
+
+// expandTilde expands the tilde prefix a word starts with, up to its first
+// slash, returning the directory along with the length of the prefix: "~" is
+// $HOME, "~+" is $PWD, "~-" is $OLDPWD and "~user" the home directory of
+// the user. In an assignment, a colon ends the prefix too. A prefix that's
+// quoted or that can't be expanded is left alone.
+func (sh *Shell) expandTilde(runes []rune, assignment bool) (string, int, bool) {
+	if len(runes) == 0 || runes[0] != '~' {
+		return "", 0, false
+	}
+	n := slices.IndexFunc(runes, func(r rune) bool { return r == '/' || (r == ':' && assignment) })
+	if n < 0 {
+		n = len(runes)
+	}
+	prefix := string(runes[1:n])
+	if strings.ContainsAny(prefix, "'\"\\$`") {
+		return "", 0, false
+	}
+
+	var (
+		dir string
+		ok  bool
+	)
+	switch prefix {
+	case "":
+		dir, ok = sh.getVar("HOME")
+	case "+":
+		dir, ok = sh.getVar("PWD")
+	case "-":
+		dir, ok = sh.getVar("OLDPWD")
+	default:
+		if u, err := user.Lookup(prefix); err == nil {
+			dir, ok = u.HomeDir, true
+		}
+	}
+	return dir, n, ok
+}
+
+// isArith reports whether the "$" at runes[i] starts an arithmetic expansion,
+// "$((...))".
+func isArith(runes []rune, i int) bool {
+	if i+2 >= len(runes) || runes[i+1] != '(' || runes[i+2] != '(' {
+		return false
+	}
+	end := matchBracket(runes, i+1)
+	return end > 0 && matchBracket(runes, i+2) == end-1
+}
+
+// readParam reads the parameter referenced by the "$" at runes[i], either as
+// $NAME, ${NAME} or one of the special parameters like $?. It returns the
+// parameter name and the index right after the reference, which is i if
+// there is no parameter to expand.
+func readParam(runes []rune, i int) (string, int) {
+	j := i + 1
+	if j >= len(runes) {
+		return "", i
+	}
+
+	switch r := runes[j]; {
+	case r == '{':
+		end := matchBracket(runes, j)
+		if end < 0 {
+			return "", i
+		}
+		return string(runes[j+1 : end]), end + 1
+
+	case isSpecialParam(r):
+		return string(r), j + 1
+
+	case isNameStart(r):
+		for j < len(runes) && isNameChar(runes[j]) {
+			j++
+		}
+		return string(runes[i+1 : j]), j
+	}
+
+	return "", i
+}
+
+// ifsSeparator returns the separator joining the positional parameters in
+// "$*": the first character of $IFS, a space if it's unset, or nothing if
+// it's empty.
+func (sh *Shell) ifsSeparator() string {
+	ifs, ok := sh.getVar("IFS")
+	if !ok {
+		return " "
+	}
+	for _, r := range ifs {
+		return string(r)
+	}
+	return ""
+}
+
+func isSpecialParam(r rune) bool {
+	return strings.ContainsRune("?$!#@*0123456789", r)
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || (r >= '0' && r <= '9')
+}
+
+// getVar returns the value of a parameter: one of the special parameters,
+// or a shell variable.
+func (sh *Shell) getVar(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(sh.status), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "!":
+		if sh.lastBgPid == 0 {
+			return "", false
+		}
+		return strconv.Itoa(sh.lastBgPid), true
+	case "0":
+		return sh.name, true
+	case "_":
+		return sh.lastArg, true
+	case "#":
+		return strconv.Itoa(len(sh.args)), true
+	case "@":
+		return strings.Join(sh.args, " "), len(sh.args) > 0
+	case "*":
+		return strings.Join(sh.args, sh.ifsSeparator()), len(sh.args) > 0
+	}
+
+	// Positional parameters
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		if n > len(sh.args) {
+			return "", false
+		}
+		return sh.args[n-1], true
+	}
+
+	if array, sub, ok := cutSubscript(name); ok {
+		return sh.getElement(array, sub)
+	}
+	if value, ok := sh.getDynamicVar(name); ok {
+		return value, true
+	}
+	if v, ok := sh.vars[name]; ok {
+		// An array stands for its element 0
+		if v.array != nil {
+			return v.array.get(0)
+		}
+		return v.value, true
+	}
+	return "", false
+}
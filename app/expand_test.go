@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestPositionalJoin(t *testing.T) {
+	args := "set -- \"a b\" c \"\" d\n"
+	runScriptTests(t, []scriptTest{
+		{"quoted star", args + "printf '[%s]' \"$*\"\n", "[a b c  d]"},
+		{"quoted at", args + "printf '[%s]' \"$@\"\n", "[a b][c][][d]"},
+		{"unquoted star", args + "printf '[%s]' $*\n", "[a][b][c][d]"},
+		{"unquoted at", args + "printf '[%s]' $@\n", "[a][b][c][d]"},
+		{"braces", args + "printf '[%s]' \"${@}\" \"${*}\"\n", "[a b][c][][d][a b c  d]"},
+		{"IFS colon", args + "IFS=:\nprintf '[%s]' \"$*\"\n", "[a b:c::d]"},
+		{"IFS empty", args + "IFS=\nprintf '[%s]' \"$*\"\n", "[a bcd]"},
+		{"IFS unset", args + "unset IFS\nprintf '[%s]' \"$*\"\n", "[a b c  d]"},
+		{"no parameters", "printf '[%s]' \"$@\"\nprintf '[%s]' x\"$@\"y\n", "[][xy]"},
+		{"glued to words", "set -- a b\nprintf '[%s]' x\"$@\"y\n", "[xa][by]"},
+	})
+}
+
+func TestFieldSplitting(t *testing.T) {
+	count := "; echo $#; printf '[%s]' \"$@\"; echo\n"
+	runScriptTests(t, []scriptTest{
+		{"spaces", "x=\"a b  c\"\nset -- $x" + count, "3\n[a][b][c]\n"},
+		{"blanks around", "x=\" a\tb\nc \"\nset -- $x" + count, "3\n[a][b][c]\n"},
+		{"quoted", "x=\"a b\"\nset -- \"$x\"" + count, "1\n[a b]\n"},
+		{"literal words", "set -- 'a b' a\\ b" + count, "2\n[a b][a b]\n"},
+		{"command substitution", "set -- $(echo \"1 2\n3\")" + count, "3\n[1][2][3]\n"},
+		{"custom IFS", "IFS=:\nx=a:b::c\nset -- $x" + count, "4\n[a][b][][c]\n"},
+		{"custom IFS literal", "IFS=:\nset -- a:b" + count, "1\n[a:b]\n"},
+		{"IFS blanks and colons", "IFS=': '\nx='a : b'\nset -- $x" + count, "2\n[a][b]\n"},
+		{"empty IFS", "IFS=\nx='a b'\nset -- $x" + count, "1\n[a b]\n"},
+		{"empty value", "x=\nset -- $x" + count, "0\n[]\n"},
+	})
+}
+
+func TestTilde(t *testing.T) {
+	home := "HOME=/h\n"
+	dirs := "mkdir one two\ncd one\ncd ../two\n"
+	runScriptTests(t, []scriptTest{
+		{"home", home + "echo ~ ~/a a~ \"~\" '~' \\~\n", "/h /h/a a~ ~ ~ ~\n"},
+		{"after colons in assignments", home + "P=~/bin:~/go/bin:~\necho $P\n", "/h/bin:/h/go/bin:/h\n"},
+		{"quoted after colons", home + "P=/a:~:\"~\":'~'/x:\\~\necho $P\n", "/a:/h:~:~/x:~\n"},
+		{"inside words", home + "P=a~:b~\necho $P\n", "a~:b~\n"},
+		{"declare", home + "declare D=~/x:~/y\necho $D\n", "/h/x:/h/y\n"},
+		{"not in arguments", home + "echo a=b:~/c\n", "a=b:~/c\n"},
+		{"PWD", dirs + "echo ~+ ~+/f | sed \"s|$HOME|H|g\"\n[ ~+ = \"$PWD\" ] && echo same\n", "H/two H/two/f\nsame\n"},
+		{"OLDPWD", dirs + "[ ~- = \"$OLDPWD\" ] && echo same\necho ~- ~-/f | sed \"s|$HOME|H|g\"\n", "same\nH/one H/one/f\n"},
+		{"PWD and OLDPWD after colons", dirs + "Z=~+:~-\necho ${Z//$PWD/PWD} | sed 's|:.*/|:|'\n", "PWD:one\n"},
+	})
+}
+
+func TestProcessSubstitution(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"input", "cat <(echo hi)\n", "hi\n"},
+		{"path", "echo <(true) | grep -c '^/dev/fd/[0-9]*$'\n", "1\n"},
+		{"two of them", "printf 'b\\na\\n' >x\nprintf 'a\\nb\\n' >y\ndiff <(sort x) <(sort y) && echo same\n", "same\n"},
+		{"redirected from", "head -n 1 < <(printf 'one\\ntwo\\n')\n", "one\n"},
+		{"output", "echo one > >(tr a-z A-Z >out.txt)\nsleep 0.2\ncat out.txt\n", "ONE\n"},
+		{"closed after the command", "fds='sleep 0.1; ls /proc/$PPID/fd'\nsh -c \"$fds\" >before\ncat <(echo hi) >/dev/null\nsh -c \"$fds\" >after\ncmp -s before after && echo closed\n", "closed\n"},
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// callFrame is an entry of the call stack: a function called, or "source" for
+// a file sourced, with the line and file it was called from.
+type callFrame struct {
+	name string
+	line int
+	file string
+}
+
+// pushFrame enters a function or sourced file in the call stack, returning
+// the function that leaves it.
+func (sh *Shell) pushFrame(name string) func() {
+	sh.frames = append(sh.frames, callFrame{name: name, line: sh.lineno, file: sh.file})
+	return func() { sh.frames = sh.frames[:len(sh.frames)-1] }
+}
+
+// callFunc runs the body of a function, with the arguments of the command as
+// the positional parameters, and returns its status.
+func (sh *Shell) callFunc(fn *FuncDef, cmd *Command) int {
+	args, loops := sh.args, sh.loops
+	sh.args, sh.loops = cmd.Args, 0
+	sh.funcDepth++
+	sh.locals = append(sh.locals, make(map[string]*variable))
+	defer sh.pushFrame(fn.Name)()
+	defer func() {
+		sh.args, sh.loops = args, loops
+		sh.funcDepth--
+		sh.restoreLocals()
+	}()
+
+	status := sh.runCommand(fn.Body, cmd.Streams)
+	if sh.returning {
+		sh.returning = false
+		status = sh.returnStatus
+	}
+	return status
+}
+
+func (sh *Shell) executeReturnCmd(cmd *Command) int {
+	if sh.funcDepth == 0 && sh.sourceDepth == 0 {
+		fmt.Fprintln(cmd.Stderr, "return: can only `return' from a function or sourced script")
+		return 1
+	}
+
+	status := sh.status
+	if len(cmd.Args) > 0 {
+		n, err := strconv.Atoi(cmd.Args[0])
+		if err != nil {
+			fmt.Fprintf(cmd.Stderr, "return: %s: numeric argument required\n", cmd.Args[0])
+			n = 2
+		}
+		status = n & 0xff
+	}
+
+	sh.returning = true
+	sh.returnStatus = status
+	return status
+}
+
+// executeCallerCmd prints the line and file the running function or sourced
+// file was called from. With a number N, it prints the line, the calling
+// function and the file of frame N of the call stack instead, counting up
+// from the current call.
+func (sh *Shell) executeCallerCmd(cmd *Command) int {
+	n := 0
+	if len(cmd.Args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(cmd.Args[0]); err != nil || n < 0 {
+			fmt.Fprintf(cmd.Stderr, "caller: %s: invalid number\n", cmd.Args[0])
+			fmt.Fprintln(cmd.Stderr, "caller: usage: caller [expr]")
+			return 2
+		}
+	}
+
+	i := len(sh.frames) - 1 - n
+	if i < 0 {
+		return 1
+	}
+	frame := sh.frames[i]
+	file := frame.file
+	if file == "" {
+		file = "NULL"
+	}
+	if len(cmd.Args) == 0 {
+		fmt.Fprintf(cmd.Stdout, "%d %s\n", frame.line, file)
+		return 0
+	}
+
+	// The caller is the function of the frame below, if any
+	name := "main"
+	if i > 0 {
+		name = sh.frames[i-1].name
+	}
+	fmt.Fprintf(cmd.Stdout, "%d %s %s\n", frame.line, name, file)
+	return 0
+}
+
+// restoreLocals pops the frame of the function returning, giving its local
+// variables back their previous bindings.
+func (sh *Shell) restoreLocals() {
+	frame := sh.locals[len(sh.locals)-1]
+	sh.locals = sh.locals[:len(sh.locals)-1]
+
+	for name, v := range frame {
+		if v == nil {
+			delete(sh.vars, name)
+		} else {
+			sh.vars[name] = v
+		}
+	}
+}
+
+func (sh *Shell) executeLocalCmd(cmd *Command) int {
+	if len(sh.locals) == 0 {
+		fmt.Fprintln(cmd.Stderr, "local: can only be used in a function")
+		return 1
+	}
+	return sh.declare(cmd, true)
+}
+
+// makeLocal makes a variable local to the function running, keeping the
+// binding from before the function for when it returns. The variable starts
+// out unset.
+func (sh *Shell) makeLocal(name string) error {
+	if err := sh.checkWritable(name); err != nil {
+		return err
+	}
+	frame := sh.locals[len(sh.locals)-1]
+	if _, ok := frame[name]; !ok {
+		frame[name] = sh.vars[name]
+		delete(sh.vars, name)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestFunctions(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"arguments", "greet() { echo \"hi $1\"; echo $# \"$@\"; }\ngreet world and more\n", "hi world\n3 world and more\n"},
+		{"parameters restored", "f() { echo in $1; }\nset -- a b\nf x\necho out $1 $#\n", "in x\nout a 2\n"},
+		{"shadows programs", "ls() { echo not ls; }\nls /\n", "not ls\n"},
+		{"status", "f() { false; }\nf; echo $?\n", "1\n"},
+		{"return", "f() { return 3; echo never; }\nf; echo $?\n", "3\n"},
+	})
+}
+
+func TestLocal(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"doesn't leak", "f() { local tmp=inner; echo $tmp; }\nf; echo \"[$tmp]\"\n", "inner\n[]\n"},
+		{"restored", "x=outer\nf() { local x=inner; echo $x; }\nf; echo $x\n", "inner\nouter\n"},
+		{"seen by callees", "g() { echo $x; }\nf() { local x=inner; g; }\nf\n", "inner\n"},
+		{"outside a function", "local x=1 2>&1; echo $?\n", "local: can only be used in a function\n1\n"},
+	})
+}
+
+func TestCaller(t *testing.T) {
+	strip := " | sed \"s#$HOME/##\""
+	runScriptTests(t, []scriptTest{
+		{"outside functions", "caller; echo $?\ncaller 0; echo $?\n", "1\n1\n"},
+		{"nested", "inner() {\n  caller" + strip + "\n  caller 0" + strip + "\n  caller 1" + strip + "\n  caller 2; echo $?\n}\nouter() { inner; }\nouter\n", "7 script.sh\n7 outer script.sh\n8 main script.sh\n1\n"},
+		{"sourced", "printf 'f() { caller 0; }\\nf\\ncaller 0\\n' >lib.sh\n. ./lib.sh" + strip + "\n", "2 source ./lib.sh\n2 main script.sh\n"},
+		{"bad level", "f() { caller x; echo $?; }\nf 2>/dev/null\n", "2\n"},
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// getoptsState remembers how far getopts got within a group of options,
+// like "-abc", between its calls.
+type getoptsState struct {
+	optind int // value of $OPTIND at the end of the last call
+	pos    int // index of the next option in the current argument
+}
+
+func (sh *Shell) executeGetoptsCmd(cmd *Command) int {
+	if len(cmd.Args) < 2 {
+		fmt.Fprintln(cmd.Stderr, "getopts: usage: getopts optstring name [arg ...]")
+		return 2
+	}
+	optstring, name := cmd.Args[0], cmd.Args[1]
+	if !isName(name) {
+		fmt.Fprintf(cmd.Stderr, "getopts: `%s': not a valid identifier\n", name)
+		return 1
+	}
+
+	args := sh.args
+	if len(cmd.Args) > 2 {
+		args = cmd.Args[2:]
+	}
+
+	// A leading ":" has errors reported through the variables only
+	silent := strings.HasPrefix(optstring, ":")
+	optstring = strings.TrimPrefix(optstring, ":")
+
+	value, _ := sh.getVar("OPTIND")
+	optind, err := strconv.Atoi(value)
+	if err != nil || optind < 1 {
+		optind = 1
+	}
+	if optind != sh.getopts.optind || sh.getopts.pos == 0 {
+		// OPTIND was reset, or the last option ended its argument
+		sh.getopts.pos = 1
+	}
+
+	done := func() int {
+		sh.setVar(name, "?")
+		sh.setOptind(optind, 0)
+		return 1
+	}
+
+	if optind > len(args) {
+		return done()
+	}
+	arg := args[optind-1]
+	if sh.getopts.pos == 1 {
+		if arg == "--" {
+			optind++
+			return done()
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			return done()
+		}
+	}
+
+	opt := arg[sh.getopts.pos]
+	pos := sh.getopts.pos + 1
+	if pos >= len(arg) {
+		optind, pos = optind+1, 0
+	}
+
+	i := strings.IndexByte(optstring, opt)
+	if i < 0 || opt == ':' {
+		if silent {
+			sh.setVar("OPTARG", string(opt))
+		} else {
+			fmt.Fprintf(cmd.Stderr, "%s: illegal option -- %c\n", sh.name, opt)
+			delete(sh.vars, "OPTARG")
+		}
+		sh.setVar(name, "?")
+		sh.setOptind(optind, pos)
+		return 0
+	}
+
+	if i+1 < len(optstring) && optstring[i+1] == ':' {
+		// The argument is either the rest of this one, or the next one
+		switch {
+		case pos > 0:
+			sh.setVar("OPTARG", arg[pos:])
+			optind, pos = optind+1, 0
+		case optind <= len(args):
+			sh.setVar("OPTARG", args[optind-1])
+			optind++
+		default:
+			if silent {
+				sh.setVar(name, ":")
+				sh.setVar("OPTARG", string(opt))
+			} else {
+				fmt.Fprintf(cmd.Stderr, "%s: option requires an argument -- %c\n", sh.name, opt)
+				sh.setVar(name, "?")
+				delete(sh.vars, "OPTARG")
+			}
+			sh.setOptind(optind, pos)
+			return 0
+		}
+	} else {
+		delete(sh.vars, "OPTARG")
+	}
+
+	sh.setVar(name, string(opt))
+	sh.setOptind(optind, pos)
+	return 0
+}
+
+// setOptind updates $OPTIND, remembering the position within the argument
+// for the next call.
+func (sh *Shell) setOptind(optind, pos int) {
+	sh.setVar("OPTIND", strconv.Itoa(optind))
+	sh.getopts = getoptsState{optind: optind, pos: pos}
+}
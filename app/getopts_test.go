@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestGetopts(t *testing.T) {
+	loop := "while getopts \"ab:c\" opt; do echo \"$opt ${OPTARG-unset}\"; done; echo $OPTIND\n"
+	runScriptTests(t, []scriptTest{
+		{"options", "set -- -b value -a rest\n" + loop, "b value\na unset\n4\n"},
+		{"grouped", "set -- -ac -bvalue\n" + loop, "a unset\nc unset\nb value\n3\n"},
+		{"end of options", "set -- -a -- -c\n" + loop, "a unset\n3\n"},
+		{"unknown option", "set -- -x\n" + loop + "", "? unset\n2\n"},
+		{"missing argument", "set -- -b\n" + loop, "? unset\n2\n"},
+		{"silent", "set -- -x -b\nwhile getopts \":ab:\" opt; do echo \"$opt $OPTARG\"; done\n", "? x\n: b\n"},
+	})
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// globPattern returns the glob pattern for a field, with the glob characters
+// of its quoted fragments escaped, and whether it has any unquoted ones.
+func globPattern(field []fragment) (string, bool) {
+	var (
+		pattern strings.Builder
+		isGlob  bool
+	)
+	for _, frag := range field {
+		if frag.quoted {
+			for _, r := range frag.text {
+				if strings.ContainsRune(`*?[\`, r) {
+					pattern.WriteRune('\\')
+				}
+				pattern.WriteRune(r)
+			}
+			continue
+		}
+		pattern.WriteString(frag.text)
+		isGlob = isGlob || strings.ContainsAny(frag.text, "*?[")
+	}
+	return pattern.String(), isGlob
+}
+
+// globField performs pathname expansion on a field, returning the sorted
+// file names matched by its unquoted glob characters. Names starting with "."
+// are only matched by a pattern starting with "." too, unless the dotglob
+// option is set. A field without glob characters is kept as it is, as is one
+// without matches unless the nullglob or failglob options say to drop it or
+// fail.
+func (sh *Shell) globField(field []fragment) ([]string, error) {
+	if pattern, isGlob := globPattern(field); isGlob {
+		matches := sh.glob(pattern)
+		switch {
+		case len(matches) > 0:
+			return matches, nil
+		case sh.opts.failglob:
+			return nil, fmt.Errorf("no match: %s", pattern)
+		case sh.opts.nullglob:
+			return nil, nil
+		}
+	}
+
+	var text strings.Builder
+	for _, frag := range field {
+		text.WriteString(frag.text)
+	}
+	return []string{text.String()}, nil
+}
+
+// glob returns the sorted file names matching a pattern, matching it one
+// component at a time against the directories it goes through. With the
+// globstar option, a "**" component matches any number of directories, and
+// with the nocaseglob option, letters match regardless of case.
+func (sh *Shell) glob(pattern string) []string {
+	g := &globber{
+		dotglob:  sh.opts.dotglob,
+		globstar: sh.opts.globstar,
+		nocase:   sh.opts.nocaseglob,
+		path:     sh.path,
+		seen:     make(map[string]bool),
+	}
+	dir, pats := "", strings.Split(pattern, "/")
+	if pats[0] == "" {
+		dir, pats = "/", pats[1:]
+	}
+	g.expand(dir, pats)
+	slices.Sort(g.matches)
+	return g.matches
+}
+
+// globber matches a pattern against the file tree one component at a time.
+type globber struct {
+	dotglob  bool
+	globstar bool                // whether "**" matches any number of directories
+	nocase   bool                // whether letters match regardless of case
+	path     func(string) string // resolves a path against the working directory
+	seen     map[string]bool     // matches so far, which "**" can reach twice
+	matches  []string
+}
+
+// expand adds the paths under dir matching the remaining components of the
+// pattern.
+func (g *globber) expand(dir string, pats []string) {
+	if len(pats) == 0 {
+		if dir != "" && !g.seen[dir] {
+			g.seen[dir] = true
+			g.matches = append(g.matches, dir)
+		}
+		return
+	}
+
+	switch pat := pats[0]; {
+	case pat == "**" && g.globstar:
+		// Any number of directories, down to those in dir itself. Symbolic
+		// links aren't followed, so that a loop can't go on forever.
+		root := dir
+		if root == "" {
+			root = "."
+		}
+		fs.WalkDir(os.DirFS(g.path(root)), ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if path == "." {
+				path = dir
+			} else {
+				path = joinPath(dir, path)
+			}
+
+			hidden := path != dir && strings.HasPrefix(d.Name(), ".") && !g.dotglob
+			switch {
+			case hidden && d.IsDir():
+				return fs.SkipDir
+			case hidden:
+			case !d.IsDir():
+				// A last "**" matches files too, and a trailing slash the
+				// links to directories
+				if len(pats) == 1 || (len(pats) == 2 && pats[1] == "") {
+					g.expand(path, pats[1:])
+				}
+			case path == dir && path != "" && len(pats) == 1:
+				// A last "**" matches the directory it's in as "dir/"
+				g.expand(strings.TrimSuffix(dir, "/")+"/", nil)
+			default:
+				g.expand(path, pats[1:])
+			}
+			return nil
+		})
+
+	case pat == "":
+		// A trailing slash only matches directories
+		if info, err := os.Stat(g.path(dir)); err == nil && info.IsDir() {
+			g.expand(dir+"/", pats[1:])
+		}
+
+	case !hasGlobChars(pat):
+		// A plain name only has to exist, in a directory that may not be
+		// readable
+		path := joinPath(dir, unescapePattern(pat))
+		if _, err := os.Lstat(g.path(path)); err == nil {
+			g.expand(path, pats[1:])
+		}
+
+	default:
+		root := dir
+		if root == "" {
+			root = "."
+		}
+		entries, _ := os.ReadDir(g.path(root))
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") && !strings.HasPrefix(pat, ".") && !strings.HasPrefix(pat, `\.`) && !g.dotglob {
+				continue
+			}
+			if g.match(pat, name) {
+				g.expand(joinPath(dir, name), pats[1:])
+			}
+		}
+	}
+}
+
+// match reports whether a file name matches a component of the pattern.
+func (g *globber) match(pat, name string) bool {
+	if g.nocase {
+		return matchPatternFold(pat, name)
+	}
+	return matchPattern(pat, name)
+}
+
+// joinPath adds a name to a directory of a glob match, leaving the path as
+// the pattern spelled it rather than cleaning it up.
+func joinPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	if strings.HasSuffix(dir, "/") {
+		return dir + name
+	}
+	return dir + "/" + name
+}
+
+// hasGlobChars reports whether a pattern has any unescaped glob characters.
+func hasGlobChars(pat string) bool {
+	for i := 0; i < len(pat); i++ {
+		switch pat[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// unescapePattern returns the text a pattern without glob characters
+// matches, with its backslashes removed.
+func unescapePattern(pat string) string {
+	var b strings.Builder
+	for i := 0; i < len(pat); i++ {
+		if pat[i] == '\\' && i+1 < len(pat) {
+			i++
+		}
+		b.WriteByte(pat[i])
+	}
+	return b.String()
+}
+
+// matchPattern reports whether s matches the glob pattern as a whole. Unlike
+// in pathname expansion, "*" and "?" match "/" too, as in case patterns.
+func matchPattern(pattern, s string) bool {
+	return matchRunes([]rune(pattern), []rune(s), false)
+}
+
+// matchPatternFold is like matchPattern, but letters match regardless of
+// case.
+func matchPatternFold(pattern, s string) bool {
+	return matchRunes([]rune(pattern), []rune(s), true)
+}
+
+func matchRunes(p, s []rune, fold bool) bool {
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 0 && p[0] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 0 {
+				return true
+			}
+			for i := range len(s) + 1 {
+				if matchRunes(p, s[i:], fold) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			p, s = p[1:], s[1:]
+			continue
+
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			if matched, width := matchClass(p, s[0], fold); width > 0 {
+				if !matched {
+					return false
+				}
+				p, s = p[width:], s[1:]
+				continue
+			}
+
+		case '\\':
+			if len(p) > 1 {
+				p = p[1:]
+			}
+		}
+
+		// A literal character
+		if len(s) == 0 || (p[0] != s[0] && !(fold && unicode.ToLower(p[0]) == unicode.ToLower(s[0]))) {
+			return false
+		}
+		p, s = p[1:], s[1:]
+	}
+
+	return len(s) == 0
+}
+
+// charClasses are the named classes usable in brackets, as in "[[:digit:]]".
+var charClasses = map[string]func(rune) bool{
+	"alnum":  func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) },
+	"alpha":  unicode.IsLetter,
+	"blank":  func(r rune) bool { return r == ' ' || r == '\t' },
+	"cntrl":  unicode.IsControl,
+	"digit":  unicode.IsDigit,
+	"graph":  func(r rune) bool { return unicode.IsGraphic(r) && !unicode.IsSpace(r) },
+	"lower":  unicode.IsLower,
+	"print":  unicode.IsPrint,
+	"punct":  unicode.IsPunct,
+	"space":  unicode.IsSpace,
+	"upper":  unicode.IsUpper,
+	"xdigit": func(r rune) bool { return strings.ContainsRune("0123456789abcdefABCDEF", r) },
+}
+
+// matchClass matches r against the bracket expression at the start of p,
+// returning whether it matched and the width of the expression. The width
+// is 0 when the bracket isn't closed, and so stands for itself. With fold,
+// the characters and ranges match letters regardless of case, the named
+// classes don't.
+func matchClass(p []rune, r rune, fold bool) (bool, int) {
+	i := 1
+	negate := i < len(p) && (p[i] == '!' || p[i] == '^')
+	if negate {
+		i++
+	}
+
+	matched := false
+	for first := true; i < len(p); first = false {
+		c := p[i]
+		if c == ']' && !first {
+			return matched != negate, i + 1
+		}
+
+		if c == '[' && i+1 < len(p) && p[i+1] == ':' {
+			rest := string(p[i+2:])
+			if end := strings.Index(rest, ":]"); end >= 0 {
+				if isClass, ok := charClasses[rest[:end]]; ok {
+					matched = matched || isClass(r)
+					i += len([]rune(rest[:end])) + 4
+					continue
+				}
+			}
+		}
+
+		if c == '\\' && i+1 < len(p) {
+			i++
+			c = p[i]
+		}
+		lo, hi := c, c
+		if i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']' {
+			hi = p[i+2]
+			if hi == '\\' && i+3 < len(p) {
+				i++
+				hi = p[i+2]
+			}
+			i += 2
+		}
+		matched = matched || (lo <= r && r <= hi)
+		if fold {
+			for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+				matched = matched || (lo <= f && f <= hi)
+			}
+		}
+		i++
+	}
+
+	return false, 0
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestGlob(t *testing.T) {
+	fixture := "mkdir -p a/b/c d\ntouch top.go a/one.go a/b/two.go a/b/c/three.go a/b/c/notes.txt Upper.txt\nln -s .. a/b/loop\n"
+	runScriptTests(t, []scriptTest{
+		{"star", fixture + "echo *.go\n", "top.go\n"},
+		{"negated bracket", fixture + "echo [!a-t]*\n", "Upper.txt\n"},
+		{"named class", fixture + "echo [[:upper:]]*\n", "Upper.txt\n"},
+		{"directories only", fixture + "echo */\n", "a/ d/\n"},
+		{"path", fixture + "echo a/*/*.go ./a/*\n", "a/b/two.go ./a/b ./a/one.go\n"},
+		{"no match", fixture + "echo */*.xyz\n", "*/*.xyz\n"},
+		{"escaped", fixture + "echo \\*.go\n", "*.go\n"},
+		{"globstar off", fixture + "echo **/*.go\n", "a/one.go\n"},
+		{"globstar", fixture + "set -o globstar\necho **/*.go\n", "a/b/c/three.go a/b/two.go a/one.go top.go\n"},
+		{"globstar directories", fixture + "set -o globstar\necho a/**/\n", "a/ a/b/ a/b/c/ a/b/loop/\n"},
+		{"globstar everything", fixture + "set -o globstar\necho a/**\n", "a/ a/b a/b/c a/b/c/notes.txt a/b/c/three.go a/b/loop a/b/two.go a/one.go\n"},
+	})
+}
+
+func TestNocaseglob(t *testing.T) {
+	fixture := "mkdir Dir\ntouch a.txt B.TXT c.go Dir/Z.Txt\n"
+	runScriptTests(t, []scriptTest{
+		{"off", fixture + "echo *.txt [a-b]*\n", "a.txt a.txt\n"},
+		{"on", fixture + "set -o nocaseglob\necho *.txt [a-b]*\n", "B.TXT a.txt B.TXT a.txt\n"},
+		{"directories", fixture + "shopt -s nocaseglob\necho dir/*.TXT */*.txt\n", "dir/*.TXT Dir/Z.Txt\n"},
+		{"named class", fixture + "set -o nocaseglob\necho [[:upper:]]*\n", "B.TXT Dir\n"},
+	})
+}
+
+func TestNoMatch(t *testing.T) {
+	tests := []struct {
+		name, options string
+		out, err      string
+	}{
+		{"kept", "", "a *.xyz b\nafter 0\n", ""},
+		{"nullglob", "set -o nullglob\n", "a b\nafter 0\n", ""},
+		{"failglob", "set -o failglob\n", "after 1\n", "no match: *.xyz\n"},
+		{"failglob over nullglob", "shopt -s nullglob failglob\n", "after 1\n", "no match: *.xyz\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errOut, _ := runScript(t, tt.options+"touch a.txt\necho a *.xyz b\necho after $?\n", "")
+			if out != tt.out || errOut != tt.err {
+				t.Errorf("got %q and %q, want %q and %q", out, errOut, tt.out, tt.err)
+			}
+		})
+	}
+}
+
+func TestDotglob(t *testing.T) {
+	fixture := "mkdir d\ntouch .hidden visible d/.h d/v\n"
+	runScriptTests(t, []scriptTest{
+		{"hidden by default", fixture + "echo * d/*\n", "d script.sh visible d/v\n"},
+		{"leading dot in the pattern", fixture + "echo .* d/.*\n", ".hidden d/.h\n"},
+		{"dotglob", fixture + "set -o dotglob\necho * d/*\n", ".hidden d script.sh visible d/.h d/v\n"},
+		{"dotglob off again", fixture + "shopt -s dotglob\nshopt -u dotglob\necho *\n", "d script.sh visible\n"},
+	})
+}
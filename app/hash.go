@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// hashEntry is a program remembered in the hash table, with the number of
+// times it was run since.
+type hashEntry struct {
+	path string
+	hits int
+}
+
+// hashedPath returns the path of the program a command runs, looking it up
+// in $PATH only when the hash table doesn't remember it, or it's gone since.
+// Every call counts as a run of the program.
+func (sh *Shell) hashedPath(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		return sh.getExecutablePath(name)
+	}
+
+	e, ok := sh.hashed[name]
+	if info, err := os.Stat(sh.path(e.path)); !ok || err != nil || info.IsDir() {
+		path, err := sh.getExecutablePath(name)
+		if err != nil {
+			delete(sh.hashed, name)
+			return "", err
+		}
+		e = hashEntry{path: path}
+	}
+	e.hits++
+	sh.hashed[name] = e
+	return e.path, nil
+}
+
+func (sh *Shell) executeHashCmd(cmd *Command) int {
+	var reset, reusable, remove, show bool
+	path := ""
+	args := cmd.Args
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		for _, c := range opt[1:] {
+			switch c {
+			case 'r':
+				reset = true
+			case 'l':
+				reusable = true
+			case 'd':
+				remove = true
+			case 't':
+				show = true
+			case 'p':
+				if len(args) == 0 {
+					fmt.Fprintln(cmd.Stderr, "hash: -p: option requires an argument")
+					return 2
+				}
+				path, args = args[0], args[1:]
+			default:
+				fmt.Fprintf(cmd.Stderr, "hash: -%c: invalid option\n", c)
+				fmt.Fprintln(cmd.Stderr, "hash: usage: hash [-lr] [-p pathname] [-dt] [name ...]")
+				return 2
+			}
+		}
+	}
+
+	if reset {
+		clear(sh.hashed)
+	}
+	if len(args) == 0 {
+		switch {
+		case remove:
+			fmt.Fprintln(cmd.Stderr, "hash: -d: option requires an argument")
+			return 2
+		case show:
+			fmt.Fprintln(cmd.Stderr, "hash: -t: option requires an argument")
+			return 2
+		case reset || path != "":
+			return 0
+		}
+		sh.printHashed(cmd, reusable)
+		return 0
+	}
+
+	status := 0
+	for _, name := range args {
+		e, ok := sh.hashed[name]
+		switch {
+		case path != "":
+			sh.hashed[name] = hashEntry{path: path}
+		case remove:
+			if !ok {
+				fmt.Fprintf(cmd.Stderr, "hash: %s: not found\n", name)
+				status = 1
+			}
+			delete(sh.hashed, name)
+		case show:
+			if !ok {
+				fmt.Fprintf(cmd.Stderr, "hash: %s: not found\n", name)
+				status = 1
+			} else if len(args) > 1 {
+				fmt.Fprintf(cmd.Stdout, "%s\t%s\n", name, e.path)
+			} else {
+				fmt.Fprintln(cmd.Stdout, e.path)
+			}
+		default:
+			// Only programs are looked up
+			_, isFunc := sh.funcs[name]
+			_, isBuiltin := sh.builtin(name)
+			if isFunc || isBuiltin || strings.Contains(name, "/") {
+				continue
+			}
+			found, err := sh.getExecutablePath(name)
+			if err != nil {
+				fmt.Fprintf(cmd.Stderr, "hash: %s: not found\n", name)
+				status = 1
+				continue
+			}
+			sh.hashed[name] = hashEntry{path: found}
+		}
+	}
+	return status
+}
+
+// printHashed lists the programs in the hash table with their number of
+// runs, or as the commands that would remember them again with reusable.
+func (sh *Shell) printHashed(cmd *Command, reusable bool) {
+	if len(sh.hashed) == 0 {
+		fmt.Fprintln(cmd.Stdout, "hash: hash table empty")
+		return
+	}
+
+	names := make([]string, 0, len(sh.hashed))
+	for name := range sh.hashed {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	if !reusable {
+		fmt.Fprintln(cmd.Stdout, "hits\tcommand")
+	}
+	for _, name := range names {
+		e := sh.hashed[name]
+		if reusable {
+			fmt.Fprintf(cmd.Stdout, "builtin hash -p %s %s\n", e.path, name)
+		} else {
+			fmt.Fprintf(cmd.Stdout, "%4d\t%s\n", e.hits, e.path)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+// hashSetup puts two programs, a and b, in a directory of $PATH, and an
+// alternative a in another one.
+const hashSetup = "mkdir bin other\nprintf '#!/bin/sh\\necho a\\n' >bin/a\nprintf '#!/bin/sh\\necho b\\n' >bin/b\nprintf '#!/bin/sh\\necho other a\\n' >other/a\nchmod +x bin/* other/*\nPATH=$HOME/bin:$PATH\nhash -r\n"
+
+func TestHash(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"empty", hashSetup + "hash\n", "hash: hash table empty\n"},
+		{"run", hashSetup + "a; a; b\nhash | sed \"s#$HOME/##\"\n", "a\na\nb\nhits\tcommand\n   2\tbin/a\n   1\tbin/b\n"},
+		{"added", hashSetup + "hash a b\nhash -t a b | sed \"s#$HOME/##\"\n", "a\tbin/a\nb\tbin/b\n"},
+		{"not found", hashSetup + "hash nope; echo $?\nhash echo; echo $?\nhash\n", "1\n0\nhash: hash table empty\n"},
+		{"reusable", hashSetup + "hash -p /bin/true t\nhash -l\n", "builtin hash -p /bin/true t\n"},
+		{"deleted", hashSetup + "hash a b\nhash -d a\nhash -t b | sed \"s#$HOME/##\"\nhash -t a; echo $?\n", "bin/b\n1\n"},
+		{"cleared", hashSetup + "hash a b\nhash -r\nhash\n", "hash: hash table empty\n"},
+		{"path changed", hashSetup + "a\nPATH=$HOME/other:$PATH\nhash\na\n", "a\nhash: hash table empty\nother a\n"},
+		{"gone", hashSetup + "a\nrm bin/a\nPATH=$HOME/other:$PATH\na\n", "a\nother a\n"},
+		{"path for the command", hashSetup + "PATH=$HOME/other a\nhash\na\n", "other a\nhash: hash table empty\na\n"},
+		{"path for the command hashed", hashSetup + "a\nPATH=$HOME/other a\n", "a\nother a\n"},
+	})
+}
+
+func TestPathEntries(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"not a directory", hashSetup + "touch file\nPATH=$HOME/file:$HOME/missing:$PATH\nb\n", "b\n"},
+		{"empty entries", hashSetup + "PATH=:$PATH:\nb\n", "b\n"},
+	})
+}
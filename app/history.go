@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// history holds the commands entered at the interactive prompt, oldest
+// first. Entries are numbered from first.
+var history = struct {
+	entries []string
+	first   int
+}{first: 1}
+
+// defaultHistSize is the number of entries kept without a valid $HISTSIZE.
+const defaultHistSize = 500
+
+// addHistory records a command in the history.
+func (sh *Shell) addHistory(cmd string) {
+	history.entries = append(history.entries, cmd)
+	sh.trimHistory()
+}
+
+// trimHistory drops the oldest entries beyond $HISTSIZE. A negative size
+// means no limit. Subshells, which run alongside the shell, leave the history
+// it keeps to it, as they would their copy of it.
+func (sh *Shell) trimHistory() {
+	if sh.subshell {
+		return
+	}
+	size := defaultHistSize
+	if value, ok := sh.getVar("HISTSIZE"); ok {
+		if n, err := strconv.Atoi(value); err == nil {
+			size = n
+		}
+	}
+
+	if n := len(history.entries) - size; size >= 0 && n > 0 {
+		history.entries = slices.Delete(history.entries, 0, n)
+		history.first += n
+	}
+}
+
+// recordHistory records a command entered at the prompt, unless $HISTCONTROL
+// says to leave it out: with "ignoredups", the default, when the same as the
+// previous one, and with "ignorespace" when it starts with a space.
+// "ignoreboth" is short for both.
+func (sh *Shell) recordHistory(cmd string) {
+	control, ok := sh.getVar("HISTCONTROL")
+	if !ok {
+		control = "ignoredups"
+	}
+
+	var ignoreDups, ignoreSpace bool
+	for _, opt := range strings.Split(control, ":") {
+		switch opt {
+		case "ignoredups":
+			ignoreDups = true
+		case "ignorespace":
+			ignoreSpace = true
+		case "ignoreboth":
+			ignoreDups, ignoreSpace = true, true
+		}
+	}
+
+	if ignoreSpace && strings.HasPrefix(cmd, " ") {
+		return
+	}
+	if n := len(history.entries); ignoreDups && n > 0 && history.entries[n-1] == cmd {
+		return
+	}
+	sh.addHistory(cmd)
+}
+
+// removeLastHistory drops the most recent entry of the history.
+func removeLastHistory() {
+	if n := len(history.entries); n > 0 {
+		history.entries = history.entries[:n-1]
+	}
+}
+
+// lastHistory returns the number of the most recent entry.
+func lastHistory() int {
+	return history.first + len(history.entries) - 1
+}
+
+// historyEntry returns the entry with number n.
+func historyEntry(n int) string {
+	return history.entries[n-history.first]
+}
+
+// findHistory resolves a history reference: a number, negative to count
+// back from the most recent entry, or the prefix of a command to find the
+// most recent entry starting with it.
+func findHistory(ref string) (int, bool) {
+	last := lastHistory()
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 0 {
+			n += last + 1
+		}
+		n = max(history.first, min(n, last))
+		return n, len(history.entries) > 0
+	}
+
+	for n := last; n >= history.first; n-- {
+		if strings.HasPrefix(historyEntry(n), ref) {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+func (sh *Shell) executeHistoryCmd(cmd *Command) int {
+	from := history.first
+	if len(cmd.Args) > 0 {
+		if cmd.Args[0] == "-c" {
+			if sh.subshell {
+				return 0
+			}
+			history.first += len(history.entries)
+			history.entries = nil
+			return 0
+		}
+
+		n, err := strconv.Atoi(cmd.Args[0])
+		if err != nil || n < 0 {
+			fmt.Fprintf(cmd.Stderr, "history: %s: numeric argument required\n", cmd.Args[0])
+			return 1
+		}
+		from = max(history.first, lastHistory()-n+1)
+	}
+
+	for n := from; n <= lastHistory(); n++ {
+		fmt.Fprintf(cmd.Stdout, "%5d  %s\n", n, historyEntry(n))
+	}
+	return 0
+}
+
+func (sh *Shell) executeFcCmd(cmd *Command) int {
+	// The fc command itself gives way to the commands it runs
+	if sh.interactive {
+		removeLastHistory()
+	}
+
+	var list, numbers, reverse, substitute bool
+	args := cmd.Args
+	editor := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		if _, err := strconv.Atoi(args[0]); err == nil {
+			break // a negative history reference
+		}
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		for _, c := range opt[1:] {
+			switch c {
+			case 'l':
+				list = true
+			case 'n':
+				numbers = true
+			case 'r':
+				reverse = true
+			case 's':
+				substitute = true
+			case 'e':
+				if len(args) == 0 {
+					fmt.Fprintln(cmd.Stderr, "fc: -e: option requires an argument")
+					return 2
+				}
+				editor, args = args[0], args[1:]
+			default:
+				fmt.Fprintf(cmd.Stderr, "fc: -%c: invalid option\n", c)
+				fmt.Fprintln(cmd.Stderr, "fc: usage: fc [-e ename] [-lnr] [first] [last] or fc -s [pat=rep] [command]")
+				return 2
+			}
+		}
+	}
+
+	if len(history.entries) == 0 {
+		fmt.Fprintln(cmd.Stderr, "fc: history specification out of range")
+		return 1
+	}
+
+	if substitute {
+		return sh.fcSubstitute(cmd, args)
+	}
+
+	// Listing defaults to the last 16 commands, editing to the last one
+	first, last := lastHistory(), lastHistory()
+	if list {
+		first = max(history.first, last-15)
+	}
+	if len(args) > 0 {
+		n, ok := findHistory(args[0])
+		if !ok {
+			fmt.Fprintln(cmd.Stderr, "fc: history specification out of range")
+			return 1
+		}
+		first = n
+		if !list {
+			last = n
+		}
+	}
+	if len(args) > 1 {
+		n, ok := findHistory(args[1])
+		if !ok {
+			fmt.Fprintln(cmd.Stderr, "fc: history specification out of range")
+			return 1
+		}
+		last = n
+	}
+	if first > last {
+		first, last = last, first
+		reverse = !reverse
+	}
+
+	var nums []int
+	for n := first; n <= last; n++ {
+		nums = append(nums, n)
+	}
+	if reverse {
+		for i, j := 0, len(nums)-1; i < j; i, j = i+1, j-1 {
+			nums[i], nums[j] = nums[j], nums[i]
+		}
+	}
+
+	if list {
+		for _, n := range nums {
+			if numbers {
+				fmt.Fprintf(cmd.Stdout, "\t %s\n", historyEntry(n))
+			} else {
+				fmt.Fprintf(cmd.Stdout, "%d\t %s\n", n, historyEntry(n))
+			}
+		}
+		return 0
+	}
+
+	var lines []string
+	for _, n := range nums {
+		lines = append(lines, historyEntry(n))
+	}
+	return sh.fcEdit(cmd, editor, strings.Join(lines, "\n")+"\n")
+}
+
+// fcEdit has the user edit the commands in an editor, then runs the result.
+// A blank editor is as good as none, and the next one along is used.
+func (sh *Shell) fcEdit(cmd *Command, editor, text string) int {
+	fields := strings.Fields(editor)
+	for _, name := range []string{"FCEDIT", "EDITOR"} {
+		if len(fields) == 0 {
+			value, _ := sh.getVar(name)
+			fields = strings.Fields(value)
+		}
+	}
+	if len(fields) == 0 {
+		fields = []string{"vi"}
+	}
+
+	f, err := os.CreateTemp("", "gosh-fc-*.sh")
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "fc: %v\n", err)
+		return 1
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "fc: %v\n", err)
+		return 1
+	}
+
+	edit := &Command{Exec: fields[0], Args: append(fields[1:], f.Name()), Streams: cmd.Streams}
+	if status := sh.runProgram(edit); status != 0 {
+		return status
+	}
+
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "fc: %v\n", err)
+		return 1
+	}
+	return sh.fcRun(cmd, strings.TrimRight(string(edited), "\n"))
+}
+
+// fcSubstitute runs a command from the history again, replacing the first
+// occurrence of old with new in it for every "old=new" argument.
+func (sh *Shell) fcSubstitute(cmd *Command, args []string) int {
+	var subs [][2]string
+	for len(args) > 0 && strings.Contains(args[0], "=") {
+		old, new, _ := strings.Cut(args[0], "=")
+		subs = append(subs, [2]string{old, new})
+		args = args[1:]
+	}
+
+	n := lastHistory()
+	if len(args) > 0 {
+		var ok bool
+		if n, ok = findHistory(args[0]); !ok {
+			fmt.Fprintln(cmd.Stderr, "fc: no command found")
+			return 1
+		}
+	}
+
+	line := historyEntry(n)
+	for _, sub := range subs {
+		if sub[0] != "" {
+			line = strings.Replace(line, sub[0], sub[1], 1)
+		}
+	}
+	return sh.fcRun(cmd, line)
+}
+
+// fcRun echoes and runs commands from fc, recording them in the history.
+func (sh *Shell) fcRun(cmd *Command, text string) int {
+	if strings.TrimSpace(text) == "" {
+		return 0
+	}
+
+	fmt.Fprintln(cmd.Stdout, text)
+	if sh.interactive {
+		sh.addHistory(text)
+	}
+	return sh.evaluateCommand(text)
+}
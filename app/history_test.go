@@ -0,0 +1,207 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// resetHistory empties the history for a test.
+func resetHistory(t *testing.T) {
+	history.entries, history.first = nil, 1
+	t.Cleanup(func() { history.entries, history.first = nil, 1 })
+}
+
+func TestHistoryControl(t *testing.T) {
+	tests := []struct {
+		control string
+		want    []string
+	}{
+		{"", []string{"ls", "echo", " pwd", "ls"}},
+		{"ignoredups", []string{"ls", "echo", " pwd", "ls"}},
+		{"ignorespace", []string{"ls", "ls", "echo", "echo", "ls"}},
+		{"ignoreboth", []string{"ls", "echo", "ls"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.control, func(t *testing.T) {
+			resetHistory(t)
+			sh := newShell(false, "gosh", nil)
+			delete(sh.vars, "HISTCONTROL")
+			if tt.control != "" {
+				sh.setVar("HISTCONTROL", tt.control)
+			}
+			for _, cmd := range []string{"ls", "ls", "echo", "echo", " pwd", " pwd", "ls"} {
+				sh.recordHistory(cmd)
+			}
+			if !slices.Equal(history.entries, tt.want) {
+				t.Errorf("got %q, want %q", history.entries, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistorySize(t *testing.T) {
+	resetHistory(t)
+	sh := newShell(false, "gosh", nil)
+	sh.setVar("HISTSIZE", "3")
+	for _, cmd := range []string{"one", "two", "three", "four", "five"} {
+		sh.addHistory(cmd)
+	}
+	if want := []string{"three", "four", "five"}; !slices.Equal(history.entries, want) {
+		t.Errorf("got %q, want %q", history.entries, want)
+	}
+
+	// The entries keep their numbers
+	var out strings.Builder
+	sh.executeHistoryCmd(&Command{Streams: Streams{Stdout: &out}})
+	if want := "    3  three\n    4  four\n    5  five\n"; out.String() != want {
+		t.Errorf("history printed %q, want %q", out.String(), want)
+	}
+
+	// A smaller size trims on the next command
+	sh.setVar("HISTSIZE", "1")
+	sh.addHistory("six")
+	if want := []string{"six"}; !slices.Equal(history.entries, want) {
+		t.Errorf("got %q, want %q", history.entries, want)
+	}
+}
+
+func TestHistorySizeSubshell(t *testing.T) {
+	resetHistory(t)
+	sh := newShell(false, "gosh", nil)
+	for _, cmd := range []string{"one", "two", "three"} {
+		sh.addHistory(cmd)
+	}
+
+	// A subshell runs alongside the shell, and leaves the history to it
+	c := sh.newSubshell(sh.streams)
+	c.setVar("HISTSIZE", "1")
+	c.executeHistoryCmd(&Command{Args: []string{"-c"}, Streams: c.streams})
+	if want := []string{"one", "two", "three"}; !slices.Equal(history.entries, want) {
+		t.Errorf("got %q, want %q", history.entries, want)
+	}
+}
+
+func TestRecallContinued(t *testing.T) {
+	sh := startPtyShell(t)
+	sh.send("echo \"one\r two\" # it's one command\r")
+	sh.expect("one\r\n two\r\n")
+
+	// Up brings back the whole command, which runs again as it was, and is
+	// a single entry of the history
+	sh.send("\x1b[A\r")
+	sh.expect("one\r\n two\r\n")
+	sh.send("history; echo listed-$((6 * 7))\r")
+	out := sh.expect("listed-42")
+	if want := "    1  echo \"one\r\n two\" # it's one command\r\n    2  history"; !strings.Contains(out, want) {
+		t.Errorf("history listed %q, want %q", out, want)
+	}
+}
+
+// fcShell returns a shell with commands in its history, printing to out.
+func fcShell(t *testing.T, out *strings.Builder, commands ...string) *Shell {
+	t.Helper()
+	resetHistory(t)
+	sh := newShell(false, "gosh", nil)
+	sh.streams.Stdout, sh.streams.Stderr = out, out
+	for _, cmd := range commands {
+		sh.addHistory(cmd)
+	}
+	return sh
+}
+
+func TestFcList(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-l"}, "1\t echo one\n2\t echo two\n3\t echo three\n"},
+		{[]string{"-l", "2"}, "2\t echo two\n3\t echo three\n"},
+		{[]string{"-l", "-2", "-1"}, "2\t echo two\n3\t echo three\n"},
+		{[]string{"-lr", "1", "2"}, "2\t echo two\n1\t echo one\n"},
+		{[]string{"-ln", "echo t"}, "\t echo three\n"},
+		{[]string{"-l", "nosuch"}, "fc: history specification out of range\n"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		sh := fcShell(t, &out, "echo one", "echo two", "echo three")
+		sh.executeFcCmd(&Command{Args: tt.args, Streams: sh.streams})
+		if out.String() != tt.want {
+			t.Errorf("fc %q: got %q, want %q", tt.args, out.String(), tt.want)
+		}
+	}
+}
+
+func TestFcSubstitute(t *testing.T) {
+	var out strings.Builder
+	sh := fcShell(t, &out, "echo one one", "echo two")
+	if status := sh.executeFcCmd(&Command{Args: []string{"-s", "one=1"}, Streams: sh.streams}); status != 0 {
+		t.Errorf("fc -s with no match: got status %d", status)
+	}
+	sh.executeFcCmd(&Command{Args: []string{"-s", "one=1", "echo o"}, Streams: sh.streams})
+	sh.executeFcCmd(&Command{Args: []string{"-s", "two=2", "2=22"}, Streams: sh.streams})
+	if want := "echo two\ntwo\necho 1 one\n1 one\necho 22\n22\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestFcEdit(t *testing.T) {
+	// The editor changes the command in the file it's given
+	editor := filepath.Join(t.TempDir(), "editor")
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\nsed -i 's/one/edited/' \"$1\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		fcedit string
+	}{
+		{"-e", []string{"-e", editor}, ""},
+		{"FCEDIT", nil, editor},
+		{"blank -e", []string{"-e", " "}, editor},
+		{"blank FCEDIT", []string{"-e", editor}, " "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			sh := fcShell(t, &out, "echo one")
+			if tt.fcedit != "" {
+				sh.setVar("FCEDIT", tt.fcedit)
+			}
+			sh.executeFcCmd(&Command{Args: tt.args, Streams: sh.streams})
+			if want := "echo edited\nedited\n"; out.String() != want {
+				t.Errorf("got %q, want %q", out.String(), want)
+			}
+		})
+	}
+
+	// With nothing but blanks for an editor, vi is the one left
+	var out strings.Builder
+	sh := fcShell(t, &out, "echo one")
+	sh.setVar("FCEDIT", " ")
+	sh.setVar("EDITOR", "\t")
+	sh.setVar("PATH", t.TempDir())
+	if status := sh.executeFcCmd(&Command{Streams: sh.streams}); status != 127 || out.String() != "vi: command not found\n" {
+		t.Errorf("with blank editors: got status %d, output %q", status, out.String())
+	}
+}
+
+func TestHistoryContinued(t *testing.T) {
+	sh := startPtyShell(t)
+	sh.send("echo a \\\r")
+	sh.send("b\r")
+	sh.expect("a b\r\n")
+	sh.send("if true\r")
+	sh.send("then echo c-$((6 * 7)); fi\r")
+	sh.expect("c-42\r\n")
+
+	// Each command is one entry, its lines joined with newlines
+	sh.send("history; echo listed-$((6 * 7))\r")
+	out := sh.expect("listed-42")
+	if want := "    1  echo a \\\r\nb\r\n    2  if true\r\nthen echo c-$((6 * 7)); fi\r\n    3  history"; !strings.Contains(out, want) {
+		t.Errorf("history listed %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,894 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+type jobState int
+
+const (
+	jobRunning jobState = iota
+	jobStopped
+	jobDone
+)
+
+func (s jobState) String() string {
+	switch s {
+	case jobRunning:
+		return "Running"
+	case jobStopped:
+		return "Stopped"
+	}
+	return "Done"
+}
+
+// process is a program started by the shell as part of a job. A process with
+// no pid stands for shell code the job runs on a goroutine, like a builtin
+// in a pipeline or the body of a background list.
+type process struct {
+	pid     int
+	stopped bool
+	done    bool
+	status  int
+	signal  syscall.Signal // the one that killed it, if any
+}
+
+// Job is a pipeline, or a background list, the shell keeps track of. Jobs
+// are only added to the jobs table, and given an ID, once they leave the
+// foreground.
+type Job struct {
+	ID      int
+	Pgid    int
+	Command string
+	State   jobState
+	Status  int            // exit status, once done
+	Signal  syscall.Signal // the signal that killed it, if any
+
+	foreground bool
+	nohup      bool // spared by hangupJobs
+
+	// noGroup is set without job control, for the processes of the job to
+	// stay in the shell's process group. Pgid is the first one's pid then.
+	noGroup bool
+	procs   []*process
+	main    *process // the process whose status is the job's
+}
+
+// jobs is the jobs table, with a condition variable broadcast on every state
+// change of a job's processes.
+var jobs = struct {
+	sync.Mutex
+	cond *sync.Cond
+	list []*Job
+
+	// current and previous are the jobs "%+" and "%-" refer to: the last
+	// ones sent to the background, stopped or resumed
+	current  *Job
+	previous *Job
+}{}
+
+func init() {
+	jobs.cond = sync.NewCond(&jobs.Mutex)
+}
+
+// updateStateLocked derives the job's state from the state of its processes.
+func (job *Job) updateStateLocked() {
+	job.State = jobDone
+	for _, p := range job.procs {
+		if p.stopped && !p.done {
+			job.State = jobStopped
+			break
+		}
+		if !p.done {
+			job.State = jobRunning
+		}
+	}
+
+	if job.State == jobDone && job.main != nil {
+		job.Status, job.Signal = job.main.status, job.main.signal
+
+		// Shell code ends with the status of the last program it ran, which
+		// tells whether a signal killed it
+		for _, p := range slices.Backward(job.procs) {
+			if p.pid != 0 {
+				if job.main.pid == 0 && p.signal != 0 && job.Status == 128+int(p.signal) {
+					job.Signal = p.signal
+				}
+				break
+			}
+		}
+	}
+	jobs.cond.Broadcast()
+}
+
+// addTask registers shell code the job runs on a goroutine. The task must be
+// ended with finishTask.
+func (job *Job) addTask() *process {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	p := &process{}
+	job.procs = append(job.procs, p)
+	return p
+}
+
+func (job *Job) finishTask(p *process, status int) {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	p.done = true
+	p.status = status
+	job.updateStateLocked()
+}
+
+// start starts proc as part of the job, in the job's process group. The
+// first process started creates the group.
+func (job *Job) start(proc *exec.Cmd) (*process, error) {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	if !job.noGroup {
+		// The group is gone once all of its processes are, e.g. when the
+		// first stage of a pipeline exits before the next one starts. Start
+		// anew then.
+		if job.Pgid != 0 && syscall.Kill(-job.Pgid, 0) == syscall.ESRCH {
+			job.Pgid = 0
+		}
+
+		proc.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: job.Pgid}
+		if job.foreground && ttyFd >= 0 {
+			proc.SysProcAttr.Foreground = true
+			proc.SysProcAttr.Ctty = ttyFd
+		}
+	}
+
+	if err := proc.Start(); err != nil {
+		return nil, err
+	}
+	if job.Pgid == 0 {
+		job.Pgid = proc.Process.Pid
+		if job.foreground && !job.noGroup {
+			foregroundPgid.Store(int64(job.Pgid))
+		}
+	}
+
+	p := &process{pid: proc.Process.Pid}
+	job.procs = append(job.procs, p)
+	if job.main == nil {
+		job.main = p
+	}
+	job.updateStateLocked()
+	go job.watch(p)
+
+	return p, nil
+}
+
+// watch reaps process p of the job, keeping the job's state up to date as
+// the process stops, continues and exits.
+func (job *Job) watch(p *process) {
+	for {
+		var ws syscall.WaitStatus
+		_, err := syscall.Wait4(p.pid, &ws, syscall.WUNTRACED|syscall.WCONTINUED, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+
+		jobs.Lock()
+		switch {
+		case err != nil:
+			p.done = true
+			p.status = 127
+		case ws.Stopped():
+			p.stopped = true
+		case ws.Continued():
+			p.stopped = false
+		case ws.Exited():
+			p.done = true
+			p.status = ws.ExitStatus()
+		case ws.Signaled():
+			p.done = true
+			p.status = 128 + int(ws.Signal())
+			p.signal = ws.Signal()
+
+			// The terminal sends keyboard signals to the foreground job only,
+			// so the shell learns about the interrupt from its processes
+			if ws.Signal() == syscall.SIGINT && job.foreground {
+				interruptFlag.Store(true)
+			}
+		}
+		job.updateStateLocked()
+		jobs.Unlock()
+
+		if p.done {
+			return
+		}
+	}
+}
+
+// waitProcess waits for p to exit and returns its exit status.
+func waitProcess(p *process) int {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	for !p.done {
+		jobs.cond.Wait()
+	}
+	return p.status
+}
+
+// waitForeground waits until the foreground job either finishes or gets
+// stopped, in which case it's recorded in the jobs table, and returns its
+// exit status. A signal that ends the shell cuts the wait short.
+func waitForeground(job *Job, stderr io.Writer) int {
+	jobs.Lock()
+	for job.State == jobRunning && !exitPending.Load() {
+		jobs.cond.Wait()
+	}
+
+	status := job.Status
+	if job.State == jobStopped {
+		if job.ID == 0 {
+			addJobLocked(job)
+		}
+		setCurrentJobLocked(job)
+		job.foreground = false
+		fmt.Fprintf(stderr, "\n%s\n", formatJobLocked(job))
+		status = 128 + int(syscall.SIGTSTP)
+	} else if job.State == jobDone && job.ID != 0 {
+		removeJobLocked(job)
+	}
+	jobs.Unlock()
+
+	foregroundPgid.Store(0)
+	reclaimTerminal()
+	return status
+}
+
+// waitJob waits until job is no longer running, removing it from the jobs
+// table once done, and returns its exit status.
+func waitJob(job *Job) int {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	for job.State == jobRunning && !exitPending.Load() {
+		jobs.cond.Wait()
+	}
+	if job.State == jobDone {
+		removeJobLocked(job)
+	}
+	return job.Status
+}
+
+// waitAnyJob waits until any one of the jobs, or of every job without any,
+// is done, removing it from the jobs table, and returns its exit status. It
+// returns 127 right away when none of them is running.
+func waitAnyJob(among []*Job) int {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	for {
+		running := false
+		for _, job := range jobs.list {
+			if among != nil && !slices.Contains(among, job) {
+				continue
+			}
+			switch job.State {
+			case jobDone:
+				removeJobLocked(job)
+				return job.Status
+			case jobRunning:
+				running = true
+			}
+		}
+		if !running || exitPending.Load() {
+			return 127
+		}
+		jobs.cond.Wait()
+	}
+}
+
+// signalLocked sends sig to the processes of the job: to its process group,
+// or to each of them without one.
+func (job *Job) signalLocked(sig syscall.Signal) error {
+	if !job.noGroup {
+		return syscall.Kill(-job.Pgid, sig)
+	}
+
+	var err error
+	for _, p := range job.procs {
+		if p.pid != 0 && !p.done {
+			if e := syscall.Kill(p.pid, sig); e != nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// continueJob resumes the processes of a stopped job.
+func continueJob(job *Job) error {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	if job.State != jobStopped || job.Pgid == 0 {
+		return nil
+	}
+	if err := job.signalLocked(syscall.SIGCONT); err != nil {
+		return err
+	}
+
+	// Don't wait for the processes to report back, so that the job doesn't
+	// look stopped any longer to whoever waits for it next
+	for _, p := range job.procs {
+		p.stopped = false
+	}
+	job.updateStateLocked()
+	return nil
+}
+
+// addJobLocked records job in the jobs table under the next free ID.
+func addJobLocked(job *Job) {
+	job.ID = 1
+	if n := len(jobs.list); n > 0 {
+		job.ID = jobs.list[n-1].ID + 1
+	}
+	jobs.list = append(jobs.list, job)
+	setCurrentJobLocked(job)
+}
+
+func removeJobLocked(job *Job) {
+	for i, j := range jobs.list {
+		if j == job {
+			jobs.list = append(jobs.list[:i], jobs.list[i+1:]...)
+			break
+		}
+	}
+
+	// The previous job takes over as the current one, the most recent of
+	// the others as the previous one
+	if job == jobs.current {
+		jobs.current, jobs.previous = jobs.previous, nil
+	}
+	if job == jobs.previous {
+		jobs.previous = nil
+	}
+	for i := len(jobs.list) - 1; i >= 0 && (jobs.current == nil || jobs.previous == nil); i-- {
+		switch j := jobs.list[i]; {
+		case jobs.current == nil:
+			jobs.current = j
+		case j != jobs.current:
+			jobs.previous = j
+		}
+	}
+}
+
+// setCurrentJobLocked makes job the current job, and the current one the
+// previous one.
+func setCurrentJobLocked(job *Job) {
+	if job != jobs.current {
+		jobs.previous, jobs.current = jobs.current, job
+	}
+}
+
+// formatJobLocked renders job the way the jobs builtin lists it. The current
+// job is marked with "+", the previous one with "-".
+func formatJobLocked(job *Job) string {
+	mark := ' '
+	if job == jobs.current {
+		mark = '+'
+	} else if job == jobs.previous {
+		mark = '-'
+	}
+
+	command := job.Command
+	if job.State == jobDone {
+		command = strings.TrimSuffix(command, " &")
+	}
+	return fmt.Sprintf("[%d]%c  %-24s%s", job.ID, mark, job.describeStateLocked(), command)
+}
+
+// describeStateLocked returns the state of the job as formatJobLocked shows
+// it. A job that failed tells how: "Done(n)" with its exit status, or the
+// name of the signal that killed it.
+func (job *Job) describeStateLocked() string {
+	switch {
+	case job.State != jobDone:
+	case job.Signal != 0:
+		name := job.Signal.String()
+		return strings.ToUpper(name[:1]) + name[1:]
+	case job.Status != 0:
+		return fmt.Sprintf("Done(%d)", job.Status)
+	}
+	return job.State.String()
+}
+
+// notifyDoneJobs reports the jobs that finished since the last prompt, and
+// forgets them.
+func notifyDoneJobs(w io.Writer) {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	var done []*Job
+	for _, job := range jobs.list {
+		if job.State == jobDone {
+			fmt.Fprintln(w, formatJobLocked(job))
+			done = append(done, job)
+		}
+	}
+	for _, job := range done {
+		removeJobLocked(job)
+	}
+}
+
+// notifyWhenDone reports the job as soon as it finishes, with "set -b",
+// rather than at the next prompt.
+func notifyWhenDone(job *Job, w io.Writer) {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	for job.State != jobDone {
+		jobs.cond.Wait()
+	}
+	if !slices.Contains(jobs.list, job) {
+		return // waited for already
+	}
+
+	// Past the prompt when the shell is idle at it
+	if evalMu.TryLock() {
+		fmt.Fprintln(w)
+		evalMu.Unlock()
+	}
+	fmt.Fprintln(w, formatJobLocked(job))
+	removeJobLocked(job)
+}
+
+// findJobLocked looks up the job named by the first argument, defaulting to
+// the current job.
+func findJobLocked(args []string) (*Job, error) {
+	if len(args) == 0 {
+		return resolveJobSpecLocked("%+")
+	}
+	return resolveJobSpecLocked(args[0])
+}
+
+// resolveJobSpecLocked looks up the job named by a job spec: "%+" or "%%" for
+// the current job, "%-" for the previous one, "%n" or just "n" for job n,
+// "%string" for the job whose command starts with string, and "%?string" for
+// the one whose command contains it.
+func resolveJobSpecLocked(spec string) (*Job, error) {
+	switch spec {
+	case "%", "%%", "%+":
+		if jobs.current == nil {
+			return nil, fmt.Errorf("current: no such job")
+		}
+		return jobs.current, nil
+	case "%-":
+		if jobs.previous == nil {
+			return nil, fmt.Errorf("%s: no such job", spec)
+		}
+		return jobs.previous, nil
+	}
+
+	ref := strings.TrimPrefix(spec, "%")
+	if id, err := strconv.Atoi(ref); err == nil {
+		for _, job := range jobs.list {
+			if job.ID == id {
+				return job, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	if ref == spec {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	var found *Job
+	substr, contains := strings.CutPrefix(ref, "?")
+	for _, job := range jobs.list {
+		if (contains && strings.Contains(job.Command, substr)) || (!contains && strings.HasPrefix(job.Command, ref)) {
+			if found != nil {
+				return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+			}
+			found = job
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return found, nil
+}
+
+// findJobByPidLocked looks up the job one of whose processes is pid.
+func findJobByPidLocked(pid int) *Job {
+	for _, job := range jobs.list {
+		for _, p := range job.procs {
+			if p.pid == pid {
+				return job
+			}
+		}
+	}
+	return nil
+}
+
+func (sh *Shell) executeJobsCmd(cmd *Command) int {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	// Finished jobs are reported one last time, then forgotten
+	var done []*Job
+	for _, job := range jobs.list {
+		fmt.Fprintln(cmd.Stdout, formatJobLocked(job))
+		if job.State == jobDone {
+			done = append(done, job)
+		}
+	}
+	for _, job := range done {
+		removeJobLocked(job)
+	}
+
+	return 0
+}
+
+func (sh *Shell) executeFgCmd(cmd *Command) int {
+	if !sh.opts.monitor {
+		fmt.Fprintln(cmd.Stderr, "fg: no job control")
+		return 1
+	}
+
+	jobs.Lock()
+	job, err := findJobLocked(cmd.Args)
+	if err == nil {
+		job.foreground = true
+		setCurrentJobLocked(job)
+	}
+	jobs.Unlock()
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "fg: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(cmd.Stdout, strings.TrimSuffix(job.Command, " &"))
+	if job.Pgid != 0 {
+		foregroundPgid.Store(int64(job.Pgid))
+		if ttyFd >= 0 {
+			tcsetpgrp(ttyFd, job.Pgid)
+		}
+	}
+	if err := continueJob(job); err != nil {
+		fmt.Fprintf(cmd.Stderr, "fg: %v\n", err)
+		return 1
+	}
+
+	return waitForeground(job, cmd.Stderr)
+}
+
+func (sh *Shell) executeBgCmd(cmd *Command) int {
+	if !sh.opts.monitor {
+		fmt.Fprintln(cmd.Stderr, "bg: no job control")
+		return 1
+	}
+
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	job, err := findJobLocked(cmd.Args)
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "bg: %v\n", err)
+		return 1
+	}
+	if job.State == jobRunning {
+		fmt.Fprintf(cmd.Stderr, "bg: job %d already in background\n", job.ID)
+		return 0
+	}
+	setCurrentJobLocked(job)
+
+	jobs.Unlock()
+	err = continueJob(job)
+	jobs.Lock()
+	if err != nil {
+		fmt.Fprintf(cmd.Stderr, "bg: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(cmd.Stdout, "[%d]+ %s &\n", job.ID, strings.TrimSuffix(job.Command, " &"))
+
+	return 0
+}
+
+func (sh *Shell) executeWaitCmd(cmd *Command) int {
+	args := cmd.Args
+	first := len(args) > 0 && args[0] == "-n"
+	if first {
+		args = args[1:]
+	}
+
+	// Without arguments, wait for every running job
+	if len(args) == 0 && !first {
+		jobs.Lock()
+		pending := make([]*Job, 0, len(jobs.list))
+		for _, job := range jobs.list {
+			if job.State != jobStopped {
+				pending = append(pending, job)
+			}
+		}
+		jobs.Unlock()
+
+		for _, job := range pending {
+			waitJob(job)
+		}
+		return 0
+	}
+
+	// With -n, wait for the first of the jobs to be done
+	status := 0
+	var among []*Job
+	for _, arg := range args {
+		var job *Job
+		var err error
+
+		jobs.Lock()
+		if strings.HasPrefix(arg, "%") {
+			job, err = resolveJobSpecLocked(arg)
+		} else if pid, err := strconv.Atoi(arg); err == nil {
+			job = findJobByPidLocked(pid)
+		} else {
+			jobs.Unlock()
+			fmt.Fprintf(cmd.Stderr, "wait: `%s': not a pid or valid job spec\n", arg)
+			status = 2
+			continue
+		}
+		jobs.Unlock()
+
+		if job == nil {
+			if err != nil {
+				fmt.Fprintf(cmd.Stderr, "wait: %v\n", err)
+			} else {
+				fmt.Fprintf(cmd.Stderr, "wait: pid %s is not a child of this shell\n", arg)
+			}
+			status = 127
+			continue
+		}
+
+		if first {
+			among = append(among, job)
+			continue
+		}
+		status = waitJob(job)
+	}
+
+	if first && (len(args) == 0 || len(among) > 0) {
+		return waitAnyJob(among)
+	}
+	return status
+}
+
+// executeSuspendCmd stops the shell itself until it gets a SIGCONT, for the
+// shell it was started from to take over. A login shell is only stopped with
+// -f.
+func (sh *Shell) executeSuspendCmd(cmd *Command) int {
+	force := false
+	for _, arg := range cmd.Args {
+		if arg != "-f" {
+			fmt.Fprintf(cmd.Stderr, "suspend: %s: invalid option\n", arg)
+			fmt.Fprintln(cmd.Stderr, "suspend: usage: suspend [-f]")
+			return 2
+		}
+		force = true
+	}
+
+	if sh.login && !force {
+		fmt.Fprintln(cmd.Stderr, "suspend: cannot suspend a login shell")
+		return 1
+	}
+
+	// The stop can reach the shell's threads after kill returns, so the
+	// shell waits to be continued before running anything else
+	cont := make(chan os.Signal, 1)
+	signal.Notify(cont, syscall.SIGCONT)
+	defer signal.Stop(cont)
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGSTOP); err != nil {
+		fmt.Fprintf(cmd.Stderr, "suspend: %v\n", err)
+		return 1
+	}
+	<-cont
+	return 0
+}
+
+func (sh *Shell) executeDisownCmd(cmd *Command) int {
+	var all, nohup bool
+	args := cmd.Args
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'a':
+				all = true
+			case 'h':
+				nohup = true
+			default:
+				fmt.Fprintf(cmd.Stderr, "disown: -%c: invalid option\n", flag)
+				fmt.Fprintln(cmd.Stderr, "disown: usage: disown [-h] [-a] [jobspec ...]")
+				return 2
+			}
+		}
+		args = args[1:]
+	}
+
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	var targets []*Job
+	switch {
+	case all:
+		targets = append(targets, jobs.list...)
+	case len(args) == 0:
+		job, err := findJobLocked(nil)
+		if err != nil {
+			fmt.Fprintf(cmd.Stderr, "disown: %v\n", err)
+			return 1
+		}
+		targets = append(targets, job)
+	}
+
+	status := 0
+	for _, arg := range args {
+		job, err := resolveJobSpecLocked(arg)
+		if err != nil {
+			fmt.Fprintf(cmd.Stderr, "disown: %v\n", err)
+			status = 1
+			continue
+		}
+		targets = append(targets, job)
+	}
+
+	// With -h the jobs stay in the table, they just won't get hung up
+	for _, job := range targets {
+		if nohup {
+			job.nohup = true
+		} else {
+			removeJobLocked(job)
+		}
+	}
+
+	return status
+}
+
+func (sh *Shell) executeKillCmd(cmd *Command) int {
+	args := cmd.Args
+	sig := syscall.SIGTERM
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		spec := args[0][1:]
+		args = args[1:]
+		switch spec {
+		case "l", "L":
+			return listSignals(cmd, args)
+		case "s", "n":
+			if len(args) == 0 {
+				fmt.Fprintf(cmd.Stderr, "kill: -%s: option requires an argument\n", spec)
+				return 2
+			}
+			spec, args = args[0], args[1:]
+		}
+
+		var err error
+		if _, sig, err = parseSignal(spec); err != nil {
+			fmt.Fprintf(cmd.Stderr, "kill: %s: invalid signal specification\n", spec)
+			return 1
+		}
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(cmd.Stderr, "kill: usage: kill [-s sigspec | -n signum | -sigspec] pid | jobspec ... or kill -l [sigspec]")
+		return 2
+	}
+
+	status := 0
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "%") {
+			jobs.Lock()
+			job, err := resolveJobSpecLocked(arg)
+			if err == nil && job.Pgid == 0 {
+				err = fmt.Errorf("%s: no processes to signal", arg)
+			}
+			if err == nil {
+				err = job.signalLocked(sig)
+			}
+
+			// A stopped job has to be continued to act on the signal, but
+			// for signal 0, which only checks that the job is there
+			if err == nil && job.State == jobStopped && sig != syscall.SIGCONT && sig != 0 {
+				job.signalLocked(syscall.SIGCONT)
+			}
+			jobs.Unlock()
+			if err != nil {
+				fmt.Fprintf(cmd.Stderr, "kill: %v\n", err)
+				status = 1
+			}
+			continue
+		}
+
+		pid, err := strconv.Atoi(arg)
+		if err != nil {
+			fmt.Fprintf(cmd.Stderr, "kill: %s: arguments must be process or job IDs\n", arg)
+			status = 1
+			continue
+		}
+		if pid == os.Getpid() && sig != 0 {
+			err = killSelf(sig)
+		} else {
+			err = syscall.Kill(pid, sig)
+		}
+		if err != nil {
+			fmt.Fprintf(cmd.Stderr, "kill: (%d) - %s\n", pid, capitalize(err.Error()))
+			status = 1
+		}
+	}
+	return status
+}
+
+// listSignals prints the names of the signals given by number, or of all
+// of them without any, for kill -l.
+func listSignals(cmd *Command, args []string) int {
+	if len(args) == 0 {
+		var sigs []syscall.Signal
+		for _, sig := range signalNames {
+			if sig != 0 {
+				sigs = append(sigs, sig)
+			}
+		}
+		slices.Sort(sigs)
+		for _, sig := range sigs {
+			fmt.Fprintf(cmd.Stdout, "%2d) SIG%s\n", sig, signalName(sig))
+		}
+		return 0
+	}
+
+	status := 0
+	for _, arg := range args {
+		name, sig, err := parseSignal(arg)
+		if err != nil || sig == 0 {
+			fmt.Fprintf(cmd.Stderr, "kill: %s: invalid signal specification\n", arg)
+			status = 1
+			continue
+		}
+		// A number gives the name, a name the number
+		if _, err := strconv.Atoi(arg); err == nil {
+			fmt.Fprintln(cmd.Stdout, name)
+		} else {
+			fmt.Fprintln(cmd.Stdout, int(sig))
+		}
+	}
+	return status
+}
+
+// capitalize returns s with its first letter in upper case, for the messages
+// of system errors.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// hangupJobs sends SIGHUP to every job but those marked with disown -h. The
+// stopped ones are continued too, so that they get to handle it.
+func hangupJobs() {
+	jobs.Lock()
+	defer jobs.Unlock()
+
+	for _, job := range jobs.list {
+		if job.nohup || job.Pgid == 0 {
+			continue
+		}
+		job.signalLocked(syscall.SIGHUP)
+		if job.State == jobStopped {
+			job.signalLocked(syscall.SIGCONT)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJobStates(t *testing.T) {
+	script := "sleep 100 &\nkill $!\nsh -c 'exit 3' &\nsleep 100 &\nkill -9 $!\ntrue &\nsleep 100 &\nsleep 0.3\njobs\nkill %5\n"
+	want := "[1]   Terminated              sleep 100\n" +
+		"[2]   Done(3)                 sh -c 'exit 3'\n" +
+		"[3]   Killed                  sleep 100\n" +
+		"[4]-  Done                    true\n" +
+		"[5]+  Running                 sleep 100 &\n"
+	runScriptTests(t, []scriptTest{{"", script, want}})
+}
+
+func TestDoneBeforePrompt(t *testing.T) {
+	sh := startPtyShell(t)
+	sh.send("sleep 0.1 &\r")
+	sh.expect("[1] ")
+	time.Sleep(300 * time.Millisecond)
+	sh.send("\r")
+	sh.expect("\r\n[1]+  Done                    sleep 0.1\r\n$ ")
+}
+
+func TestJobSpecs(t *testing.T) {
+	start := "sh -c 'sleep 0.2; exit 1' &\nsh -c 'sleep 0.2; exit 2' &\nsleep 0.2 &\nsh -c 'sleep 0.2; exit 4' &\n"
+	runScriptTests(t, []scriptTest{
+		{"current", start + "wait %+; echo $?\n", "4\n"},
+		{"current as %%", start + "wait %%; echo $?\n", "4\n"},
+		{"previous", start + "wait %-; echo $?\n", "0\n"},
+		{"number", start + "wait %2; echo $?\nwait %1; echo $?\n", "2\n1\n"},
+		{"prefix", start + "wait %sl; echo $?\n", "0\n"},
+		{"substring", start + "wait %?'exit 2'; echo $?\n", "2\n"},
+		{"kill", start + "sleep 100 &\nkill %sleep\\ 1\nwait %5; echo $?\n", "143\n"},
+	})
+
+	tests := []struct {
+		spec, err string
+	}{
+		{"%9", "wait: %9: no such job\n"},
+		{"%sh", "wait: %sh: ambiguous job spec\n"},
+		{"%nope", "wait: %nope: no such job\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, errOut, _ := runScript(t, start+"wait "+tt.spec+"\n", "")
+			if errOut != tt.err {
+				t.Errorf("got %q, want %q", errOut, tt.err)
+			}
+		})
+	}
+}
+
+func TestKillZero(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"shell", "kill -0 $$ && echo there\n", "there\n"},
+		{"job", "sleep 0.5 &\nkill -0 %1 && kill -s 0 $! && echo there\n", "there\n"},
+		{"gone", "true &\nwait\nkill -0 $! 2>/dev/null; echo $?\n", "1\n"},
+		{"stopped job", "set -m\nsleep 0.5 &\nkill -STOP %1\nkill -0 %1\nsleep 0.1\njobs\nkill %1\n", "[1]+  Stopped                 sleep 0.5 &\n"},
+	})
+}
+
+func TestMonitorMode(t *testing.T) {
+	pg := "pg() { cut -d' ' -f5 /proc/$1/stat; }\n"
+	runScriptTests(t, []scriptTest{
+		{"off in scripts", pg + "sleep 0.2 & [ \"$(pg $!)\" = \"$(pg $$)\" ] && echo shared\n", "shared\n"},
+		{"on", pg + "set -m\nsleep 0.2 & [ \"$(pg $!)\" = \"$!\" ] && echo own\n", "own\n"},
+		{"off again", pg + "set -m\nset +m\nsleep 0.2 & [ \"$(pg $!)\" = \"$(pg $$)\" ] && echo shared\n", "shared\n"},
+		{"no fg or bg", "sleep 0.2 &\nfg 2>&1; echo $?\nbg 2>&1; echo $?\n", "fg: no job control\n1\nbg: no job control\n1\n"},
+	})
+}
+
+func TestBgFg(t *testing.T) {
+	stopper := "printf '#!/bin/sh\\nkill -STOP $$\\necho resumed\\n' >stop.sh\nchmod +x stop.sh\n"
+	runScriptTests(t, []scriptTest{
+		{"bg a background job", "set -m\nsleep 0.3 &\nkill -STOP %1\nsleep 0.1\nbg\nwait\n", "[1]+ sleep 0.3 &\n"},
+		{"fg a background job", "set -m\nsleep 0.2 &\nfg\necho $?\n", "sleep 0.2\n0\n"},
+		{"bg a stopped command", stopper + "set -m\n./stop.sh 2>/dev/null\nbg\nwait\n", "[1]+ ./stop.sh &\nresumed\n"},
+		{"fg a stopped command", stopper + "set -m\n./stop.sh 2>/dev/null\nfg\n", "./stop.sh\nresumed\n"},
+	})
+}
+
+func TestMonitorOffQuiet(t *testing.T) {
+	sh := startPtyShell(t)
+	sh.send("set +m; sleep 0.1 &\r")
+	sh.expect("[1] ")
+	time.Sleep(300 * time.Millisecond)
+	sh.send("echo next-$((6 * 7))\r")
+	if out := sh.expect("next-42\r\n"); strings.Contains(out, "Done") {
+		t.Errorf("the finished job was reported: %q", out)
+	}
+}
+
+func TestNotifyRightAway(t *testing.T) {
+	sh := startPtyShell(t)
+	sh.send("set -b; sleep 0.1 &\r")
+	sh.expect("[1] ")
+
+	// It's reported with no further key pressed, before the next prompt
+	sh.expect("[1]+  Done                    sleep 0.1\r\n")
+}
+
+func TestWaitNext(t *testing.T) {
+	start := "sh -c 'sleep 1; exit 3' &\nlong=$!\nsh -c 'sleep 0.1; exit 5' &\n"
+	runScriptTests(t, []scriptTest{
+		{"shorter first", start + "wait -n; echo $?\nkill -0 $long && echo still running\nwait -n; echo $?\n", "5\nstill running\n3\n"},
+		{"no jobs", "wait -n; echo $?\n", "127\n"},
+		{"all done", "true &\nwait\nwait -n; echo $?\n", "127\n"},
+		{"finished already", "sh -c 'exit 4' &\nsleep 0.2\nwait -n; echo $?\n", "4\n"},
+	})
+}
+
+func TestCoproc(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"round trip", "coproc UP { tr a-z A-Z; }\necho hello >&${UP[1]}\neval \"exec ${UP[1]}>&-\"\necho \"got $(head -n 1 <&${UP[0]})\"\nwait $UP_PID\necho \"done $?\"\n", "got HELLO\ndone 0\n"},
+		{"line at a time", "coproc { sed -u 's/^/> /'; }\necho one >&${COPROC[1]}\nhead -n 1 <&${COPROC[0]}\necho two >&${COPROC[1]}\nhead -n 1 <&${COPROC[0]}\n", "> one\n> two\n"},
+		{"descriptors", "coproc C { cat; }\necho ${C[@]}\n[ \"$C_PID\" -gt 0 ] && echo pid\n", "63 62\npid\n"},
+		{"no free descriptors", "for i in $(seq 28); do coproc C { cat; }; done 2>err.txt\necho $?\ncat err.txt\n", "1\ncoproc: no free file descriptor\n"},
+		{"exec after", "coproc C { cat; }\nexec 3>log.txt && echo a >&3 && exec 4>&3\necho b >&4\nf() { exec 5>>log.txt; }\nf\necho c >&5\nfor i in 1 2; do [ $i = 1 ] && exec 6>>log.txt || echo d >&6; done\ncat log.txt\n", "a\nb\nc\nd\n"},
+	})
+}
+
+func TestSuspend(t *testing.T) {
+	tests := []struct {
+		name   string
+		arg0   string
+		script string
+		stops  bool
+		want   string
+	}{
+		{"stops", "gosh", "suspend\necho resumed $?\n", true, "resumed 0\n"},
+		{"login shell", "-gosh", "suspend 2>&1\necho $?\n", false, "suspend: cannot suspend a login shell\n1\n"},
+		{"forced login shell", "-gosh", "suspend -f\necho resumed $?\n", true, "resumed 0\n"},
+		{"bad option", "gosh", "suspend -x 2>/dev/null\necho $?\n", false, "2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := goshCommand(t.TempDir())
+			cmd.Args[0] = tt.arg0
+			cmd.Stdin = strings.NewReader(tt.script)
+			var out bytes.Buffer
+			cmd.Stdout = &out
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The shell stops itself with a SIGSTOP, for its parent to see
+			// with WUNTRACED, and carries on once continued
+			pid := cmd.Process.Pid
+			var ws syscall.WaitStatus
+			done := make(chan error, 1)
+			go func() {
+				_, err := syscall.Wait4(pid, &ws, syscall.WUNTRACED, nil)
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				cmd.Process.Kill()
+				t.Fatal("timed out waiting for the shell")
+			}
+			if ws.Stopped() != tt.stops {
+				t.Fatalf("stopped: got %v, want %v (status %v)", ws.Stopped(), tt.stops, ws)
+			}
+			if ws.Stopped() {
+				if sig := ws.StopSignal(); sig != syscall.SIGSTOP {
+					t.Errorf("stopped by %v, want SIGSTOP", sig)
+				}
+				syscall.Kill(pid, syscall.SIGCONT)
+			}
+
+			// A shell that exited was reaped above, and only has its output left
+			// for Wait to collect
+			cmd.Wait()
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
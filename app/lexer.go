@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// incompleteError reports input that ends inside a quote, a command
+// substitution or right after a line continuation. Reading more lines may
+// complete it.
+type incompleteError struct {
+	want string // the closing text the lexer was looking for
+}
+
+func (e *incompleteError) Error() string {
+	if e.want == "" {
+		return "syntax error: unexpected end of file"
+	}
+	return fmt.Sprintf("unexpected EOF while looking for matching `%s'", e.want)
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokRedirect
+	tokOp
+)
+
+// token is a single lexical unit of the command line. Words keep their raw
+// text, quotes included, so that quote removal can happen at expansion time.
+type token struct {
+	kind tokenKind
+	text string
+	fd   int // explicit file descriptor before a redirection, -1 if none
+
+	start, end int // position of the token in the input, in runes
+
+	aliases []string // the aliases the token was expanded from, if any
+}
+
+// isKeyword reports whether the token is one of the reserved words, which
+// only count as such when unquoted and in place of a command name.
+func (t token) isKeyword(words ...string) bool {
+	return t.kind == tokWord && slices.Contains(words, t.text)
+}
+
+// reservedWords are the words that open or delimit compound commands.
+var reservedWords = []string{"if", "then", "elif", "else", "fi", "while", "until", "for", "select", "do", "done", "case", "esac", "{", "}", "[[", "]]", "coproc"}
+
+// tokenize splits the raw command line into words and operators.
+func tokenize(rawCmd string) ([]token, error) {
+	var (
+		tokens          []token
+		cur             strings.Builder
+		curStart        int
+		curQuoted       bool
+		seenSingleQuote bool
+		seenDoubleQuote bool
+	)
+
+	runes := []rune(rawCmd)
+	i := 0
+	flush := func() {
+		if cur.Len() > 0 || curQuoted {
+			tokens = append(tokens, token{kind: tokWord, text: cur.String(), fd: -1, start: curStart, end: i})
+		}
+		cur = strings.Builder{}
+		curQuoted = false
+	}
+
+	for ; i < len(runes); i++ {
+		r := runes[i]
+		if cur.Len() == 0 && !curQuoted {
+			curStart = i
+		}
+
+		if seenSingleQuote {
+			if r == '\'' {
+				seenSingleQuote = false
+			}
+			cur.WriteRune(r)
+			continue
+		}
+
+		if seenDoubleQuote {
+			// A backslash-newline continues the string on the next line,
+			// leaving out both
+			if r == '\\' && i+1 < len(runes) && runes[i+1] == '\n' {
+				i++
+				continue
+			}
+			if r == '\\' && i+1 < len(runes) {
+				cur.WriteRune(r)
+				i++
+				cur.WriteRune(runes[i])
+				continue
+			}
+			if end, err := readSubst(runes, i); err != nil {
+				return nil, err
+			} else if end > i {
+				cur.WriteString(string(runes[i:end]))
+				i = end - 1
+				continue
+			}
+			if r == '"' {
+				seenDoubleQuote = false
+			}
+			cur.WriteRune(r)
+			continue
+		}
+
+		switch r {
+		case '\'':
+			seenSingleQuote = true
+			curQuoted = true
+			cur.WriteRune(r)
+
+		case '"':
+			seenDoubleQuote = true
+			curQuoted = true
+			cur.WriteRune(r)
+
+		case '\\':
+			// A trailing backslash continues the command on the next line
+			if i+1 >= len(runes) {
+				return nil, &incompleteError{}
+			}
+			i++
+			if runes[i] == '\n' {
+				continue
+			}
+			curQuoted = true
+			cur.WriteRune(r)
+			cur.WriteRune(runes[i])
+
+		case '$':
+			// $'...' is single-quoted once its escapes are interpreted
+			if i+1 < len(runes) && runes[i+1] == '\'' {
+				end := i + 2
+				for ; end < len(runes) && runes[end] != '\''; end++ {
+					if runes[end] == '\\' {
+						end++
+					}
+				}
+				if end >= len(runes) {
+					return nil, &incompleteError{want: "'"}
+				}
+				text, _ := expandEscapes(string(runes[i+2:end]), true)
+				cur.WriteString(quoteString(text))
+				curQuoted = true
+				i = end
+				continue
+			}
+
+			// $"..." would be translated with a message catalog, and is
+			// double-quoted without one
+			if i+1 < len(runes) && runes[i+1] == '"' {
+				continue
+			}
+
+			end, err := readSubst(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			cur.WriteString(string(runes[i:max(end, i+1)]))
+			i = max(end, i+1) - 1
+
+		case ' ', '\t':
+			flush()
+
+		case '#':
+			// A "#" starting a word starts a comment, up to the end of the
+			// line
+			if cur.Len() > 0 || curQuoted {
+				cur.WriteRune(r)
+				continue
+			}
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+
+		case '\n', ';', '|', '(', ')':
+			flush()
+			op := readControlOp(runes, i)
+			tokens = append(tokens, token{kind: tokOp, text: op, fd: -1, start: i, end: i + len(op)})
+			i += len(op) - 1
+
+		case '>', '<', '&':
+			// A process substitution is part of a word
+			if r != '&' && i+1 < len(runes) && runes[i+1] == '(' {
+				end := matchBracket(runes, i+1)
+				if end < 0 {
+					return nil, &incompleteError{want: ")"}
+				}
+				cur.WriteString(string(runes[i : end+1]))
+				i = end
+				continue
+			}
+
+			op := readRedirectOp(runes, i)
+			if op == "" {
+				flush()
+				op = readControlOp(runes, i)
+				tokens = append(tokens, token{kind: tokOp, text: op, fd: -1, start: i, end: i + len(op)})
+				i += len(op) - 1
+				continue
+			}
+
+			// A word made only of digits right before the operator is the
+			// file descriptor it applies to, e.g. "2>".
+			fd := -1
+			if n, err := strconv.Atoi(cur.String()); err == nil && !curQuoted && op[0] != '&' {
+				fd = n
+				cur = strings.Builder{}
+			}
+			flush()
+
+			tokens = append(tokens, token{kind: tokRedirect, text: op, fd: fd, start: curStart, end: i + len(op)})
+			i += len(op) - 1
+
+		default:
+			cur.WriteRune(r)
+		}
+	}
+
+	if seenSingleQuote {
+		return nil, &incompleteError{want: "'"}
+	}
+	if seenDoubleQuote {
+		return nil, &incompleteError{want: `"`}
+	}
+	flush()
+
+	return tokens, nil
+}
+
+// redirectOps lists the redirection operators, longest first so that the
+// scan in readRedirectOp is greedy.
+var redirectOps = []string{"&>>", ">>", ">&", ">|", "&>", "<&", ">", "<"}
+
+// readSubst returns the index right after the "$(...)" or "${...}" starting
+// at runes[i], or i if there is none.
+func readSubst(runes []rune, i int) (int, error) {
+	if runes[i] != '$' || i+1 >= len(runes) || (runes[i+1] != '(' && runes[i+1] != '{') {
+		return i, nil
+	}
+
+	end := matchBracket(runes, i+1)
+	if end < 0 {
+		want := ")"
+		if runes[i+1] == '{' {
+			want = "}"
+		}
+		return i, &incompleteError{want: want}
+	}
+	return end + 1, nil
+}
+
+// controlOps lists the operators separating commands, longest first.
+var controlOps = []string{"&&", "||", "|&", ";;", ";", "&", "|", "(", ")", "\n"}
+
+// readRedirectOp returns the redirection operator starting at runes[i], or an
+// empty string if there is none.
+func readRedirectOp(runes []rune, i int) string {
+	return readOp(runes, i, redirectOps)
+}
+
+// readControlOp returns the control operator starting at runes[i].
+func readControlOp(runes []rune, i int) string {
+	return readOp(runes, i, controlOps)
+}
+
+func readOp(runes []rune, i int, ops []string) string {
+	for _, op := range ops {
+		if strings.HasPrefix(string(runes[i:min(i+len(op), len(runes))]), op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// matchBracket returns the index of the bracket closing the "(" or "{" at
+// runes[open], skipping over quoted text and nested substitutions. It
+// returns -1 if the input ends first.
+func matchBracket(runes []rune, open int) int {
+	openCh, closeCh := runes[open], ')'
+	if openCh == '{' {
+		closeCh = '}'
+	}
+
+	depth := 0
+	for i := open; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+
+		case '\'':
+			for i++; i < len(runes) && runes[i] != '\''; i++ {
+			}
+			if i >= len(runes) {
+				return -1
+			}
+
+		case '"':
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					i++
+				} else if runes[i] == '$' && i+1 < len(runes) && (runes[i+1] == '(' || runes[i+1] == '{') {
+					if i = matchBracket(runes, i+1); i < 0 {
+						return -1
+					}
+				}
+			}
+			if i >= len(runes) {
+				return -1
+			}
+
+		case openCh:
+			depth++
+
+		case closeCh:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
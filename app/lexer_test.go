@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestComments(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"shebang", "#!/bin/sh\necho hi\n", "hi\n"},
+		{"after a command", "echo hi # note\n", "hi\n"},
+		{"quote in a comment", "echo hi # it's here\necho there\n", "hi\nthere\n"},
+		{"inside words", "echo a#b \"#q\" '#s' \\#e $#\n", "a#b #q #s #e 0\n"},
+		{"in compound commands", "case x in # c\n x) echo X;; # c\nesac\nf() { # c\n echo f; }\nf\n", "X\nf\n"},
+	})
+}
+
+func TestQuotedOperators(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{";", "echo \"a;b\"; echo 'c;d'; echo e\\;f\n", "a;b\nc;d\ne;f\n"},
+		{"&&", "echo \"a&&b\" && echo 'c&&d' && echo e\\&\\&f\n", "a&&b\nc&&d\ne&&f\n"},
+		{"||", "echo \"a||b\" || echo no; false || echo 'c||d' e\\|\\|f\n", "a||b\nc||d e||f\n"},
+		{"|", "echo \"a|b\" | cat; echo 'c|d' e\\|f | tr a-z A-Z\n", "a|b\nC|D E|F\n"},
+		{"&", "echo \"a&b\" 'c&d' e\\&f & wait\n", "a&b c&d e&f\n"},
+		{"within a word", "echo \"x;\"y'&&'z\\|\n", "x;y&&z|\n"},
+	})
+}
+
+func TestLineContinuation(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"double quotes", "echo \"a\\\nb\"\n", "ab\n"},
+		{"unquoted", "echo a\\\nb\n", "ab\n"},
+		{"single quotes", "echo 'a\\\nb'\n", "a\\\nb\n"},
+		{"between parameters", "x=1\necho \"$x\\\n$x\"\n", "11\n"},
+		{"in a substitution", "echo \"$(echo \"c\\\nd\")\"\n", "cd\n"},
+		{"other backslashes", "echo \"\\$x \\\" \\\\ \\a \\`\"\n", "$x \" \\ \\a `\n"},
+		{"escaped backslash", "echo \"a\\\\\"\necho b\n", "a\\\nb\n"},
+	})
+}
+
+func TestAnsiCQuotes(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"newline and tab", "echo $'line1\\nline2\\ttabbed'\n", "line1\nline2\ttabbed\n"},
+		{"hex", "echo $'\\x41\\x42c'\n", "ABc\n"},
+		{"octal", "echo $'\\101\\0101' | od -An -c | tr -s ' '\n", " A \\b 1 \\n\n"},
+		{"unicode", "echo $'\\u00e9\\U0001F600'\n", "é😀\n"},
+		{"quotes and backslashes", "echo $'\\\\ \\' \\\"'\n", "\\ ' \"\n"},
+		{"control characters", "printf %s $'a\\rb\\ec' | od -An -c | tr -s ' '\n", " a \\r b 033 c\n"},
+		{"no expansion", "x=1\necho $'$x `x` $(x)'\n", "$x `x` $(x)\n"},
+		{"part of a word", "echo a$'b c'd \"$'q'\"\n", "ab cd $'q'\n"},
+	})
+}
+
+func TestLocaleQuotes(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"expanded", "[ $\"$HOME\" = \"$HOME\" ] && echo same\n", "same\n"},
+		{"not split", "x='a  b'\necho $\"[$x]\"\n", "[a  b]\n"},
+		{"quotes inside", "echo $\"it's\"\n", "it's\n"},
+		{"part of a word", "echo a$\"b c\"d\n", "ab cd\n"},
+		{"single-quoted", "echo '$\"no\"'\n", "$\"no\"\n"},
+	})
+}
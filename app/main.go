@@ -2,254 +2,239 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
-var specialChars = []rune{'"', '\\'}
-
-type Command struct {
-	Exec string
-	Args []string
+// isTerminal reports whether f is connected to a terminal. Other character
+// devices, like /dev/null, don't count.
+func isTerminal(f *os.File) bool {
+	var t syscall.Termios
+	return ioctlTermios(int(f.Fd()), syscall.TCGETS, &t) == nil
 }
 
-// parseCommand parses the command given to the prompt.
-func parseCommand(rawCmd string) *Command {
-	var (
-		tokens          []string
-		prev            rune
-		cur             strings.Builder
-		seenSingleQuote bool
-		seenDoubleQuote bool
-	)
-
-	// Handle special characters, single, and double quotes
-	runes := []rune(rawCmd)
-	for i := 0; i < len(runes); {
-		switch runes[i] {
-		case '\'':
-			if seenDoubleQuote {
-				cur.WriteRune(runes[i])
-			} else {
-				seenSingleQuote = !seenSingleQuote
-			}
-
-		case '"':
-			if seenSingleQuote {
-				cur.WriteRune(runes[i])
-			} else {
-				seenDoubleQuote = !seenDoubleQuote
-			}
-
-		case '\\':
-			if !seenSingleQuote && i+1 < len(runes) && slices.Contains(specialChars, runes[i]) {
-				i++
-			}
-
-			cur.WriteRune(runes[i])
+// lineReader reads a line of input, without its newline, after printing the
+// prompt when reading interactively.
+type lineReader func(prompt string) (string, error)
+
+// readLines returns a lineReader reading from a plain input, without any
+// prompt.
+func readLines(reader *bufio.Reader) lineReader {
+	return func(string) (string, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+}
 
-		case ' ':
-			seenQuote := seenDoubleQuote || seenSingleQuote
-			if seenQuote {
-				cur.WriteRune(runes[i])
-			} else if prev != ' ' && cur.Len() > 0 {
-				tokens = append(tokens, cur.String())
-				cur = strings.Builder{}
+// readCommand reads one complete command from the input, after the PS1
+// prompt. While the input is incomplete, e.g. a quote is left open, more
+// lines are read after the PS2 prompt.
+func readCommand(readLine lineReader, sh *Shell) (string, error) {
+	var input string
+	prompt := sh.ps1()
+	for {
+		line, err := readLine(prompt)
+		if err != nil {
+			if err == io.EOF && input != "" {
+				// The input ended in the middle of a command
+				_, err = sh.parse(input)
 			}
-
-		default:
-			cur.WriteRune(runes[i])
+			return "", err
 		}
 
-		prev = runes[i]
-		i++
-	}
+		if input == "" {
+			input = line
+		} else {
+			input += "\n" + line
+		}
 
-	if cur.Len() > 0 {
-		tokens = append(tokens, cur.String())
-	}
+		var incomplete *incompleteError
+		if _, err := sh.parse(input); !errors.As(err, &incomplete) {
+			return input, nil
+		}
 
-	tokensLen := len(tokens)
-	// Parsing failed, invalid command
-	if len(tokens) < 1 {
-		return nil
+		prompt = sh.ps2()
 	}
+}
 
-	cmd := &Command{
-		Exec: tokens[0],
-	}
-	if tokensLen > 1 {
-		cmd.Args = tokens[1:]
+// ps2 returns the prompt of the lines continuing a command.
+func (sh *Shell) ps2() string {
+	ps2, ok := sh.getVar("PS2")
+	if !ok {
+		ps2 = "> "
 	}
-
-	return cmd
+	return sh.expandPrompt(ps2)
 }
 
-func executeExitCmd(cmd *Command) {
-	if len(cmd.Args) <= 0 {
-		os.Exit(0)
-		return
+// continuationPrompt returns the PS2 prompt if the input is an incomplete
+// command, for the line editor to go on to another line.
+func (sh *Shell) continuationPrompt(input string) (string, bool) {
+	var incomplete *incompleteError
+	if _, err := sh.parse(input); !errors.As(err, &incomplete) {
+		return "", false
 	}
+	return sh.ps2(), true
+}
 
-	// Parse the exit code
-	exitCode, err := strconv.Atoi(cmd.Args[0])
+// sourceFile runs the commands of a file in the shell, returning the status
+// of the last one, or the one a return ends the file with.
+func (sh *Shell) sourceFile(path string) (int, error) {
+	f, err := os.Open(sh.path(path))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error reading exit code: ", err)
-		exitCode = 1
+		return 1, err
 	}
-	os.Exit(exitCode)
-}
+	defer f.Close()
 
-func executeEchoCmd(cmd *Command) {
-	fmt.Println(strings.Join(cmd.Args, " "))
-}
+	readLine := readLines(bufio.NewReader(f))
+	lineno, file := sh.lineno, sh.file
+	defer sh.pushFrame("source")()
+	sh.sourceDepth++
+	sh.file = path
+	defer func() {
+		sh.lineno, sh.file = lineno, file
+		sh.sourceDepth--
+	}()
 
-func getExecutablePath(file string) (string, error) {
-	// Look for executable files with "command" name
-	// Get the path
-	path, ok := os.LookupEnv("PATH")
-	if !ok {
-		fmt.Fprintf(os.Stderr, "'PATH' env is not set\n")
-		os.Exit(1)
-		return "", nil
-	}
-
-	// Get directory paths
-	dirs := strings.SplitSeq(path, string(os.PathListSeparator))
-	for dir := range dirs {
-		// Read the directory
-		entries, err := os.ReadDir(dir)
-		if err != nil && !os.IsNotExist(err) {
-			return "", fmt.Errorf("failed to read directory: %v", err)
+	status, line := 0, 1
+	for {
+		command, err := readCommand(readLine, sh)
+		if err == io.EOF {
+			return status, nil
+		}
+		if err != nil {
+			return 2, err
 		}
 
-		// Loop over directory items
-		for _, entry := range entries {
-			if entry.IsDir() { // Skip if directory, we need file
-				continue
-			}
-
-			info, err := entry.Info()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to get file info: %v\n", err)
-				continue
-			}
-
-			// Check if the file owner has executable permission on it
-			// and is the file that we are looking for
-			if entry.Name() == file && (info.Mode().Perm()&0100) != 0 {
-				return fmt.Sprintf("%v/%v", dir, file), nil
-			}
+		sh.lineno = line
+		line += strings.Count(command, "\n") + 1
+		status = sh.evaluateCommand(command)
+		if sh.returning {
+			sh.returning = false
+			return sh.returnStatus, nil
 		}
 	}
-
-	return "", fmt.Errorf("%s: not found", file)
 }
 
-func executeTypeCmd(cmd *Command) {
-	switch cmd.Args[0] {
-	case "exit", "echo", "type", "pwd", "cd":
-		fmt.Printf("%s is a shell builtin\n", cmd.Args[0])
-	default:
-		exePath, err := getExecutablePath(cmd.Args[0])
+func main() {
+	// With a script, the shell reads its commands from the script, with the
+	// arguments following it as the positional parameters
+	input, name, args := os.Stdin, os.Args[0], []string(nil)
+	if len(os.Args) > 1 {
+		name, args = os.Args[1], os.Args[2:]
+		f, err := os.Open(name)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			return
+			if os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "%s: No such file or directory\n", name)
+			} else {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+			}
+			os.Exit(127)
 		}
-
-		fmt.Printf("%v is %v\n", cmd.Args[0], exePath)
-	}
-}
-
-func executePwdCmd() {
-	curDir, err := os.Getwd()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		return
-	}
-
-	fmt.Println(curDir)
-}
-
-func executeCdCmd(cmd *Command) {
-	absPath, err := filepath.Abs(cmd.Args[0])
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		return
+		input = f
 	}
 
-	// Handle tilde (home directory)
-	if cmd.Args[0] == "~" {
-		absPath = os.Getenv("HOME")
-	}
-
-	if err := os.Chdir(absPath); err != nil {
-		if os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "cd: %v: No such file or directory\n", strings.Join(cmd.Args, " "))
-		} else {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-		}
+	interactive := input == os.Stdin && isTerminal(os.Stdin)
+	sh := newShell(interactive, name, args)
+	if input != os.Stdin {
+		sh.file = name
 	}
-}
-
-func runProgram(cmd *Command) bool {
-	_, err := getExecutablePath(cmd.Exec)
-	if err != nil {
-		if !strings.Contains(err.Error(), "not found") {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
+	sh.login = strings.HasPrefix(os.Args[0], "-")
+	if sh.dir != "" {
+		sh.exportVar("PWD", sh.dir)
+		if _, ok := sh.getVar("OLDPWD"); !ok {
+			sh.exportVar("OLDPWD", sh.dir)
 		}
-		return false
 	}
 
-	output, err := exec.Command(cmd.Exec, cmd.Args...).Output()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		return false
-	}
+	// Count this shell among those it runs within
+	level, _ := sh.getVar("SHLVL")
+	n, _ := strconv.Atoi(level)
+	sh.exportVar("SHLVL", strconv.Itoa(max(n, 0)+1))
 
-	fmt.Print(string(output))
-	return true
-}
+	initTerminal()
+	handleSignals(sh)
 
-func evaluateCommand(rawCmd string) {
-	cmd := parseCommand(rawCmd)
-	if cmd == nil {
-		os.Exit(0)
-		return
+	// A non-interactive shell first runs the startup file named by $BASH_ENV
+	// or $ENV, if there is one
+	if !interactive {
+		evalMu.Lock()
+		env, ok := sh.getVar("BASH_ENV")
+		if !ok {
+			env, _ = sh.getVar("ENV")
+		}
+		if path, err := sh.expandWord(env); err == nil && path != "" {
+			if _, err := os.Stat(sh.path(path)); err == nil {
+				if _, err := sh.sourceFile(path); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				}
+			}
+		}
+		evalMu.Unlock()
 	}
 
-	// Handle the "exit" builtin
-	if strings.HasPrefix(rawCmd, "exit") {
-		executeExitCmd(cmd)
-	} else if strings.HasPrefix(rawCmd, "echo") {
-		executeEchoCmd(cmd)
-	} else if strings.HasPrefix(rawCmd, "type") {
-		executeTypeCmd(cmd)
-	} else if rawCmd == "pwd" {
-		executePwdCmd()
-	} else if strings.HasPrefix(rawCmd, "cd") {
-		executeCdCmd(cmd)
-	} else if !runProgram(cmd) {
-		fmt.Println(rawCmd + ": command not found")
+	// At the terminal, lines are read with the line editor
+	readLine := readLines(bufio.NewReader(input))
+	if interactive {
+		readLine = newLineEditor(ttyFd, sh.completeWords, sh.continuationPrompt).readLine
 	}
-}
 
-func main() {
+	// Commands are numbered by the line of the input they start on
+	line := 1
 	for {
-		fmt.Fprint(os.Stdout, "$ ")
+		if interactive {
+			// Without job control, finished jobs go unreported
+			out := io.Writer(os.Stderr)
+			if !sh.opts.monitor {
+				out = io.Discard
+			}
+			notifyDoneJobs(out)
+		}
 
 		// Wait for user input
-		command, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		command, err := readCommand(readLine, sh)
+		if err == io.EOF {
+			sh.exit(sh.status)
+		}
+		if err == errInterrupted {
+			sh.status = 128 + int(syscall.SIGINT)
+			continue
+		}
+
+		var incomplete *incompleteError
+		if errors.As(err, &incomplete) {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			if incomplete.want != "" {
+				fmt.Fprintln(os.Stderr, "syntax error: unexpected end of file")
+			}
+			sh.exit(2)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Error reading input: ", err)
 			os.Exit(1)
 		}
 
-		evaluateCommand(command[:len(command)-1])
+		if interactive && strings.TrimSpace(command) != "" {
+			sh.recordHistory(command)
+		}
+
+		evalMu.Lock()
+		interruptFlag.Store(false)
+		sh.lineno = line
+		line += strings.Count(command, "\n") + 1
+		sh.evaluateCommand(command)
+		if interactive && interruptFlag.Load() {
+			// Start the prompt past the "^C" echoed by the terminal
+			fmt.Fprintln(os.Stdout)
+		}
+		sh.runPendingTraps()
+		evalMu.Unlock()
 	}
 }
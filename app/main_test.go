@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary stand in for gosh: when $GOSH_TEST_MAIN is
+// set, it runs the shell instead of the tests. The tests run their scripts
+// that way, in a process of their own.
+func TestMain(m *testing.M) {
+	if os.Getenv("GOSH_TEST_MAIN") != "" {
+		main()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// scriptTest is a script to run and the output it should print.
+type scriptTest struct {
+	name   string
+	script string
+	want   string
+}
+
+// runScriptTests runs each script, failing the test whose output differs.
+func runScriptTests(t *testing.T, tests []scriptTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _, _ := runScript(t, tt.script, "")
+			if out != tt.want {
+				t.Errorf("script:\n%s\ngot:\n%q\nwant:\n%q", tt.script, out, tt.want)
+			}
+		})
+	}
+}
+
+// runScript runs script in a new gosh process, with stdin as its input and
+// args as its positional parameters, and returns what it printed and its
+// exit status. It runs in a directory of its own, which is also $HOME.
+func runScript(t *testing.T, script, stdin string, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.sh")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := goshCommand(dir, append([]string{path}, args...)...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		status = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), status
+}
+
+// goshCommand returns the command to run gosh with args in dir. Scripts can
+// start another gosh as $GOSH.
+func goshCommand(dir string, args ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		switch name {
+		case "BASH_ENV", "ENV", "SHLVL", "CDPATH", "NO_COLOR", "GOSH_TEST_MAIN", "GOSH", "HOME", "PWD", "OLDPWD":
+			continue
+		}
+		cmd.Env = append(cmd.Env, kv)
+	}
+	cmd.Env = append(cmd.Env, "GOSH_TEST_MAIN=1", "GOSH="+os.Args[0], "HOME="+dir)
+	return cmd
+}
+
+func TestScriptArgs(t *testing.T) {
+	script := "echo $# $1 $2 $3\nfor arg in \"$@\"; do echo \"[$arg]\"; done\necho \"$*\"\necho ${0##*/}\n"
+	out, _, _ := runScript(t, script, "", "a", "b c", "d")
+	if want := "3 a b c d\n[a]\n[b c]\n[d]\na b c d\nscript.sh\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestShlvl(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"top level", "echo $SHLVL\n", "1\n"},
+		{"exported", "env | grep ^SHLVL=\n", "SHLVL=1\n"},
+		{"nested", "echo 'echo inner $SHLVL' >inner.sh\necho $SHLVL\n$GOSH inner.sh\necho \"$GOSH inner.sh\" >middle.sh\n$GOSH middle.sh\n", "1\ninner 2\ninner 3\n"},
+	})
+
+	cmd := goshCommand(t.TempDir())
+	cmd.Env = append(cmd.Env, "SHLVL=5")
+	cmd.Stdin = strings.NewReader("echo $SHLVL\n")
+	if out, err := cmd.Output(); err != nil || !strings.Contains(string(out), "6\n") {
+		t.Errorf("from SHLVL=5: got %q, %v", out, err)
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"env.sh":      "alias greet='echo hello from env'\n",
+		"bash_env.sh": "alias greet='echo hello from bash_env'\n",
+		"script.sh":   "greet\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		env  []string
+		want string
+	}{
+		{"ENV", []string{"ENV=env.sh"}, "hello from env\n"},
+		{"BASH_ENV first", []string{"ENV=env.sh", "BASH_ENV=" + filepath.Join(dir, "bash_env.sh")}, "hello from bash_env\n"},
+		{"expanded", []string{"ENV=$HOME/env.sh"}, "hello from env\n"},
+		{"missing", []string{"ENV=missing.sh"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := goshCommand(dir, "script.sh")
+			cmd.Env = append(cmd.Env, tt.env...)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, _ := cmd.Output()
+			if string(out) != tt.want {
+				t.Errorf("got %q, want %q", out, tt.want)
+			}
+			if tt.want == "" && stderr.String() != "greet: command not found\n" {
+				t.Errorf("with a missing file, got errors %q", stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// shellOptions are the shell behaviour options, toggled with set or shopt.
+type shellOptions struct {
+	dotglob    bool
+	errexit    bool
+	failglob   bool
+	globstar   bool
+	histappend bool // no effect, the history isn't saved to a file
+	monitor    bool // job control, each job in a process group of its own
+	nocaseglob bool
+	noclobber  bool
+	notify     bool // report finished background jobs right away
+	nullglob   bool
+	pipefail   bool
+	xpgEcho    bool
+}
+
+// shellOption describes an option of the set or shopt builtins.
+type shellOption struct {
+	name string
+	flag rune // short flag for "set -x", 0 if none
+	get  func(*shellOptions) *bool
+}
+
+var setOptions = []shellOption{
+	{name: "dotglob", get: func(o *shellOptions) *bool { return &o.dotglob }},
+	{name: "errexit", flag: 'e', get: func(o *shellOptions) *bool { return &o.errexit }},
+	{name: "failglob", get: func(o *shellOptions) *bool { return &o.failglob }},
+	{name: "globstar", get: func(o *shellOptions) *bool { return &o.globstar }},
+	{name: "monitor", flag: 'm', get: func(o *shellOptions) *bool { return &o.monitor }},
+	{name: "nocaseglob", get: func(o *shellOptions) *bool { return &o.nocaseglob }},
+	{name: "noclobber", flag: 'C', get: func(o *shellOptions) *bool { return &o.noclobber }},
+	{name: "notify", flag: 'b', get: func(o *shellOptions) *bool { return &o.notify }},
+	{name: "nullglob", get: func(o *shellOptions) *bool { return &o.nullglob }},
+	{name: "pipefail", get: func(o *shellOptions) *bool { return &o.pipefail }},
+}
+
+// shoptOptions are the options toggled with shopt. The globbing ones can be
+// toggled with "set -o" too.
+var shoptOptions = []shellOption{
+	{name: "dotglob", get: func(o *shellOptions) *bool { return &o.dotglob }},
+	{name: "failglob", get: func(o *shellOptions) *bool { return &o.failglob }},
+	{name: "globstar", get: func(o *shellOptions) *bool { return &o.globstar }},
+	{name: "histappend", get: func(o *shellOptions) *bool { return &o.histappend }},
+	{name: "nocaseglob", get: func(o *shellOptions) *bool { return &o.nocaseglob }},
+	{name: "nullglob", get: func(o *shellOptions) *bool { return &o.nullglob }},
+	{name: "xpg_echo", get: func(o *shellOptions) *bool { return &o.xpgEcho }},
+}
+
+func findOption(options []shellOption, name string) *shellOption {
+	for i := range options {
+		if options[i].name == name {
+			return &options[i]
+		}
+	}
+	return nil
+}
+
+func findSetFlag(flag rune) *shellOption {
+	for i := range setOptions {
+		if setOptions[i].flag == flag {
+			return &setOptions[i]
+		}
+	}
+	return nil
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func (sh *Shell) executeSetCmd(cmd *Command) int {
+	args := cmd.Args
+	setArgs := false // whether "--" ends the options
+	for len(args) > 0 {
+		arg := args[0]
+		if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+			break
+		}
+		args = args[1:]
+		if arg == "--" {
+			setArgs = true
+			break
+		}
+		enable := arg[0] == '-'
+
+		for _, flag := range arg[1:] {
+			if flag != 'o' {
+				opt := findSetFlag(flag)
+				if opt == nil {
+					fmt.Fprintf(cmd.Stderr, "set: %c%c: invalid option\n", arg[0], flag)
+					return 2
+				}
+				*opt.get(&sh.opts) = enable
+				continue
+			}
+
+			// Without an option name, list them all
+			if len(args) == 0 {
+				for _, opt := range setOptions {
+					if enable {
+						fmt.Fprintf(cmd.Stdout, "%-15s\t%s\n", opt.name, onOff(*opt.get(&sh.opts)))
+					} else {
+						fmt.Fprintf(cmd.Stdout, "set %co %s\n", "+-"[btoi(*opt.get(&sh.opts))], opt.name)
+					}
+				}
+				continue
+			}
+
+			opt := findOption(setOptions, args[0])
+			if opt == nil {
+				fmt.Fprintf(cmd.Stderr, "set: %s: invalid option name\n", args[0])
+				return 2
+			}
+			*opt.get(&sh.opts) = enable
+			args = args[1:]
+		}
+	}
+
+	// The remaining arguments replace the positional parameters
+	if setArgs || len(args) > 0 {
+		sh.args = slices.Clone(args)
+	}
+	return 0
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (sh *Shell) executeShoptCmd(cmd *Command) int {
+	args := cmd.Args
+	var set, unset, print, quiet, setStyle bool
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+
+		for _, c := range opt[1:] {
+			switch c {
+			case 's':
+				set = true
+			case 'u':
+				unset = true
+			case 'p':
+				print = true
+			case 'q':
+				quiet = true
+			case 'o':
+				setStyle = true
+			default:
+				fmt.Fprintf(cmd.Stderr, "shopt: -%c: invalid option\n", c)
+				fmt.Fprintln(cmd.Stderr, "shopt: usage: shopt [-pqsu] [-o] [optname ...]")
+				return 2
+			}
+		}
+	}
+	if set && unset {
+		fmt.Fprintln(cmd.Stderr, "shopt: cannot set and unset shell options simultaneously")
+		return 1
+	}
+
+	// With -o, the options are those of "set -o"
+	options := shoptOptions
+	if setStyle {
+		options = setOptions
+	}
+
+	opts := make([]*shellOption, 0, len(args))
+	for _, name := range args {
+		opt := findOption(options, name)
+		if opt == nil {
+			fmt.Fprintf(cmd.Stderr, "shopt: %s: invalid shell option name\n", name)
+			return 1
+		}
+		opts = append(opts, opt)
+	}
+
+	if (set || unset) && len(opts) > 0 {
+		for _, opt := range opts {
+			*opt.get(&sh.opts) = set
+		}
+		return 0
+	}
+
+	// Otherwise report the options named, or all of them, limited to those
+	// on with -s or off with -u
+	if len(args) == 0 {
+		for i := range options {
+			opts = append(opts, &options[i])
+		}
+	}
+	status := 0
+	for _, opt := range opts {
+		on := *opt.get(&sh.opts)
+		if (set && !on) || (unset && on) {
+			continue
+		}
+		if !on {
+			status = 1
+		}
+		switch {
+		case quiet:
+		case print && setStyle:
+			fmt.Fprintf(cmd.Stdout, "set %co %s\n", "+-"[btoi(on)], opt.name)
+		case print:
+			fmt.Fprintf(cmd.Stdout, "shopt -%c %s\n", "us"[btoi(on)], opt.name)
+		default:
+			fmt.Fprintf(cmd.Stdout, "%-15s\t%s\n", opt.name, onOff(on))
+		}
+	}
+	return status
+}
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestShopt(t *testing.T) {
+	files := "touch .hidden a.txt\n"
+	runScriptTests(t, []scriptTest{
+		{"nullglob", files + "shopt -s nullglob\necho a *.zzz b\nshopt -u nullglob\necho *.zzz\n", "a b\n*.zzz\n"},
+		{"dotglob", files + "echo *d*\nshopt -s dotglob\necho *d*\n", "*d*\n.hidden\n"},
+		{"several at once", "shopt -s nullglob dotglob\nshopt nullglob dotglob\n", "nullglob       \ton\ndotglob        \ton\n"},
+		{"shared with set -o", "shopt -s nocaseglob\nset -o | grep nocaseglob\nset +o nocaseglob\nshopt nocaseglob\n", "nocaseglob     \ton\nnocaseglob     \toff\n"},
+		{"-p", "shopt -s dotglob\nshopt -p dotglob globstar\n", "shopt -s dotglob\nshopt -u globstar\n"},
+		{"-q", "shopt -s nullglob\nshopt -q nullglob && echo on\nshopt -q dotglob || echo off\n", "on\noff\n"},
+		{"listing", "shopt | grep -E '^(dotglob|failglob) '\n", "dotglob        \toff\nfailglob       \toff\n"},
+		{"unknown", "shopt -s nosuch 2>/dev/null\necho $?\n", "1\n"},
+	})
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// isPlainParam reports whether the expression of a "${...}" expansion is
+// just a parameter, without any operator.
+func isPlainParam(expr string) bool {
+	if len(expr) == 1 && isSpecialParam(rune(expr[0])) {
+		return true
+	}
+	if _, err := strconv.Atoi(expr); err == nil {
+		return !strings.HasPrefix(expr, "-") && !strings.HasPrefix(expr, "+")
+	}
+	if _, _, ok := cutSubscript(expr); ok {
+		return true
+	}
+	return isName(expr)
+}
+
+// splitParam splits the expression of a "${...}" expansion into the
+// parameter and the operator applied to it.
+func splitParam(expr string) (string, string) {
+	i := 0
+	switch {
+	case expr == "":
+	case expr[0] >= '0' && expr[0] <= '9':
+		for i < len(expr) && expr[i] >= '0' && expr[i] <= '9' {
+			i++
+		}
+	case isSpecialParam(rune(expr[0])):
+		i = 1
+	default:
+		for i < len(expr) && isNameChar(rune(expr[i])) && (i > 0 || isNameStart(rune(expr[i]))) {
+			i++
+		}
+
+		// The subscript of an array element
+		if i > 0 && i < len(expr) && expr[i] == '[' {
+			if end := strings.IndexByte(expr[i:], ']'); end > 0 {
+				i += end + 1
+			}
+		}
+	}
+	return expr[:i], expr[i:]
+}
+
+// listParam returns the values of the expression of a "${...}" expansion
+// standing for a list: the positional parameters for "@" and "*", the
+// elements of an array for "NAME[@]" and "NAME[*]", or a range of either as
+// in "@:offset:length", or the indexes of an array for "!NAME[@]" and
+// "!NAME[*]". Along with them comes the "@" or "*" the list was
+// referenced with, or 0 if the expression isn't one of these.
+func (sh *Shell) listParam(expr string) ([]string, byte, error) {
+	// The indexes of the elements set, for "!NAME[@]" and "!NAME[*]"
+	if name, ok := strings.CutPrefix(expr, "!"); ok {
+		if array, sub, ok := cutSubscript(name); ok && (sub == "@" || sub == "*") {
+			return sh.arrayIndexes(array), sub[0], nil
+		}
+	}
+
+	name, op := splitParam(expr)
+
+	var (
+		values []string
+		kind   byte
+	)
+	if name == "@" || name == "*" {
+		values, kind = sh.args, name[0]
+
+		// Offset 0 of a range is $0
+		if op != "" {
+			values = append([]string{sh.name}, sh.args...)
+		}
+	} else if array, sub, ok := cutSubscript(name); ok && (sub == "@" || sub == "*") {
+		values, kind = sh.arrayElements(array), sub[0]
+	} else {
+		return nil, 0, nil
+	}
+
+	if op == "" {
+		return values, kind, nil
+	}
+	if !isSubstring(op) {
+		return nil, 0, nil
+	}
+	start, end, err := sh.substringRange(op[1:], len(values))
+	if err != nil {
+		return nil, kind, err
+	}
+	return values[start:end], kind, nil
+}
+
+// expandParam expands a "${...}" expansion whose expression applies an
+// operator to the parameter, like "${#NAME}".
+func (sh *Shell) expandParam(expr string) (string, error) {
+	// The length counts characters rather than bytes, and in a list like
+	// ${#@} or ${#NAME[@]}, the values
+	if name, ok := strings.CutPrefix(expr, "#"); ok && isPlainParam(name) {
+		if values, kind, _ := sh.listParam(name); kind != 0 {
+			return strconv.Itoa(len(values)), nil
+		}
+		value, _ := sh.getVar(name)
+		return strconv.Itoa(utf8.RuneCountInString(value)), nil
+	}
+
+	name, op := splitParam(expr)
+	if name == "" {
+		return "", fmt.Errorf("${%s}: bad substitution", expr)
+	}
+	value, set := sh.getVar(name)
+
+	switch {
+	case op != "" && strings.ContainsRune("-=?+", rune(op[0])),
+		len(op) > 1 && op[0] == ':' && strings.ContainsRune("-=?+", rune(op[1])):
+		return sh.expandDefault(name, value, set, op)
+
+	case isSubstring(op):
+		runes := []rune(value)
+		start, end, err := sh.substringRange(op[1:], len(runes))
+		if err != nil {
+			return "", err
+		}
+		return string(runes[start:end]), nil
+
+	case strings.HasPrefix(op, "#"), strings.HasPrefix(op, "%"):
+		longest := strings.HasPrefix(op, "##") || strings.HasPrefix(op, "%%")
+		word := op[1:]
+		if longest {
+			word = op[2:]
+		}
+		pattern, err := sh.expandPattern(word)
+		if err != nil {
+			return "", err
+		}
+		if op[0] == '#' {
+			return removePrefix(value, pattern, longest), nil
+		}
+		return removeSuffix(value, pattern, longest), nil
+
+	case strings.HasPrefix(op, "/"):
+		return sh.replacePattern(value, op[1:])
+	}
+
+	return "", fmt.Errorf("${%s}: bad substitution", expr)
+}
+
+// expandDefault applies the operator of a "${NAME-word}", "${NAME=word}",
+// "${NAME?word}" or "${NAME+word}" expansion, depending on whether the
+// parameter is set. With a colon before the operator, an empty value counts
+// as unset.
+func (sh *Shell) expandDefault(name, value string, set bool, op string) (string, error) {
+	colon := op[0] == ':'
+	if colon {
+		set = set && value != ""
+		op = op[1:]
+	}
+	if (op[0] == '+') != set {
+		return value, nil
+	}
+
+	word, err := sh.expandWord(op[1:])
+	if err != nil {
+		return "", err
+	}
+
+	switch op[0] {
+	case '=':
+		if !isName(name) {
+			return "", fmt.Errorf("$%s: cannot assign in this way", name)
+		}
+		if err := sh.assignVar(name, word); err != nil {
+			return "", err
+		}
+		word, _ = sh.getVar(name)
+	case '?':
+		switch {
+		case word != "":
+		case colon:
+			word = "parameter null or not set"
+		default:
+			word = "parameter not set"
+		}
+		err := fmt.Errorf("%s: %s", name, word)
+		if !sh.interactive || sh.subshell {
+			// Only the interactive shell carries on with the next command
+			fmt.Fprintln(sh.streams.Stderr, err)
+			sh.exit(1)
+		}
+		return "", err
+	}
+	return word, nil
+}
+
+// isSubstring reports whether an operator is a substring one, ":offset" or
+// ":offset:length", rather than one of ":-", ":=", ":?" and ":+".
+func isSubstring(op string) bool {
+	return strings.HasPrefix(op, ":") && (len(op) == 1 || !strings.ContainsRune("-=?+", rune(op[1])))
+}
+
+// substringRange evaluates the "offset" or "offset:length" arithmetic
+// expressions of a substring expansion, returning the range they select out
+// of n items. A negative offset counts back from the end and a negative
+// length stops that far before it, while offsets past either end select
+// nothing.
+func (sh *Shell) substringRange(spec string, n int) (int, int, error) {
+	offsetExpr, lengthExpr, hasLength := strings.Cut(spec, ":")
+	offset, err := sh.evalArithWord(offsetExpr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	start := int(offset)
+	if start < 0 {
+		start += n
+	}
+	if start < 0 || start > n {
+		return 0, 0, nil
+	}
+
+	end := n
+	if hasLength {
+		length, err := sh.evalArithWord(lengthExpr)
+		if err != nil {
+			return 0, 0, err
+		}
+		if length < 0 {
+			end = n + int(length)
+			if end < start {
+				return 0, 0, fmt.Errorf("%s: substring expression < 0", lengthExpr)
+			}
+		} else {
+			end = min(start+int(length), n)
+		}
+	}
+	return start, end, nil
+}
+
+// evalArithWord expands a raw word, then evaluates it as an arithmetic
+// expression.
+func (sh *Shell) evalArithWord(word string) (int64, error) {
+	expr, err := sh.expandWord(word)
+	if err != nil {
+		return 0, err
+	}
+	return sh.evalArith(expr)
+}
+
+// expandPattern expands the raw word of a pattern, as in "${NAME#pattern}",
+// with the glob characters of its quoted parts escaped.
+func (sh *Shell) expandPattern(word string) (string, error) {
+	frags, err := sh.expandFragments(word)
+	if err != nil {
+		return "", err
+	}
+	pattern, _ := globPattern(frags)
+	return pattern, nil
+}
+
+// removePrefix removes the shortest prefix of value matching the pattern, or
+// the longest one.
+func removePrefix(value, pattern string, longest bool) string {
+	runes := []rune(value)
+	for n := range len(runes) + 1 {
+		if longest {
+			n = len(runes) - n
+		}
+		if matchPattern(pattern, string(runes[:n])) {
+			return string(runes[n:])
+		}
+	}
+	return value
+}
+
+// removeSuffix removes the shortest suffix of value matching the pattern, or
+// the longest one.
+func removeSuffix(value, pattern string, longest bool) string {
+	runes := []rune(value)
+	for n := range len(runes) + 1 {
+		if !longest {
+			n = len(runes) - n
+		}
+		if matchPattern(pattern, string(runes[n:])) {
+			return string(runes[:n])
+		}
+	}
+	return value
+}
+
+// replacePattern performs the substitution of a "${NAME/pattern/string}"
+// expansion, given what follows its first "/". The longest match of the
+// pattern is replaced by the string, every one with a leading "/", or only
+// a match at the start or end of the value with a leading "#" or "%".
+func (sh *Shell) replacePattern(value, spec string) (string, error) {
+	mode := byte(0)
+	if spec != "" && strings.ContainsRune("/#%", rune(spec[0])) {
+		mode, spec = spec[0], spec[1:]
+	}
+	word, repWord := splitPatternWord(spec)
+	pattern, err := sh.expandPattern(word)
+	if err != nil {
+		return "", err
+	}
+	rep, err := sh.expandWord(repWord)
+	if err != nil {
+		return "", err
+	}
+	if pattern == "" {
+		return value, nil
+	}
+
+	runes := []rune(value)
+	switch mode {
+	case '#':
+		for n := len(runes); n >= 0; n-- {
+			if matchPattern(pattern, string(runes[:n])) {
+				return rep + string(runes[n:]), nil
+			}
+		}
+		return value, nil
+
+	case '%':
+		for n := range len(runes) + 1 {
+			if matchPattern(pattern, string(runes[n:])) {
+				return string(runes[:n]) + rep, nil
+			}
+		}
+		return value, nil
+	}
+
+	var out strings.Builder
+	replaced := false
+	for i := 0; i < len(runes); i++ {
+		if !replaced || mode == '/' {
+			if n := longestMatch(pattern, runes[i:]); n > 0 {
+				out.WriteString(rep)
+				i += n - 1
+				replaced = true
+				continue
+			}
+		}
+		out.WriteRune(runes[i])
+	}
+	return out.String(), nil
+}
+
+// longestMatch returns the length of the longest non-empty prefix of the
+// runes matching the pattern, or 0 if there is none.
+func longestMatch(pattern string, runes []rune) int {
+	for n := len(runes); n > 0; n-- {
+		if matchPattern(pattern, string(runes[:n])) {
+			return n
+		}
+	}
+	return 0
+}
+
+// splitPatternWord splits the raw "pattern/string" of a substitution at the
+// first "/" that isn't quoted, escaped or in a nested expansion.
+func splitPatternWord(spec string) (string, string) {
+	runes := []rune(spec)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+		case '\'', '"':
+			i = skipQuoted(runes, i)
+		case '$':
+			if end, _ := readSubst(runes, i); end > i {
+				i = end - 1
+			}
+		case '/':
+			return string(runes[:i]), string(runes[i+1:])
+		}
+	}
+	return spec, ""
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParamLength(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"value", "x=hello\necho ${#x}\n", "5\n"},
+		{"UTF-8 counts characters", "x=héllo\necho ${#x}\n", "5\n"},
+		{"unset", "echo ${#nope}\n", "0\n"},
+		{"empty", "x=\necho ${#x}\n", "0\n"},
+		{"positional count", "set -- a 'b c' d\necho ${#@} ${#*} ${#}\n", "3 3 3\n"},
+	})
+}
+
+func TestSubstring(t *testing.T) {
+	p := "p=/usr/local/bin\n"
+	runScriptTests(t, []scriptTest{
+		{"offset and length", p + "echo ${p:0:4}\n", "/usr\n"},
+		{"negative offset", p + "echo ${p: -3} ${p:(-3)}\n", "bin bin\n"},
+		{"to the end", p + "echo ${p:5}\n", "local/bin\n"},
+		{"negative length", p + "echo ${p:1:-4}\n", "usr/local\n"},
+		{"arithmetic", p + "n=2\necho ${p:n+3:n*2+1}\n", "local\n"},
+		{"offset past the end", p + "echo \"[${p:100}]\" \"[${p:20:2}]\"\n", "[] []\n"},
+		{"negative offset past the start", p + "echo \"[${p: -100}]\"\n", "[]\n"},
+		{"length past the end", p + "echo ${p:11:100}\n", "bin\n"},
+		{"UTF-8", "u=héllo\necho ${u:1:3}\n", "éll\n"},
+	})
+}
+
+func TestPatternRemoval(t *testing.T) {
+	f := "f=a.b.c\n"
+	runScriptTests(t, []scriptTest{
+		{"shortest suffix", f + "echo ${f%.*}\n", "a.b\n"},
+		{"longest suffix", f + "echo ${f%%.*}\n", "a\n"},
+		{"shortest prefix", f + "echo ${f#*.}\n", "b.c\n"},
+		{"longest prefix", f + "echo ${f##*.}\n", "c\n"},
+		{"no match", f + "echo ${f%x} ${f#x}\n", "a.b.c a.b.c\n"},
+		{"brackets and question marks", f + "echo ${f%[bc]} ${f%.?}\n", "a.b. a.b\n"},
+		{"paths", "p=/usr/local/bin\necho ${p#*/} ${p##*/} ${p%/*}\n", "usr/local/bin bin /usr/local\n"},
+		{"quoted pattern", "q='*.c'\ng=x.c\necho ${g%$q} \"${g%\"$q\"}\"\n", "x x.c\n"},
+	})
+}
+
+func TestPatternSubstitution(t *testing.T) {
+	s := "s='foo bar foo'\n"
+	runScriptTests(t, []scriptTest{
+		{"first", s + "echo ${s/foo/baz}\n", "baz bar foo\n"},
+		{"all", s + "echo ${s//foo/baz}\n", "baz bar baz\n"},
+		{"anchored at the start", s + "echo ${s/#foo/X} ${s/#bar/X}\n", "X bar foo foo bar foo\n"},
+		{"anchored at the end", s + "echo ${s/%foo/X} ${s/%bar/X}\n", "foo bar X foo bar foo\n"},
+		{"deletion", s + "echo \"${s//o/}\" \"${s/foo}\"\n", "f bar f  bar foo\n"},
+		{"patterns", s + "echo ${s//[ao]/_} ${s/o*/Z}\n", "f__ b_r f__ fZ\n"},
+		{"no match", s + "echo ${s/x/y}\n", "foo bar foo\n"},
+	})
+}
+
+func TestParamDefaults(t *testing.T) {
+	vars := "e=\ns=set\n"
+	runScriptTests(t, []scriptTest{
+		{"-", vars + "echo ${u-d} [${e-d}] ${s-d}\n", "d [] set\n"},
+		{":-", vars + "echo ${u:-d} ${e:-d} ${s:-d}\n", "d d set\n"},
+		{"=", vars + "echo ${u=d} [${e=d}] ${s=d}\necho $u [$e] $s\n", "d [] set\nd [] set\n"},
+		{":=", vars + "echo ${u:=d} ${e:=d} ${s:=d}\necho $u $e $s\n", "d d set\nd d set\n"},
+		{"+", vars + "echo [${u+a}] ${e+a} ${s+a}\n", "[] a a\n"},
+		{":+", vars + "echo [${u:+a}] [${e:+a}] ${s:+a}\n", "[] [] a\n"},
+		{"? when set", vars + "echo [${e?}] ${s?} ${s:?}\n", "[] set set\n"},
+		{":= of an expansion", "x=/tmp\necho ${u:=$x/a}\necho $u\n", "/tmp/a\n/tmp/a\n"},
+	})
+}
+
+func TestParamError(t *testing.T) {
+	tests := []struct {
+		name, script, err string
+	}{
+		{"? unset", "echo ${u?}", "u: parameter not set\n"},
+		{":? empty", "e=\necho ${e:?}", "e: parameter null or not set\n"},
+		{":? unset with a message", "echo ${u:?is $HOME}", "u: is "},
+		{"? empty is fine", "e=\necho ${e?} ${u?gone}", "u: gone\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errOut, status := runScript(t, tt.script+"\necho not reached\n", "")
+			if out != "" || !strings.HasPrefix(errOut, tt.err) || status != 1 {
+				t.Errorf("got %q, %q and status %d, want the error %q and status 1", out, errOut, status, tt.err)
+			}
+		})
+	}
+
+	// Only the command substitution exits
+	out, _, _ := runScript(t, "x=$(echo ${u:?}; echo no)\necho after $? [$x]\n", "")
+	if want := "after 1 []\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestParamErrorInteractive(t *testing.T) {
+	sh := startPtyShell(t)
+	sh.send("echo ${u:?oops}\r")
+	sh.expect("u: oops")
+	sh.send("echo alive $?\r")
+	sh.expect("alive 1")
+}
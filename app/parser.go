@@ -0,0 +1,1022 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Node is a parsed piece of shell input that the evaluator can run.
+type Node interface {
+	node()
+}
+
+// List is a sequence of and-or lists run one after the other, or in the
+// background when terminated by "&".
+type List struct {
+	Items []*AndOr
+}
+
+// AndOr is a chain of pipelines joined by "&&" and "||".
+type AndOr struct {
+	Pipelines  []*Pipeline
+	Ops        []string // Ops[i] joins Pipelines[i] and Pipelines[i+1]
+	Background bool
+	Source     string
+}
+
+// Pipeline is a sequence of commands, each one reading the output of the
+// previous one. A pipeline preceded by "!" is negated, succeeding when its
+// last command fails.
+type Pipeline struct {
+	Cmds   []Node
+	Negate bool
+	// PipeStderr[i] is set when command i is followed by "|&", which pipes
+	// its standard error along with its output
+	PipeStderr []bool
+	Source     string
+}
+
+// SimpleCommand is a command name with its arguments and redirections, as
+// raw words still to be expanded. The variable assignments preceding the
+// name apply to the command only, or to the shell without a command. Past
+// the name, words that look like assignments are plain arguments, though the
+// declaration builtins expand them like assignments.
+type SimpleCommand struct {
+	Line      int // line of the input the command starts on
+	Assigns   []string
+	Words     []string
+	Redirects []Redirect
+}
+
+// If runs the body of the first condition list that succeeds, or the Else
+// list when none does.
+type If struct {
+	Conds  []*List
+	Bodies []*List
+	Else   *List // nil without an "else" branch
+}
+
+// While runs its body for as long as its condition list succeeds.
+type While struct {
+	Cond *List
+	Body *List
+}
+
+// Until runs its body for as long as its condition list fails.
+type Until struct {
+	Cond *List
+	Body *List
+}
+
+// For runs its body once for every field its words expand to, with the
+// variable set to the field.
+type For struct {
+	Var   string
+	Words []string
+	Body  *List
+}
+
+// ArithFor runs its body for as long as its condition, an arithmetic
+// expression, is non-zero, as in "for (( init; cond; update ))". The init
+// expression is evaluated first, and the update one after every run of the
+// body. An empty condition is always true.
+type ArithFor struct {
+	Init, Cond, Update string
+	Body               *List
+}
+
+// Select runs its body for every choice read from a menu of the fields its
+// words expand to, with the variable set to the field chosen.
+type Select struct {
+	Var   string
+	Words []string
+	Body  *List
+}
+
+// Case runs the body of the first item with a pattern matching its word.
+type Case struct {
+	Word  string
+	Items []CaseItem
+}
+
+// CaseItem is one "pattern | pattern) list ;;" item of a case command.
+type CaseItem struct {
+	Patterns []string
+	Body     *List
+}
+
+// Group runs a list of commands in the current shell, as in "{ list; }".
+type Group struct {
+	Body *List
+}
+
+// Subshell runs a list of commands in a copy of the shell, as in "( list )",
+// which leaves the shell itself as it was.
+type Subshell struct {
+	Body *List
+}
+
+// Arith evaluates an arithmetic expression, as in "(( expr ))", succeeding
+// when its value is non-zero.
+type Arith struct {
+	Expr string
+}
+
+// Cond evaluates a conditional expression, as in "[[ expr ]]", succeeding
+// when it's true.
+type Cond struct {
+	Expr *CondExpr
+}
+
+// CondExpr is an expression of a conditional command: a test on raw words,
+// or the negation or combination of other expressions.
+type CondExpr struct {
+	Op          string // "!", "&&", "||", or a test operator, "" for a lone word
+	Left, Right *CondExpr
+	Words       []string // the operands of a test
+}
+
+// Coproc runs a command in the background as a coprocess, "coproc [name]
+// command", with its input and output connected to the shell through pipes.
+type Coproc struct {
+	Name   string
+	Body   Node
+	Source string
+}
+
+// FuncDef defines a function, "name() compound-command".
+type FuncDef struct {
+	Name   string
+	Body   Node
+	Source string
+}
+
+// Redirected is a compound command followed by redirections, which apply to
+// every command run within it.
+type Redirected struct {
+	Cmd       Node
+	Redirects []Redirect
+}
+
+func (*List) node()          {}
+func (*AndOr) node()         {}
+func (*Pipeline) node()      {}
+func (*SimpleCommand) node() {}
+func (*If) node()            {}
+func (*While) node()         {}
+func (*Until) node()         {}
+func (*For) node()           {}
+func (*ArithFor) node()      {}
+func (*Select) node()        {}
+func (*Case) node()          {}
+func (*Group) node()         {}
+func (*Subshell) node()      {}
+func (*Arith) node()         {}
+func (*Cond) node()          {}
+func (*Coproc) node()        {}
+func (*FuncDef) node()       {}
+func (*Redirected) node()    {}
+
+type parser struct {
+	tokens []token
+	pos    int
+	runes  []rune
+	line   int // number of the first line of the input
+
+	aliases map[string]string // the aliases to expand, by name
+}
+
+// parse parses a complete command line. If the input ends where more is
+// expected, e.g. right after "&&", an *incompleteError is returned.
+func parse(input string) (*List, error) {
+	return parseAt(input, 1)
+}
+
+// parseAt parses a command line like parse, numbering its lines from line.
+func parseAt(input string, line int) (*List, error) {
+	return parseAliased(input, line, nil)
+}
+
+// parse parses a command line the shell is about to run, with its aliases
+// expanded and its lines numbered from the current one.
+func (sh *Shell) parse(input string) (*List, error) {
+	return parseAliased(input, sh.lineno, sh.aliases)
+}
+
+// parseAliased parses a command line like parseAt, expanding the command
+// words that are one of aliases.
+func parseAliased(input string, line int, aliases map[string]string) (*List, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, runes: []rune(input), line: line, aliases: aliases}
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if !p.atEnd() {
+		return nil, p.unexpected()
+	}
+
+	return list, nil
+}
+
+func (p *parser) atEnd() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.atEnd() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+// isOp reports whether the next token is one of the operators ops.
+func (p *parser) isOp(ops ...string) bool {
+	if p.atEnd() {
+		return false
+	}
+	tok := p.tokens[p.pos]
+	for _, op := range ops {
+		if tok.kind == tokOp && tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+// isKeyword reports whether the next token is one of the reserved words.
+func (p *parser) isKeyword(words ...string) bool {
+	return !p.atEnd() && p.peek().isKeyword(words...)
+}
+
+func (p *parser) skipNewlines() {
+	for p.isOp("\n") {
+		p.pos++
+	}
+}
+
+// unexpected reports a syntax error at the next token. Running out of input
+// means the command is incomplete instead.
+func (p *parser) unexpected() error {
+	if p.atEnd() {
+		return &incompleteError{}
+	}
+
+	text := p.peek().text
+	if text == "\n" {
+		text = "newline"
+	}
+	return fmt.Errorf("syntax error near unexpected token `%s'", text)
+}
+
+// source returns the input text between two token positions.
+func (p *parser) source(from, to int) string {
+	if from >= to {
+		return ""
+	}
+	return strings.TrimSpace(string(p.runes[p.tokens[from].start:p.tokens[to-1].end]))
+}
+
+// parseList parses and-or lists up to the end of input or, within a compound
+// command, up to one of the reserved words or operators terminators.
+func (p *parser) parseList(terminators ...string) (*List, error) {
+	list := &List{}
+	for {
+		p.skipNewlines()
+		if p.atEnd() {
+			if len(terminators) > 0 {
+				return nil, p.unexpected()
+			}
+			return list, nil
+		}
+		if p.isKeyword(terminators...) || p.isOp(terminators...) {
+			if len(list.Items) == 0 {
+				return nil, p.unexpected()
+			}
+			return list, nil
+		}
+
+		andOr, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, andOr)
+
+		switch {
+		case p.isOp("&"):
+			andOr.Background = true
+			p.pos++
+		case p.isOp(terminators...):
+			// The end of a case item, right after its last command
+		case p.isOp(";", "\n"):
+			p.pos++
+		case p.isKeyword(terminators...):
+			// The end of a compound command, right after a nested one
+		case !p.atEnd():
+			return nil, p.unexpected()
+		}
+	}
+}
+
+func (p *parser) parseAndOr() (*AndOr, error) {
+	start := p.pos
+	andOr := &AndOr{}
+	for {
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		andOr.Pipelines = append(andOr.Pipelines, pipeline)
+
+		if !p.isOp("&&", "||") {
+			break
+		}
+		andOr.Ops = append(andOr.Ops, p.peek().text)
+		p.pos++
+		p.skipNewlines()
+	}
+
+	andOr.Source = p.source(start, p.pos)
+	return andOr, nil
+}
+
+func (p *parser) parsePipeline() (*Pipeline, error) {
+	start := p.pos
+	pipeline := &Pipeline{}
+	if p.isKeyword("!") {
+		pipeline.Negate = true
+		p.pos++
+	}
+	for {
+		cmd, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Cmds = append(pipeline.Cmds, cmd)
+
+		if !p.isOp("|", "|&") {
+			break
+		}
+		pipeline.PipeStderr = append(pipeline.PipeStderr, p.peek().text == "|&")
+		p.pos++
+		p.skipNewlines()
+	}
+
+	pipeline.Source = p.source(start, p.pos)
+	return pipeline, nil
+}
+
+// parseCommand parses either a compound command or a simple one: its words
+// and redirections up to the next control operator.
+func (p *parser) parseCommand() (Node, error) {
+	// An alias may stand for anything a command starts with, even a
+	// reserved word, or for nothing at all
+	if !p.atEnd() {
+		line := p.line + strings.Count(string(p.runes[:p.peek().start]), "\n")
+		n, err := p.expandAlias(p.pos)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 && (p.atEnd() || p.peek().kind == tokOp) {
+			return &SimpleCommand{Line: line}, nil
+		}
+	}
+
+	if p.isKeyword("coproc") {
+		return p.parseCoproc()
+	}
+	if p.isKeyword(reservedWords...) || p.isOp("(") {
+		return p.parseCompound()
+	}
+	if p.pos+2 < len(p.tokens) && p.peek().kind == tokWord && !isAssignment(p.peek().text) &&
+		p.tokens[p.pos+1].kind == tokOp && p.tokens[p.pos+1].text == "(" {
+		return p.parseFuncDef()
+	}
+
+	cmd := &SimpleCommand{Line: p.line + strings.Count(string(p.runes[:p.peek().start]), "\n")}
+	expanded := false
+	for !p.atEnd() {
+		tok := p.peek()
+		if tok.kind == tokOp {
+			break
+		}
+
+		if tok.kind == tokWord {
+			// The arguments of the declaration builtins may assign arrays
+			// too
+			if isAssignment(tok.text) && (len(cmd.Words) == 0 || slices.Contains(declarationBuiltins, cmd.Words[0])) {
+				assign, err := p.parseAssignment()
+				if err != nil {
+					return nil, err
+				}
+				if len(cmd.Words) == 0 {
+					cmd.Assigns = append(cmd.Assigns, assign)
+				} else {
+					cmd.Words = append(cmd.Words, assign)
+				}
+				continue
+			}
+
+			// The command word after assignments may be an alias too
+			if len(cmd.Words) == 0 && len(cmd.Assigns) > 0 && !expanded {
+				expanded = true
+				if _, err := p.expandAlias(p.pos); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			cmd.Words = append(cmd.Words, tok.text)
+			p.pos++
+			continue
+		}
+
+		redirects, err := p.parseRedirect()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Redirects = append(cmd.Redirects, redirects...)
+	}
+
+	if len(cmd.Assigns) == 0 && len(cmd.Words) == 0 && len(cmd.Redirects) == 0 {
+		return nil, p.unexpected()
+	}
+	return cmd, nil
+}
+
+// parseCoproc parses "coproc [name] command". Only a compound command can
+// follow a name, which is COPROC without one.
+func (p *parser) parseCoproc() (*Coproc, error) {
+	start := p.pos
+	p.pos++ // "coproc"
+	node := &Coproc{Name: "COPROC"}
+	if p.isCondWord(0) && isName(p.peek().text) && !p.peek().isKeyword(reservedWords...) && p.pos+1 < len(p.tokens) {
+		p.pos++
+		if p.isKeyword(reservedWords...) || p.isOp("(") {
+			node.Name = p.tokens[p.pos-1].text
+		} else {
+			p.pos--
+		}
+	}
+
+	body, err := p.parseCommand()
+	if err != nil {
+		return nil, err
+	}
+	node.Body = body
+	node.Source = p.source(start, p.pos)
+	return node, nil
+}
+
+// parseAssignment parses a variable assignment, including the elements of an
+// array assignment, "NAME=(word ...)", which are kept in their raw form.
+func (p *parser) parseAssignment() (string, error) {
+	tok := p.peek()
+	p.pos++
+	if !strings.HasSuffix(tok.text, "=") || !p.isOp("(") || p.peek().start != tok.end {
+		return tok.text, nil
+	}
+
+	open := p.pos
+	for p.pos++; !p.isOp(")"); p.pos++ {
+		if p.atEnd() {
+			return "", &incompleteError{}
+		}
+		if next := p.peek(); next.kind != tokWord && next.text != "\n" {
+			return "", p.unexpected()
+		}
+	}
+	p.pos++
+
+	return tok.text + string(p.runes[p.tokens[open].start:p.tokens[p.pos-1].end]), nil
+}
+
+// parseRedirect parses a redirection operator along with its target word.
+func (p *parser) parseRedirect() ([]Redirect, error) {
+	tok := p.peek()
+	p.pos++
+
+	// Every redirection operator needs a target word
+	if p.atEnd() || p.peek().kind != tokWord {
+		if p.atEnd() {
+			return nil, fmt.Errorf("syntax error near unexpected token `newline'")
+		}
+		return nil, p.unexpected()
+	}
+	target := p.peek().text
+	p.pos++
+
+	return parseRedirect(tok, target), nil
+}
+
+// parseCompound parses a compound command starting with a reserved word,
+// along with any redirections following it.
+func (p *parser) parseCompound() (Node, error) {
+	var (
+		cmd Node
+		err error
+	)
+	switch p.peek().text {
+	case "if":
+		cmd, err = p.parseIf()
+	case "while", "until":
+		cmd, err = p.parseWhile()
+	case "for", "select":
+		cmd, err = p.parseFor()
+	case "case":
+		cmd, err = p.parseCase()
+	case "(":
+		if p.isArithCommand() {
+			cmd, err = p.parseArith()
+			break
+		}
+		p.pos++
+		var body *List
+		if body, err = p.parseList(")"); err == nil {
+			p.pos++ // ")"
+			cmd = &Subshell{Body: body}
+		}
+	case "[[":
+		cmd, err = p.parseCond()
+	case "{":
+		p.pos++
+		var body *List
+		if body, err = p.parseList("}"); err == nil {
+			p.pos++ // "}"
+			cmd = &Group{Body: body}
+		}
+	default:
+		// A reserved word that only delimits a compound command
+		return nil, p.unexpected()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var redirects []Redirect
+	for !p.atEnd() && p.peek().kind == tokRedirect {
+		r, err := p.parseRedirect()
+		if err != nil {
+			return nil, err
+		}
+		redirects = append(redirects, r...)
+	}
+
+	if len(redirects) > 0 {
+		return &Redirected{Cmd: cmd, Redirects: redirects}, nil
+	}
+	return cmd, nil
+}
+
+// isArithCommand reports whether the next tokens open an arithmetic command,
+// "((" with nothing in between.
+func (p *parser) isArithCommand() bool {
+	return p.isOp("(") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokOp &&
+		p.tokens[p.pos+1].text == "(" && p.tokens[p.pos+1].start == p.peek().end
+}
+
+// parseArith parses "(( expr ))". The expression is kept as raw text, from
+// the input rather than the tokens it was split into.
+func (p *parser) parseArith() (*Arith, error) {
+	start := p.peek().end + 1
+	depth := 0
+	for i := start; i < len(p.runes); i++ {
+		switch p.runes[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if i+1 == len(p.runes) || p.runes[i+1] != ')' {
+				return nil, fmt.Errorf("syntax error near unexpected token `)'")
+			}
+
+			// Skip the tokens of the expression and the closing "))"
+			for !p.atEnd() && p.peek().start <= i+1 {
+				p.pos++
+			}
+			return &Arith{Expr: string(p.runes[start:i])}, nil
+		}
+	}
+	return nil, &incompleteError{}
+}
+
+// condUnaryOps and condBinaryOps list the test operators of conditional
+// expressions. "<" and ">" are read as redirection operators instead of
+// words.
+var (
+	condUnaryOps = []string{
+		"-a", "-b", "-c", "-d", "-e", "-f", "-g", "-h", "-k", "-n", "-o", "-p", "-r",
+		"-s", "-t", "-u", "-v", "-w", "-x", "-z", "-G", "-L", "-N", "-O", "-S",
+	}
+	condBinaryOps = []string{
+		"==", "=", "!=", "=~", "-eq", "-ne", "-lt", "-le", "-gt", "-ge", "-nt", "-ot", "-ef",
+	}
+)
+
+// parseCond parses "[[ expr ]]".
+func (p *parser) parseCond() (*Cond, error) {
+	p.pos++ // "[["
+	expr, err := p.parseCondLogical(false)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isKeyword("]]") {
+		return nil, p.condUnexpected()
+	}
+	p.pos++
+	return &Cond{Expr: expr}, nil
+}
+
+// parseCondLogical parses the expressions joined by "||", or with and set by
+// "&&", which binds tighter.
+func (p *parser) parseCondLogical(and bool) (*CondExpr, error) {
+	op, next := "||", func() (*CondExpr, error) { return p.parseCondLogical(true) }
+	if and {
+		op, next = "&&", p.parseCondNot
+	}
+
+	left, err := next()
+	for err == nil && p.isOp(op) {
+		p.pos++
+		var right *CondExpr
+		if right, err = next(); err == nil {
+			left = &CondExpr{Op: op, Left: left, Right: right}
+		}
+	}
+	return left, err
+}
+
+// parseCondNot parses a test, optionally negated by "!", or an expression
+// in parentheses. Newlines are allowed around them.
+func (p *parser) parseCondNot() (*CondExpr, error) {
+	p.skipNewlines()
+	defer p.skipNewlines()
+
+	switch {
+	case p.isKeyword("!"):
+		p.pos++
+		x, err := p.parseCondNot()
+		if err != nil {
+			return nil, err
+		}
+		return &CondExpr{Op: "!", Left: x}, nil
+
+	case p.isOp("("):
+		p.pos++
+		x, err := p.parseCondLogical(false)
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, p.condUnexpected()
+		}
+		p.pos++
+		return x, nil
+	}
+	return p.parseCondTest()
+}
+
+// parseCondTest parses a unary or binary test, or a lone word.
+func (p *parser) parseCondTest() (*CondExpr, error) {
+	if !p.isCondWord(0) {
+		return nil, p.condUnexpected()
+	}
+	word := p.peek().text
+	p.pos++
+
+	if slices.Contains(condUnaryOps, word) && p.isCondWord(0) {
+		operand := p.peek().text
+		p.pos++
+		return &CondExpr{Op: word, Words: []string{operand}}, nil
+	}
+
+	tok := p.peek()
+	isBinary := (tok.kind == tokWord && slices.Contains(condBinaryOps, tok.text)) ||
+		(tok.kind == tokRedirect && tok.fd < 0 && (tok.text == "<" || tok.text == ">"))
+	if p.atEnd() || !isBinary {
+		return &CondExpr{Words: []string{word}}, nil
+	}
+	p.pos++
+
+	if tok.text == "=~" {
+		if p.atEnd() {
+			return nil, &incompleteError{}
+		}
+		return &CondExpr{Op: tok.text, Words: []string{word, p.parseRegexWord()}}, nil
+	}
+	if !p.isCondWord(0) {
+		return nil, p.condUnexpected()
+	}
+	right := p.peek().text
+	p.pos++
+	return &CondExpr{Op: tok.text, Words: []string{word, right}}, nil
+}
+
+// isCondWord reports whether the token n positions ahead is a word of a
+// conditional expression, short of its closing "]]".
+func (p *parser) isCondWord(n int) bool {
+	if p.pos+n >= len(p.tokens) {
+		return false
+	}
+	tok := p.tokens[p.pos+n]
+	return tok.kind == tokWord && tok.text != "]]"
+}
+
+// parseRegexWord parses the regular expression right of "=~". It's taken
+// from the input up to the first unquoted blank outside parentheses, so that
+// the parentheses and "|" of the expression aren't read as operators.
+func (p *parser) parseRegexWord() string {
+	start := p.peek().start
+	i, depth := start, 0
+scan:
+	for ; i < len(p.runes); i++ {
+		switch p.runes[i] {
+		case '\\':
+			i++
+		case '\'':
+			for i++; i < len(p.runes) && p.runes[i] != '\''; i++ {
+			}
+		case '"':
+			for i++; i < len(p.runes) && p.runes[i] != '"'; i++ {
+				if p.runes[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				break scan
+			}
+			depth--
+		case ' ', '\t', '\n':
+			if depth == 0 {
+				break scan
+			}
+		}
+	}
+	end := min(i, len(p.runes))
+
+	for !p.atEnd() && p.peek().start < end {
+		p.pos++
+	}
+	return string(p.runes[start:end])
+}
+
+// condUnexpected reports a syntax error at the next token of a conditional
+// expression.
+func (p *parser) condUnexpected() error {
+	if p.atEnd() {
+		return &incompleteError{}
+	}
+	text := p.peek().text
+	if text == "\n" {
+		text = "newline"
+	}
+	return fmt.Errorf("syntax error in conditional expression: unexpected token `%s'", text)
+}
+
+// parseIf parses "if list; then list; [elif list; then list;]... [else
+// list;] fi".
+func (p *parser) parseIf() (*If, error) {
+	node := &If{}
+	for {
+		p.pos++ // "if" or "elif"
+		cond, err := p.parseList("then")
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		body, err := p.parseList("elif", "else", "fi")
+		if err != nil {
+			return nil, err
+		}
+		node.Conds = append(node.Conds, cond)
+		node.Bodies = append(node.Bodies, body)
+
+		if !p.isKeyword("elif") {
+			break
+		}
+	}
+
+	if p.isKeyword("else") {
+		p.pos++
+		list, err := p.parseList("fi")
+		if err != nil {
+			return nil, err
+		}
+		node.Else = list
+	}
+	p.pos++ // "fi"
+
+	return node, nil
+}
+
+// parseWhile parses "while list; do list; done", and the until loops alike.
+func (p *parser) parseWhile() (Node, error) {
+	keyword := p.peek().text
+	p.pos++
+	cond, err := p.parseList("do")
+	if err != nil {
+		return nil, err
+	}
+	p.pos++
+	body, err := p.parseDoBody()
+	if err != nil {
+		return nil, err
+	}
+
+	if keyword == "until" {
+		return &Until{Cond: cond, Body: body}, nil
+	}
+	return &While{Cond: cond, Body: body}, nil
+}
+
+// parseFor parses "for name [in word...;] do list; done", and the select
+// commands alike.
+func (p *parser) parseFor() (Node, error) {
+	keyword := p.peek().text
+	p.pos++
+	if keyword == "for" && p.isArithCommand() {
+		return p.parseArithFor()
+	}
+	if p.atEnd() || p.peek().kind != tokWord {
+		return nil, p.unexpected()
+	}
+	node := &For{Var: p.peek().text}
+	if !isName(node.Var) {
+		return nil, fmt.Errorf("`%s': not a valid identifier", node.Var)
+	}
+	p.pos++
+
+	p.skipNewlines()
+	if p.isKeyword("in") {
+		p.pos++
+		node.Words = []string{}
+		for !p.atEnd() && p.peek().kind == tokWord {
+			node.Words = append(node.Words, p.peek().text)
+			p.pos++
+		}
+		if !p.isOp(";", "\n") {
+			return nil, p.unexpected()
+		}
+		p.pos++
+	} else if p.isOp(";") {
+		p.pos++
+	}
+
+	p.skipNewlines()
+	if !p.isKeyword("do") {
+		return nil, p.unexpected()
+	}
+	p.pos++
+	body, err := p.parseDoBody()
+	if err != nil {
+		return nil, err
+	}
+	node.Body = body
+
+	if keyword == "select" {
+		return &Select{Var: node.Var, Words: node.Words, Body: node.Body}, nil
+	}
+	return node, nil
+}
+
+// parseCase parses "case word in [(]pattern [| pattern]...) list ;; ...
+// esac", where the last item may go without its ";;".
+func (p *parser) parseCase() (*Case, error) {
+	p.pos++ // "case"
+	if p.atEnd() || p.peek().kind != tokWord {
+		return nil, p.unexpected()
+	}
+	node := &Case{Word: p.peek().text}
+	p.pos++
+
+	p.skipNewlines()
+	if !p.isKeyword("in") {
+		return nil, p.unexpected()
+	}
+	p.pos++
+
+	for {
+		p.skipNewlines()
+		if p.isKeyword("esac") {
+			break
+		}
+
+		var item CaseItem
+		if p.isOp("(") {
+			p.pos++
+		}
+		for {
+			if p.atEnd() || p.peek().kind != tokWord {
+				return nil, p.unexpected()
+			}
+			item.Patterns = append(item.Patterns, p.peek().text)
+			p.pos++
+
+			if !p.isOp("|") {
+				break
+			}
+			p.pos++
+		}
+		if !p.isOp(")") {
+			return nil, p.unexpected()
+		}
+		p.pos++
+
+		p.skipNewlines()
+		item.Body = &List{}
+		if !p.isOp(";;") && !p.isKeyword("esac") {
+			body, err := p.parseList(";;", "esac")
+			if err != nil {
+				return nil, err
+			}
+			item.Body = body
+		}
+		node.Items = append(node.Items, item)
+
+		if !p.isOp(";;") {
+			break
+		}
+		p.pos++
+	}
+
+	p.skipNewlines()
+	if !p.isKeyword("esac") {
+		return nil, p.unexpected()
+	}
+	p.pos++ // "esac"
+
+	return node, nil
+}
+
+// parseFuncDef parses a function definition, "name() compound-command".
+func (p *parser) parseFuncDef() (*FuncDef, error) {
+	start := p.pos
+	name := p.peek().text
+	p.pos += 2
+	if !p.isOp(")") {
+		return nil, p.unexpected()
+	}
+	if strings.ContainsAny(name, "'\"\\$`=") {
+		return nil, fmt.Errorf("`%s': not a valid identifier", name)
+	}
+	p.pos++
+
+	// The body can only be a compound command
+	p.skipNewlines()
+	if !p.isKeyword(reservedWords...) && !p.isOp("(") {
+		return nil, p.unexpected()
+	}
+	body, err := p.parseCompound()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FuncDef{Name: name, Body: body, Source: p.source(start, p.pos)}, nil
+}
+
+// parseArithFor parses "for (( init; cond; update )); do list; done", after
+// the "for".
+func (p *parser) parseArithFor() (*ArithFor, error) {
+	header, err := p.parseArith()
+	if err != nil {
+		return nil, err
+	}
+	exprs := strings.Split(header.Expr, ";")
+	if len(exprs) != 3 {
+		return nil, fmt.Errorf("syntax error: arithmetic expression required")
+	}
+	node := &ArithFor{Init: exprs[0], Cond: exprs[1], Update: exprs[2]}
+
+	if p.isOp(";") {
+		p.pos++
+	}
+	p.skipNewlines()
+	if !p.isKeyword("do") {
+		return nil, p.unexpected()
+	}
+	p.pos++
+	if node.Body, err = p.parseDoBody(); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// parseDoBody parses the body of a loop, after the "do" and up to its "done".
+func (p *parser) parseDoBody() (*List, error) {
+	body, err := p.parseList("done")
+	if err != nil {
+		return nil, err
+	}
+	p.pos++ // "done"
+	return body, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// useColor reports whether the shell may color what it shows: only on a
+// terminal, and unless $NO_COLOR is set.
+func (sh *Shell) useColor() bool {
+	if noColor, _ := sh.getVar("NO_COLOR"); noColor != "" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// stripColors removes the color sequences, "\x1b[...m", from s.
+func stripColors(s string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "\x1b[")
+		if i < 0 {
+			break
+		}
+		end := i + 2
+		for end < len(s) && (s[end] == ';' || (s[end] >= '0' && s[end] <= '9')) {
+			end++
+		}
+		if end < len(s) && s[end] == 'm' {
+			b.WriteString(s[:i])
+			s = s[end+1:]
+		} else {
+			b.WriteString(s[:i+1])
+			s = s[i+1:]
+		}
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// ps1 returns the primary prompt, $PS1 with its escapes expanded, or "$ "
+// without one.
+func (sh *Shell) ps1() string {
+	ps1, ok := sh.getVar("PS1")
+	if !ok {
+		return "$ "
+	}
+	return sh.expandPrompt(ps1)
+}
+
+// expandPrompt expands the backslash escapes of a prompt string:
+//
+//	\u  the user name
+//	\h  the host name, up to the first "."
+//	\H  the host name
+//	\w  the working directory, with $HOME shown as "~"
+//	\W  the last element of the working directory
+//	\$  "#" for the superuser, "$" otherwise
+//	\s  the name of the shell
+//	\t  the time, as HH:MM:SS
+//	\n  a newline
+//	\e  an escape character, to start terminal sequences like colors
+//	\a  a bell character
+//	\nnn  the character with octal value nnn
+//	\\  a backslash
+//
+// \[ and \] enclose the characters that don't show, like color sequences.
+// The line editor doesn't need to know how wide the prompt shows, so they're
+// simply dropped. Color sequences are dropped too when the shell is to show
+// no color.
+func (sh *Shell) expandPrompt(ps string) string {
+	var b strings.Builder
+	for i := 0; i < len(ps); i++ {
+		if ps[i] != '\\' || i+1 == len(ps) {
+			b.WriteByte(ps[i])
+			continue
+		}
+
+		i++
+		switch c := ps[i]; c {
+		case 'u':
+			b.WriteString(sh.userName())
+		case 'h', 'H':
+			host, _ := os.Hostname()
+			if c == 'h' {
+				host, _, _ = strings.Cut(host, ".")
+			}
+			b.WriteString(host)
+		case 'w', 'W':
+			b.WriteString(sh.promptDir(c == 'W'))
+		case '$':
+			if os.Geteuid() == 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('$')
+			}
+		case 's':
+			b.WriteString(filepath.Base(sh.name))
+		case 't':
+			b.WriteString(time.Now().Format("15:04:05"))
+		case 'n':
+			b.WriteByte('\n')
+		case 'e':
+			b.WriteByte('\x1b')
+		case 'a':
+			b.WriteByte('\a')
+		case '\\':
+			b.WriteByte('\\')
+		case '[', ']':
+		default:
+			if n, width := escapeDigits(ps[i:], 3, 8); width == 3 {
+				b.WriteByte(byte(n))
+				i += width - 1
+				continue
+			}
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		}
+	}
+
+	if !sh.useColor() {
+		return stripColors(b.String())
+	}
+	return b.String()
+}
+
+// userName returns the name of the user running the shell.
+func (sh *Shell) userName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	name, _ := sh.getVar("USER")
+	return name
+}
+
+// promptDir returns the working directory as the prompt shows it, with
+// $HOME as "~", or only its last element with base set.
+func (sh *Shell) promptDir(base bool) string {
+	dir, ok := sh.getVar("PWD")
+	if !ok {
+		dir = sh.dir
+	}
+
+	if base && dir != "/" && sh.tildeDir(dir) != "~" {
+		return filepath.Base(dir)
+	}
+	return sh.tildeDir(dir)
+}
+
+// tildeDir returns a directory with $HOME at its start shown as "~".
+func (sh *Shell) tildeDir(dir string) string {
+	home, _ := sh.getVar("HOME")
+	home = strings.TrimSuffix(home, "/")
+	switch {
+	case home == "":
+		return dir
+	case dir == home:
+		return "~"
+	case strings.HasPrefix(dir, home+"/"):
+		return "~" + dir[len(home):]
+	}
+	return dir
+}
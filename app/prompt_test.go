@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestExpandPrompt(t *testing.T) {
+	sh := newShell(false, "/bin/gosh", nil)
+	sh.setVar("HOME", "/home/me")
+	sh.setVar("PWD", "/home/me/src/gosh")
+
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	short, _, _ := strings.Cut(host, ".")
+	dollar := "$"
+	if os.Geteuid() == 0 {
+		dollar = "#"
+	}
+
+	tests := []struct {
+		ps   string
+		want string
+	}{
+		{`\u`, u.Username},
+		{`\h`, short},
+		{`\H`, host},
+		{`\w`, "~/src/gosh"},
+		{`\W`, "gosh"},
+		{`\$ `, dollar + " "},
+		{`\s`, "gosh"},
+		{`a\nb`, "a\nb"},
+		{`\a`, "\a"},
+		{`\101\\`, `A\`},
+		{`\q\`, `\q\`},
+		{`\[\e[1;32m\]ok\[\e[0m\]`, "ok"}, // colors dropped, not on a terminal
+		{`\[x\]`, "x"},
+	}
+	for _, tt := range tests {
+		if got := sh.expandPrompt(tt.ps); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.ps, got, tt.want)
+		}
+	}
+
+	if got := sh.expandPrompt(`\t`); !regexp.MustCompile(`^\d\d:\d\d:\d\d$`).MatchString(got) {
+		t.Errorf(`\t: got %q`, got)
+	}
+}
+
+func TestPromptDir(t *testing.T) {
+	sh := newShell(false, "gosh", nil)
+	sh.setVar("HOME", "/home/me/")
+	tests := []struct {
+		dir      string
+		w, wBase string
+	}{
+		{"/home/me", "~", "~"},
+		{"/home/me/src", "~/src", "src"},
+		{"/home/meta", "/home/meta", "meta"},
+		{"/", "/", "/"},
+		{"/usr/lib", "/usr/lib", "lib"},
+	}
+	for _, tt := range tests {
+		sh.setVar("PWD", tt.dir)
+		if got := sh.expandPrompt(`\w \W`); got != tt.w+" "+tt.wBase {
+			t.Errorf("%s: got %q, want %q", tt.dir, got, tt.w+" "+tt.wBase)
+		}
+	}
+}
+
+func TestPromptColors(t *testing.T) {
+	_, tty := openPty(t)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+
+	const ps1 = `\[\e[1;32m\]ok\[\e[0m\] `
+	tests := []struct {
+		name    string
+		out     *os.File
+		noColor []string // the value of $NO_COLOR, if it's set
+		want    string
+	}{
+		{"terminal", tty, nil, "\x1b[1;32mok\x1b[0m "},
+		{"NO_COLOR", tty, []string{"1"}, "ok "},
+		{"empty NO_COLOR", tty, []string{""}, "\x1b[1;32mok\x1b[0m "},
+		{"pipe", w, nil, "ok "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh := newShell(false, "gosh", nil)
+			delete(sh.vars, "NO_COLOR")
+			for _, value := range tt.noColor {
+				sh.setVar("NO_COLOR", value)
+			}
+			os.Stdout = tt.out
+			got := sh.expandPrompt(ps1)
+			os.Stdout = stdout
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
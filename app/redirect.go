@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"syscall"
+)
+
+// Redirect describes a single redirection of one of the command's file
+// descriptors.
+type Redirect struct {
+	Fd     int    // file descriptor being redirected
+	Op     string // one of ">", ">>", "<", ">&" and "<&"
+	Target string // file name, or file descriptor for ">&" and "<&", "-" to close
+
+	// Both is set for ">&" without a file descriptor, which redirects both
+	// output streams to a file when the target isn't a file descriptor
+	Both bool
+}
+
+// closedFile stands for a standard stream closed with ">&-", which can't be
+// read from or written to.
+var closedFile = func() *os.File {
+	r, w, _ := os.Pipe()
+	r.Close()
+	w.Close()
+	return w
+}()
+
+// parseRedirect builds the redirections for operator tok and its target.
+// The combined "&>" and "&>>" operators expand into two redirections, exactly
+// like "> file 2>&1" and ">> file 2>&1".
+func parseRedirect(tok token, target string) []Redirect {
+	switch tok.text {
+	case "&>", "&>>":
+		return []Redirect{
+			{Fd: 1, Op: tok.text[1:], Target: target},
+			{Fd: 2, Op: ">&", Target: "1"},
+		}
+	}
+
+	fd := tok.fd
+	if fd < 0 {
+		fd = 1
+		if tok.text[0] == '<' {
+			fd = 0
+		}
+	}
+
+	return []Redirect{{Fd: fd, Op: tok.text, Target: target, Both: tok.text == ">&" && tok.fd < 0}}
+}
+
+// applyRedirects points the command's standard streams at the targets of
+// its redirections, in order. The returned function closes any opened files.
+// With noclobber set, ">" won't overwrite an existing file, unlike ">|".
+func (sh *Shell) applyRedirects(cmd *Command) (func(), error) {
+	var files []*os.File
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	for _, r := range cmd.Redirects {
+		var stream any
+
+		switch r.Op {
+		case ">", ">|", ">>", "<":
+			f, err := sh.openRedirect(r.Op, r.Target)
+			if err != nil {
+				closeFiles()
+				return nil, err
+			}
+			files = append(files, f)
+			stream = f
+
+		case ">&", "<&":
+			if r.Target == "-" {
+				cmd.closeStream(r.Fd)
+				continue
+			}
+
+			srcFd, err := strconv.Atoi(r.Target)
+			if err != nil && r.Both {
+				// Like "&> file"
+				f, err := sh.openRedirect(">", r.Target)
+				if err != nil {
+					closeFiles()
+					return nil, err
+				}
+				files = append(files, f)
+				cmd.Stdout, cmd.Stderr = f, f
+				continue
+			}
+			if err != nil {
+				closeFiles()
+				return nil, fmt.Errorf("%s: ambiguous redirect", r.Target)
+			}
+
+			stream = cmd.stream(srcFd)
+			if stream == nil {
+				closeFiles()
+				return nil, fmt.Errorf("%d: Bad file descriptor", srcFd)
+			}
+		}
+
+		if err := cmd.setStream(r.Fd, stream); err != nil {
+			closeFiles()
+			return nil, err
+		}
+	}
+
+	return closeFiles, nil
+}
+
+// openRedirect opens the file of a ">", ">|", ">>" or "<" redirection.
+func (sh *Shell) openRedirect(op, target string) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if op == ">>" {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	} else if op == "<" {
+		flags = os.O_RDONLY
+	}
+
+	if info, err := os.Stat(sh.path(target)); err == nil && info.Mode().IsRegular() && op == ">" && sh.opts.noclobber {
+		return nil, fmt.Errorf("%s: cannot overwrite existing file", target)
+	}
+
+	f, err := os.OpenFile(sh.path(target), flags, 0644)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: No such file or directory", target)
+	}
+	return f, err
+}
+
+// redirectShell points the shell's own file descriptors at the streams, for
+// the redirections of exec to outlast the command.
+func (sh *Shell) redirectShell(s Streams) error {
+	// Beyond the standard ones, the shell keeps copies of the files, since
+	// the originals are closed along with the command's redirections. The
+	// commands running share the shell's files, which are copied first.
+	files := maps.Clone(sh.streams.Files)
+	if files == nil {
+		files = make(map[int]*os.File)
+	}
+	var changed []int
+	defer func() { sh.setShellFiles(files, changed) }()
+	for fd, f := range s.Files {
+		if files[fd] == f {
+			continue
+		}
+		f, err := sh.keepFile(f)
+		if err != nil {
+			return err
+		}
+		if old, ok := files[fd]; ok {
+			sh.releaseFile(old)
+		}
+		files[fd] = f
+		changed = append(changed, fd)
+	}
+	for fd, f := range files {
+		if _, ok := s.Files[fd]; !ok {
+			sh.releaseFile(f)
+			delete(files, fd)
+			changed = append(changed, fd)
+		}
+	}
+
+	// A subshell shares the process with the shell, so its standard streams
+	// are its own to change rather than the process's
+	if sh.subshell {
+		for fd := range 3 {
+			stream := s.stream(fd)
+			if stream == sh.streams.stream(fd) {
+				continue
+			}
+			if f, ok := stream.(*os.File); ok && f != closedFile {
+				var err error
+				if stream, err = sh.keepFile(f); err != nil {
+					return err
+				}
+			}
+			if f, ok := sh.streams.stream(fd).(*os.File); ok {
+				sh.releaseFile(f)
+			}
+			sh.streams.setStream(fd, stream)
+			changed = append(changed, fd)
+		}
+		return nil
+	}
+
+	// Duplicate every source first, since they may be among the targets
+	srcs := []int{-1, -1, -1}
+	defer func() {
+		for _, src := range srcs {
+			if src >= 0 {
+				syscall.Close(src)
+			}
+		}
+	}()
+	for fd := range srcs {
+		if f, ok := s.stream(fd).(*os.File); ok && int(f.Fd()) != fd {
+			src, err := syscall.Dup(int(f.Fd()))
+			if err != nil {
+				return err
+			}
+			srcs[fd] = src
+		}
+	}
+
+	for fd, src := range srcs {
+		if src < 0 {
+			continue
+		}
+		if err := syscall.Dup2(src, fd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepFile returns a copy of f for the shell to keep open, past the command
+// whose redirection opened it. The copies a subshell keeps are closed as it
+// ends.
+func (sh *Shell) keepFile(f *os.File) (*os.File, error) {
+	dup, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(dup)
+	kept := os.NewFile(uintptr(dup), f.Name())
+	if sh.subshell {
+		sh.keptFiles = append(sh.keptFiles, kept)
+	}
+	return kept, nil
+}
+
+// releaseFile closes f, a file the shell no longer has open, unless it's
+// one a subshell got from the shell, which still has it.
+func (sh *Shell) releaseFile(f *os.File) {
+	if !sh.subshell || slices.Contains(sh.keptFiles, f) {
+		f.Close()
+	}
+}
+
+// setShellFiles makes files the shell's own descriptors past 2, with those
+// in changed opened or closed since the last ones.
+func (sh *Shell) setShellFiles(files map[int]*os.File, changed []int) {
+	sh.streams.Files = files
+	sh.fdChanges = append(sh.fdChanges, changed...)
+	sh.streams.gen = len(sh.fdChanges)
+}
+
+// withShellFiles returns s with the changes to the shell's own descriptors
+// made since s was set up, such as by an earlier exec, for the next command
+// to run with.
+func (sh *Shell) withShellFiles(s Streams) Streams {
+	if s.gen >= len(sh.fdChanges) {
+		return s
+	}
+	files := maps.Clone(s.Files)
+	if files == nil {
+		files = make(map[int]*os.File)
+	}
+	for _, fd := range sh.fdChanges[s.gen:] {
+		if fd <= 2 {
+			s.setStream(fd, sh.streams.stream(fd))
+			continue
+		}
+		if f, ok := sh.streams.Files[fd]; ok {
+			files[fd] = f
+		} else {
+			delete(files, fd)
+		}
+	}
+	s.Files = files
+	s.gen = len(sh.fdChanges)
+	return s
+}
+
+// stream returns the reader or writer currently behind file descriptor fd,
+// or nil if it isn't open.
+func (s *Streams) stream(fd int) any {
+	switch fd {
+	case 0:
+		return s.Stdin
+	case 1:
+		return s.Stdout
+	case 2:
+		return s.Stderr
+	}
+	if f, ok := s.Files[fd]; ok {
+		return f
+	}
+	return nil
+}
+
+// setStream points file descriptor fd at stream.
+func (s *Streams) setStream(fd int, stream any) error {
+	switch fd {
+	case 0:
+		if r, ok := stream.(io.Reader); ok {
+			s.Stdin = r
+			return nil
+		}
+	case 1:
+		if w, ok := stream.(io.Writer); ok {
+			s.Stdout = w
+			return nil
+		}
+	case 2:
+		if w, ok := stream.(io.Writer); ok {
+			s.Stderr = w
+			return nil
+		}
+	default:
+		// Only files can be handed down to programs, such as the pipe to
+		// the next stage of a pipeline
+		if w, ok := stream.(io.Writer); ok {
+			stream = unwrapPipe(w)
+		}
+		if f, ok := stream.(*os.File); ok && fd > 2 {
+			files := maps.Clone(s.Files)
+			if files == nil {
+				files = make(map[int]*os.File)
+			}
+			files[fd] = f
+			s.Files = files
+			return nil
+		}
+	}
+	return fmt.Errorf("%d: Bad file descriptor", fd)
+}
+
+// closeStream closes file descriptor fd.
+func (s *Streams) closeStream(fd int) {
+	if fd <= 2 {
+		s.setStream(fd, closedFile)
+		return
+	}
+	if _, ok := s.Files[fd]; ok {
+		s.Files = maps.Clone(s.Files)
+		delete(s.Files, fd)
+	}
+}
+
+// extraFiles returns the files open beyond the standard ones, indexed from
+// file descriptor 3, for a program to inherit.
+func (s *Streams) extraFiles() []*os.File {
+	var files []*os.File
+	for fd, f := range s.Files {
+		for len(files) <= fd-3 {
+			files = append(files, nil)
+		}
+		files[fd-3] = f
+	}
+	return files
+}
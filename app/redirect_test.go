@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestCombinedRedirect(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"builtin", "{ echo out; echo err >&2; } &> all.txt\ncat all.txt\n", "out\nerr\n"},
+		{"program", "sh -c 'echo out; echo err >&2' &> all.txt\ncat all.txt\n", "out\nerr\n"},
+		{"append", "echo one &> all.txt\n{ echo two; echo three >&2; } &>> all.txt\ncat all.txt\n", "one\ntwo\nthree\n"},
+	})
+}
+
+func TestFdRedirect(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"write fd 3", "exec 3>log.txt\necho hi >&3\necho there 1>&3\nexec 3>&-\ncat log.txt\n", "hi\nthere\n"},
+		{"closed fd", "exec 3>log.txt\nexec 3>&-\necho closed >&3 2>/dev/null\necho $?\n", "1\n"},
+		{"append", "echo one >log.txt\nexec 5>>log.txt\necho two >&5\ncat log.txt\n", "one\ntwo\n"},
+		{"read a custom fd", "printf 'a\\nb\\n' >in.txt\nexec 4<in.txt\nhead -n 1 <&4\nsh -c 'cat <&4'\n", "a\nb\n"},
+		{"for one command", "echo x >in.txt\ncat 6<in.txt <&6\ncat <&6 2>/dev/null || echo gone\n", "x\ngone\n"},
+		{"program into a pipe", "sh -c 'echo to fd 3 >&3' 3>&1 | tr a-z A-Z\n", "TO FD 3\n"},
+		{"group into a pipe", "{ echo group >&3; } 3>&1 | tr a-z A-Z\n", "GROUP\n"},
+		{"builtin into a pipe", "echo builtin >&3 3>&1 2>/dev/null | cat\n3>&1 echo builtin >&3 | cat\n", "builtin\n"},
+	})
+}
+
+func TestDanglingRedirect(t *testing.T) {
+	tests := []struct {
+		line, token string
+	}{
+		{"echo hi >", "newline"},
+		{"echo hi 2>", "newline"},
+		{"cat <", "newline"},
+		{"echo hi >>", "newline"},
+		{"echo hi >&", "newline"},
+		{"echo a > ; echo b", ";"},
+		{"echo a >> | cat", "|"},
+		{"cat < && echo b", "&&"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			out, errOut, _ := runScript(t, tt.line+"\necho $?\n", "")
+			if want := "syntax error near unexpected token `" + tt.token + "'\n"; out != "2\n" || errOut != want {
+				t.Errorf("got %q and %q, want status 2 and %q", out, errOut, want)
+			}
+		})
+	}
+}
+
+func TestDupRedirect(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"to stderr", "{ echo hi >&2; } 2>err.txt\necho stdout\ncat err.txt\necho hi >&2 2>/dev/null\n", "stdout\nhi\n"},
+		{"both outputs to a file", "{ echo out; echo err >&2; } >&both.txt\ncat both.txt\n", "out\nerr\n"},
+		{"file in a pipeline", "sh -c 'echo prog; echo perr >&2' >&p.txt | tr a-z A-Z\ncat p.txt\necho mid | { cat; echo e >&2; } >&m.txt | wc -l\ncat m.txt\n", "prog\nperr\n0\nmid\ne\n"},
+		{"fd 3 in a pipeline", "echo mid | { cat >&3; } 3>&1 | tr a-z A-Z\necho mid | sh -c 'cat >&3' 3>&1 | tr a-z A-Z\nf() { echo fn >&3; }\nf 3>&1 | cat\n", "MID\nMID\nfn\n"},
+		{"close stdout", "echo x >&- 2>/dev/null\necho $?\necho a 2>/dev/null >&- | cat\n", "1\n"},
+		{"close fd 3", "{ echo x >&3; } 3>&- 2>/dev/null\necho $?\nsh -c 'echo a >&3' 3>&- 2>/dev/null\necho $?\n", "1\n2\n"},
+		{"close stdin", "cat <&- 2>/dev/null\necho $?\n", "1\n"},
+		{"left to right", "echo a 2>&1 >out.txt | tr a-z A-Z\ncat out.txt\nsh -c 'echo e >&2' 2>&1 >/dev/null | tr a-z A-Z\n", "a\nE\n"},
+	})
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Streams are the standard input, output and error a command runs with.
+type Streams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Files holds the file descriptors open beyond the standard ones. It's
+	// shared between copies of the streams, and copied before any change.
+	Files map[int]*os.File
+
+	// gen is the number of changes to the shell's own descriptors that Files
+	// has taken in, out of those in the shell's fdChanges.
+	gen int
+}
+
+// stdStreams are the shell's own standard streams.
+var stdStreams = Streams{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr, Files: map[int]*os.File{}}
+
+// Shell holds the state of a shell session. Pipeline stages and background
+// jobs run on a copy of it.
+type Shell struct {
+	interactive bool
+	login       bool // started as a login shell, with a "-" before its name
+	status      int  // exit status of the last command
+	opts        shellOptions
+	vars        map[string]*variable
+	funcs       map[string]*FuncDef
+	traps       map[string]string    // commands set with trap, by signal name
+	aliases     map[string]string    // values of the aliases, by name
+	completions map[string]string    // word lists for "complete -W", by command
+	hashed      map[string]hashEntry // programs found in $PATH, by name
+	disabled    map[string]bool      // builtins turned off with "enable -n"
+	name        string               // name of the shell or script, as $0
+	args        []string             // positional parameters
+
+	// dir is the working directory. It's the shell's own rather than the
+	// process's, for cd in a subshell to leave the shell where it is, so
+	// relative paths are resolved against it with sh.path.
+	dir string
+
+	// streams are those the shell runs its own commands with, like those of
+	// its traps: the standard streams, or those a subshell was started with
+	streams Streams
+
+	// job is the job the commands run by this shell belong to. It's nil in
+	// the foreground shell, where every pipeline is a job of its own.
+	job *Job
+
+	lastBgPid int    // process group of the last background job
+	lastArg   string // last argument of the previous command, as $_
+
+	// subshell is set on the copies of the shell running pipeline stages,
+	// background jobs and command substitutions, which "exit" only ends
+	subshell bool
+
+	substStatus int // exit status of the last command substitution
+
+	// conditions is the number of conditions being run, like those of if
+	// statements and the commands before a "&&" or "||", whose failure
+	// doesn't make the shell exit with errexit
+	conditions int
+
+	// loops is the number of loops being run. A break or continue sets
+	// breaking or continuing to the number of loops it applies to, which
+	// unwind up to there.
+	loops      int
+	breaking   int
+	continuing int
+
+	// funcDepth is the number of functions being run. A return sets returning
+	// for them to unwind up to the function call, with the returned status.
+	funcDepth    int
+	returning    bool
+	returnStatus int
+	sourceDepth  int // number of files being sourced, which return ends too
+
+	// frames has a frame per function being run and file being sourced,
+	// for caller. file is the script or sourced file being read, "" for the
+	// standard input.
+	frames []callFrame
+	file   string
+
+	// locals has a frame per function being run, with the bindings its
+	// local variables hide, nil for those that were unset
+	locals []map[string]*variable
+
+	random *rand.Rand // generator behind $RANDOM
+
+	// $SECONDS counts the seconds since secondsStart, from secondsBase
+	secondsStart time.Time
+	secondsBase  int
+
+	getopts getoptsState
+
+	lineno int // line of the command running, as $LINENO
+
+	// dirs is the directory stack of pushd and popd below the current
+	// directory, the most recently pushed first
+	dirs []string
+
+	inErrTrap bool // whether the ERR trap is running, which can't trigger itself
+
+	// procFiles holds the shell's ends of the pipes to the process
+	// substitutions expanded for the command about to run
+	procFiles []*os.File
+
+	// fdChanges lists the descriptors past 2 that exec and coproc opened or
+	// closed in the shell's streams, in order. Streams set up before a change
+	// take it in as runList gets to their next command.
+	fdChanges []int
+
+	// keptFiles holds the copies of files a subshell's exec opened, which
+	// it closes as it ends
+	keptFiles []*os.File
+}
+
+// subshellExit is the panic value "exit" ends a subshell with.
+type subshellExit struct {
+	status int
+}
+
+func newShell(interactive bool, name string, args []string) *Shell {
+	sh := &Shell{
+		interactive: interactive,
+		name:        name,
+		args:        args,
+		vars:        loadEnviron(),
+		funcs:       make(map[string]*FuncDef),
+		traps:       make(map[string]string),
+		streams:     stdStreams,
+		aliases:     make(map[string]string),
+		completions: make(map[string]string),
+		hashed:      make(map[string]hashEntry),
+		random:      rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+
+		secondsStart: time.Now(),
+	}
+	sh.setVar("OPTIND", "1")
+	sh.opts.monitor = interactive
+	if wd, err := os.Getwd(); err == nil {
+		sh.dir = wd
+	}
+
+	// Until the first command, $_ is the shell's own path
+	if exe, err := os.Executable(); err == nil {
+		sh.lastArg = exe
+	}
+	return sh
+}
+
+// path resolves a relative path against the shell's working directory, for
+// the shell to find files where its commands would.
+func (sh *Shell) path(name string) string {
+	if name == "" || strings.HasPrefix(name, "/") || sh.dir == "" {
+		return name
+	}
+	return strings.TrimSuffix(sh.dir, "/") + "/" + name
+}
+
+// clone returns a copy of the shell to run commands on without affecting
+// the original.
+func (sh *Shell) clone() *Shell {
+	c := *sh
+	c.vars = copyVars(sh.vars)
+	c.funcs = maps.Clone(sh.funcs)
+	c.aliases = maps.Clone(sh.aliases)
+	c.completions = maps.Clone(sh.completions)
+	c.hashed = maps.Clone(sh.hashed)
+	c.disabled = maps.Clone(sh.disabled)
+	c.random = rand.New(rand.NewPCG(sh.random.Uint64(), sh.random.Uint64()))
+	c.locals = make([]map[string]*variable, len(sh.locals))
+	for i, frame := range sh.locals {
+		c.locals[i] = maps.Clone(frame)
+	}
+	c.dirs = slices.Clone(sh.dirs)
+	c.frames = slices.Clone(sh.frames)
+	c.procFiles = nil // the original's to close
+	c.fdChanges = slices.Clip(sh.fdChanges)
+	c.keptFiles = nil // the original's to close
+	return &c
+}
+
+// newSubshell returns a copy of the shell to run commands on as a subshell,
+// with s as its own streams.
+func (sh *Shell) newSubshell(s Streams) *Shell {
+	c := sh.clone()
+	c.subshell = true
+	c.streams = s
+
+	// The traps are reset, but for the signals ignored
+	c.traps = make(map[string]string)
+	for name, action := range sh.traps {
+		if action == "" {
+			c.traps[name] = action
+		}
+	}
+	return c
+}
+
+// runSubshell runs f in the subshell, returning its exit status or the one
+// the subshell exits with. Its EXIT trap runs as it ends either way.
+func (sh *Shell) runSubshell(f func() int) (status int) {
+	defer func() {
+		for _, f := range sh.keptFiles {
+			f.Close()
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			exit, ok := r.(subshellExit)
+			if !ok {
+				panic(r)
+			}
+			status = exit.status
+		}
+	}()
+	sh.exit(f())
+	return 0
+}
+
+// substitute runs a command substitution in a subshell, returning its
+// output without the trailing newlines.
+func (sh *Shell) substitute(rawCmd string) (string, error) {
+	list, err := sh.parse(rawCmd)
+	if err != nil {
+		return "", err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&out, r)
+		r.Close()
+		close(done)
+	}()
+
+	c := sh.newSubshell(Streams{Stdin: os.Stdin, Stdout: w, Stderr: os.Stderr, Files: sh.streams.Files, gen: sh.streams.gen})
+	sh.substStatus = c.runSubshell(func() int {
+		return c.runList(list, c.streams)
+	})
+	sh.status = sh.substStatus
+	w.Close()
+	<-done
+
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+// evaluateCommand parses and runs a command line, returning its exit status,
+// which is left in $? too: 2 for a syntax error, and unchanged for an empty
+// line.
+func (sh *Shell) evaluateCommand(rawCmd string) int {
+	list, err := sh.parse(rawCmd)
+	if err != nil {
+		fmt.Fprintf(sh.streams.Stderr, "%v\n", err)
+		sh.status = 2
+		return sh.status
+	}
+
+	return sh.runList(list, sh.streams)
+}
+
+// runList runs each and-or list in turn and returns the status of the last.
+func (sh *Shell) runList(list *List, s Streams) int {
+	for _, andOr := range list.Items {
+		if sh.unwinding() {
+			break
+		}
+		if sh.interrupted() {
+			sh.status = 128 + int(syscall.SIGINT)
+			break
+		}
+		s = sh.withShellFiles(s)
+		if andOr.Background {
+			sh.runBackground(andOr, s)
+			sh.status = 0
+			continue
+		}
+		sh.status = sh.runAndOr(andOr, s)
+	}
+	return sh.status
+}
+
+// runAndOr runs the pipelines of the chain, skipping those after a "&&"
+// when the status so far is a failure, and those after a "||" on success.
+//
+// With errexit, the shell exits when the last pipeline of the chain fails,
+// outside of a condition.
+func (sh *Shell) runAndOr(andOr *AndOr, s Streams) int {
+	last := 0
+	status := sh.runCondition(len(andOr.Ops) > 0, func() int {
+		return sh.runPipeline(andOr.Pipelines[0], s)
+	})
+	for i, op := range andOr.Ops {
+		if sh.unwinding() {
+			break
+		}
+		if (op == "&&") != (status == 0) {
+			continue
+		}
+		sh.status = status
+		last = i + 1
+		s = sh.withShellFiles(s)
+		status = sh.runCondition(last < len(andOr.Ops), func() int {
+			return sh.runPipeline(andOr.Pipelines[last], s)
+		})
+	}
+
+	// A failure that isn't tested runs the ERR trap, then ends the shell
+	// with errexit
+	if status != 0 && last == len(andOr.Ops) && !andOr.Pipelines[last].Negate && sh.conditions == 0 && !sh.unwinding() {
+		sh.status = status
+		if !sh.inErrTrap {
+			sh.inErrTrap = true
+			sh.runTrap("ERR")
+			sh.inErrTrap = false
+		}
+		if sh.opts.errexit {
+			sh.exit(status)
+		}
+	}
+	return status
+}
+
+// runCondition runs f, as a condition if cond is set.
+func (sh *Shell) runCondition(cond bool, f func() int) int {
+	if cond {
+		sh.conditions++
+		defer func() { sh.conditions-- }()
+	}
+	return f()
+}
+
+// runBackground starts the and-or list as a background job, on a copy of
+// the shell, and records it in the jobs table.
+func (sh *Shell) runBackground(andOr *AndOr, s Streams) {
+	sh.startJob(andOr.Source+" &", s, func(bg *Shell) int {
+		return bg.runAndOr(andOr, s)
+	})
+}
+
+// startJob runs f as a background job, on a copy of the shell, and adds it
+// to the jobs table.
+func (sh *Shell) startJob(command string, s Streams, f func(bg *Shell) int) *Job {
+	job := &Job{Command: command, noGroup: !sh.opts.monitor}
+
+	bg := sh.newSubshell(s)
+	bg.job = job
+	bg.interactive = false
+
+	task := job.addTask()
+	job.main = task
+	go func() {
+		job.finishTask(task, bg.runSubshell(func() int {
+			return f(bg)
+		}))
+	}()
+
+	// Wait for the job to either start a process or finish, so that its
+	// process group is known
+	jobs.Lock()
+	for job.Pgid == 0 && !task.done {
+		jobs.cond.Wait()
+	}
+	addJobLocked(job)
+	jobs.Unlock()
+
+	sh.lastBgPid = job.Pgid
+	if sh.interactive {
+		fmt.Fprintf(s.Stderr, "[%d] %d\n", job.ID, job.Pgid)
+		if sh.opts.notify && sh.opts.monitor {
+			go notifyWhenDone(job, s.Stderr)
+		}
+	}
+	return job
+}
+
+// runCoproc starts a coprocess, with its input and output connected to the
+// shell through pipes. The shell's ends are open as file descriptors, the
+// one to read the output from in ${NAME[0]} and the one to write the input
+// to in ${NAME[1]}, and $NAME_PID is its process id.
+func (sh *Shell) runCoproc(node *Coproc, s Streams) int {
+	// The shell's ends take the highest free descriptors from 63 down to
+	// 10, out of the way of those scripts open themselves
+	var fds []int
+	for fd := 63; fd >= 10 && len(fds) < 2; fd-- {
+		_, used := s.Files[fd]
+		_, shellUsed := sh.streams.Files[fd]
+		if !used && !shellUsed {
+			fds = append(fds, fd)
+		}
+	}
+	if len(fds) < 2 {
+		fmt.Fprintln(s.Stderr, "coproc: no free file descriptor")
+		return 1
+	}
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(s.Stderr, "coproc: %v\n", err)
+		return 1
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		fmt.Fprintf(s.Stderr, "coproc: %v\n", err)
+		return 1
+	}
+
+	cs := s
+	cs.Stdin, cs.Stdout = inR, outW
+	job := sh.startJob(node.Source, cs, func(bg *Shell) int {
+		defer inR.Close()
+		defer outW.Close()
+		return bg.runCommand(node.Body, cs)
+	})
+
+	files := maps.Clone(sh.streams.Files)
+	if files == nil {
+		files = make(map[int]*os.File)
+	}
+	files[fds[0]] = outR
+	files[fds[1]] = inW
+	sh.setShellFiles(files, fds)
+
+	sh.setArray(node.Name, []string{strconv.Itoa(fds[0]), strconv.Itoa(fds[1])})
+	sh.setVar(node.Name+"_PID", strconv.Itoa(job.Pgid))
+	return 0
+}
+
+// substituteProcess starts a process substitution, "<(...)" or, with output
+// set, ">(...)", running in the background with its output, or input, going
+// through a pipe. The shell's end of the pipe is returned, for the command
+// to reach as /dev/fd/N. It stays open until addProcessFiles takes it.
+func (sh *Shell) substituteProcess(rawCmd string, output bool) (*os.File, error) {
+	list, err := sh.parse(rawCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	ours, theirs := r, w
+	s := Streams{Stdin: os.Stdin, Stdout: w, Stderr: os.Stderr, Files: sh.streams.Files, gen: sh.streams.gen}
+	if output {
+		ours, theirs = w, r
+		s.Stdin, s.Stdout = r, os.Stdout
+	}
+
+	c := sh.newSubshell(s)
+	c.job = &Job{Command: rawCmd, noGroup: !sh.opts.monitor}
+	c.interactive = false
+	go func() {
+		c.runSubshell(func() int {
+			return c.runList(list, s)
+		})
+		theirs.Close()
+	}()
+
+	sh.procFiles = append(sh.procFiles, ours)
+	return ours, nil
+}
+
+// addProcessFiles passes the ends of the pipes to the process substitutions
+// expanded so far on to the programs run with the streams, returning a
+// function to close them once the command is done.
+func (sh *Shell) addProcessFiles(s *Streams) func() {
+	files := sh.procFiles
+	sh.procFiles = nil
+	if len(files) > 0 {
+		s.Files = maps.Clone(s.Files)
+		for _, f := range files {
+			s.Files[int(f.Fd())] = f
+		}
+	}
+	return func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+}
+
+// unwinding reports whether a break, continue or return is leaving the
+// commands being run.
+func (sh *Shell) unwinding() bool {
+	return sh.breaking > 0 || sh.continuing > 0 || sh.returning
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// foregroundPgid is the process group of the external command running in the
+// foreground, or 0 while the shell itself is in control.
+var foregroundPgid atomic.Int64
+
+// interruptFlag is set when the user interrupts the command being run, for
+// the rest of the command line to be skipped too.
+var interruptFlag atomic.Bool
+
+// sigCh receives every signal the shell catches, the keyboard signals as well
+// as those with a trap set.
+var sigCh = make(chan os.Signal, 1)
+
+// exitPending is set when a signal that ends the shell arrives while it's
+// busy, for it to stop waiting on its jobs and exit.
+var exitPending atomic.Bool
+
+// signalsHandled counts the signals the shell has handled.
+var signalsHandled atomic.Int64
+
+// shellSignals are the signals the shell always catches: the keyboard signals
+// and those it handles the way a shell does when they aren't trapped.
+var shellSignals = []syscall.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTSTP, syscall.SIGHUP, syscall.SIGTERM}
+
+// handleSignals catches the keyboard signals so that they interrupt or
+// suspend the foreground job rather than the shell, and runs the traps set
+// for caught signals. Untrapped, a hangup ends the shell, and an interrupt or
+// termination ends it unless it's interactive.
+func handleSignals(sh *Shell) {
+	for _, sig := range shellSignals {
+		// A script started with a signal ignored, as in the background of
+		// another shell, keeps ignoring it
+		if !sh.interactive && signal.Ignored(sig) {
+			continue
+		}
+		signal.Notify(sigCh, sig)
+	}
+
+	go func() {
+		for sig := range sigCh {
+			sh.handleSignal(sig.(syscall.Signal))
+			signalsHandled.Add(1)
+		}
+	}()
+}
+
+// handleSignal acts on a signal the shell caught.
+func (sh *Shell) handleSignal(sig syscall.Signal) {
+	pgid := foregroundPgid.Load()
+	if pgid != 0 && isKeyboardSignal(sig) {
+		syscall.Kill(-int(pgid), sig)
+	}
+
+	_, trapped := sh.getTrap(signalName(sig))
+	fatal := !trapped && sh.endsShell(sig)
+
+	// Busy with a command, the shell leaves the signal for when it's done,
+	// be it to run the trap or to exit
+	if !evalMu.TryLock() {
+		if trapped || fatal {
+			queueTrap(sig)
+		}
+		if fatal {
+			exitPending.Store(true)
+			jobs.Lock()
+			jobs.cond.Broadcast()
+			jobs.Unlock()
+		}
+		if sig == syscall.SIGINT && !trapped {
+			interruptFlag.Store(true)
+		}
+		return
+	}
+	defer evalMu.Unlock()
+
+	if fatal {
+		sh.exitOnSignal(sig)
+	}
+
+	// The shell is idle at the prompt, run the trap right away and start
+	// over with a fresh prompt
+	atPrompt := sh.interactive && sig == syscall.SIGINT
+	if atPrompt {
+		fmt.Fprintln(os.Stdout)
+	}
+	if trapped {
+		sh.runTrap(signalName(sig))
+	}
+	if atPrompt {
+		fmt.Fprint(os.Stdout, sh.ps1())
+	}
+}
+
+// endsShell reports whether sig ends the shell when it isn't trapped: a
+// hangup does, and an interrupt or a termination does unless the shell is
+// interactive.
+func (sh *Shell) endsShell(sig syscall.Signal) bool {
+	return sig == syscall.SIGHUP || !sh.interactive && (sig == syscall.SIGINT || sig == syscall.SIGTERM)
+}
+
+// exitOnSignal exits the shell as killed by sig. A hangup takes the jobs
+// down with the shell, but for those that were disowned. The caller must hold
+// evalMu.
+func (sh *Shell) exitOnSignal(sig syscall.Signal) {
+	if sig == syscall.SIGHUP {
+		hangupJobs()
+	}
+	interruptFlag.Store(false) // for the EXIT trap to run
+	sh.exit(128 + int(sig))
+}
+
+// killSelf sends sig to the shell itself and waits for it to be handled, so
+// that it has acted on it by the next command, be it to run the trap or to
+// exit.
+func killSelf(sig syscall.Signal) error {
+	handled := signalsHandled.Load()
+	if err := syscall.Kill(os.Getpid(), sig); err != nil {
+		return err
+	}
+	if signal.Ignored(sig) {
+		return nil
+	}
+	for deadline := time.Now().Add(time.Second); signalsHandled.Load() == handled && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+func isShellSignal(sig syscall.Signal) bool {
+	return slices.Contains(shellSignals, sig)
+}
+
+func isKeyboardSignal(sig syscall.Signal) bool {
+	return sig == syscall.SIGINT || sig == syscall.SIGQUIT || sig == syscall.SIGTSTP
+}
+
+// interrupted reports whether the user interrupted the command being run.
+// Background jobs aren't affected.
+func (sh *Shell) interrupted() bool {
+	return interruptFlag.Load() && (sh.job == nil || sh.job.foreground)
+}
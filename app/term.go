@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// ttyFd is the file descriptor of the controlling terminal when the shell
+// runs interactively, -1 otherwise.
+var ttyFd = -1
+
+// initTerminal takes note of the controlling terminal and makes the shell
+// immune to the signals sent when a background process group touches it, so
+// that the terminal can be handed back and forth between jobs.
+func initTerminal() {
+	if !isTerminal(os.Stdin) {
+		return
+	}
+
+	ttyFd = int(os.Stdin.Fd())
+	signal.Ignore(syscall.SIGTTOU, syscall.SIGTTIN)
+}
+
+// tcsetpgrp makes pgid the foreground process group of the terminal.
+func tcsetpgrp(fd int, pgid int) error {
+	pgid32 := int32(pgid)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&pgid32)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// reclaimTerminal puts the shell back in the foreground of the terminal.
+func reclaimTerminal() {
+	if ttyFd < 0 {
+		return
+	}
+	tcsetpgrp(ttyFd, syscall.Getpgrp())
+}
+
+// makeRaw puts the terminal in raw mode, for the line editor to get every
+// key as it's typed, and returns the state to restore.
+func makeRaw(fd int) (*syscall.Termios, error) {
+	var saved syscall.Termios
+	if err := ioctlTermios(fd, syscall.TCGETS, &saved); err != nil {
+		return nil, err
+	}
+
+	raw := saved
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// restoreTerminal puts the terminal back in the state makeRaw saved.
+func restoreTerminal(fd int, state *syscall.Termios) {
+	ioctlTermios(fd, syscall.TCSETS, state)
+}
+
+func ioctlTermios(fd int, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// termColumns returns the width of the terminal fd is open on, or 80 when
+// it's unknown.
+func termColumns(fd int) int {
+	var ws struct{ Row, Col, Xpixel, Ypixel uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.Col == 0 {
+		return 80
+	}
+	return int(ws.Col)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// ptyShell is an interactive gosh running on a pseudo-terminal.
+type ptyShell struct {
+	t   *testing.T
+	pty *os.File
+	cmd *exec.Cmd
+
+	mu  sync.Mutex
+	out bytes.Buffer
+}
+
+// startPtyShell starts gosh on a new pseudo-terminal, as its controlling
+// terminal, and waits for its first prompt.
+func startPtyShell(t *testing.T) *ptyShell {
+	t.Helper()
+	pty, tty := openPty(t)
+	cmd := goshCommand(t.TempDir())
+	cmd.Env = append(cmd.Env, "PS1=$ ", "TERM=dumb")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	tty.Close()
+
+	p := &ptyShell{t: t, pty: pty, cmd: cmd}
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := pty.Read(buf)
+			p.mu.Lock()
+			p.out.Write(buf[:n])
+			p.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		pty.Close()
+	})
+	p.expect("$ ")
+	return p
+}
+
+// send types s at the terminal.
+func (p *ptyShell) send(s string) {
+	p.t.Helper()
+	if _, err := p.pty.WriteString(s); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+// expect waits for the shell to print s, and returns the output before it,
+// which is dropped.
+func (p *ptyShell) expect(s string) string {
+	p.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		p.mu.Lock()
+		out := p.out.String()
+		if i := strings.Index(out, s); i >= 0 {
+			p.out.Next(i + len(s))
+			p.mu.Unlock()
+			return out[:i]
+		}
+		p.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.t.Fatalf("timed out waiting for %q, got %q", s, p.out.String())
+	return ""
+}
+
+// openPty opens a new pseudo-terminal, returning its master and slave ends.
+func openPty(t *testing.T) (pty, tty *os.File) {
+	t.Helper()
+	pty, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	var unlock int32
+	var n uint32
+	if err := ioctl(pty, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioctl(pty, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		t.Fatal(err)
+	}
+	tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pty, tty
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func TestInterruptForeground(t *testing.T) {
+	sh := startPtyShell(t)
+	sh.send("sleep 100; echo not interrupted\r")
+	time.Sleep(200 * time.Millisecond)
+	sh.send("\x03")
+	sh.send("echo alive $?\r")
+	if out := sh.expect("alive 130"); strings.Contains(out, "\nnot interrupted") {
+		t.Errorf("the rest of the line ran after the interrupt: %q", out)
+	}
+}
+
+func TestInteractiveSignals(t *testing.T) {
+	sh := startPtyShell(t)
+	sh.send("kill -TERM $$; echo still $((6 * 7))\r")
+	sh.expect("still 42")
+	sh.send("kill -INT $$\r")
+	sh.send("echo alive $((6 * 7))\r")
+	sh.expect("alive 42")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// signalNames maps the names accepted by trap, without the "SIG" prefix, to
+// their signals. EXIT is the pseudo-signal raised when the shell exits. The
+// other pseudo-signal, ERR, raised when a command fails, is left out for
+// having no number.
+var signalNames = map[string]syscall.Signal{
+	"EXIT":  0,
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"ABRT":  syscall.SIGABRT,
+	"KILL":  syscall.SIGKILL,
+	"ALRM":  syscall.SIGALRM,
+	"TERM":  syscall.SIGTERM,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"CHLD":  syscall.SIGCHLD,
+	"CONT":  syscall.SIGCONT,
+	"STOP":  syscall.SIGSTOP,
+	"TSTP":  syscall.SIGTSTP,
+	"TTIN":  syscall.SIGTTIN,
+	"TTOU":  syscall.SIGTTOU,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// traps guards the trap commands of the shells, which the signal handler
+// reads, and holds the signals caught while the shell was busy whose traps
+// still have to run.
+var traps struct {
+	sync.Mutex
+	pending []syscall.Signal
+}
+
+// evalMu is held while the shell evaluates a command, traps run only
+// once it's free.
+var evalMu sync.Mutex
+
+// signalName returns the trap name of sig, e.g. "INT" for SIGINT.
+func signalName(sig syscall.Signal) string {
+	for name, s := range signalNames {
+		if s == sig {
+			return name
+		}
+	}
+	return strconv.Itoa(int(sig))
+}
+
+// parseSignal resolves a signal given by name, with or without the "SIG"
+// prefix, or by number.
+func parseSignal(spec string) (string, syscall.Signal, error) {
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	if sig, ok := signalNames[name]; ok {
+		return name, sig, nil
+	}
+
+	if n, err := strconv.Atoi(spec); err == nil {
+		for name, sig := range signalNames {
+			if int(sig) == n {
+				return name, sig, nil
+			}
+		}
+	}
+
+	return "", 0, fmt.Errorf("%s: invalid signal specification", spec)
+}
+
+func (sh *Shell) getTrap(name string) (string, bool) {
+	traps.Lock()
+	defer traps.Unlock()
+
+	action, ok := sh.traps[name]
+	return action, ok
+}
+
+// queueTrap leaves the trap for sig to runPendingTraps, once the command
+// the shell is busy with is done.
+func queueTrap(sig syscall.Signal) {
+	traps.Lock()
+	traps.pending = append(traps.pending, sig)
+	traps.Unlock()
+}
+
+// runPendingTraps runs the traps of the signals that arrived while the shell
+// was busy, or exits for those that end it untrapped. It's called between commands, so that a trap runs as soon as the
+// command it interrupted is done. The caller must hold evalMu. Subshells
+// leave the traps to the shell.
+func (sh *Shell) runPendingTraps() {
+	if sh.subshell {
+		return
+	}
+
+	traps.Lock()
+	pending := traps.pending
+	traps.pending = nil
+	exitPending.Store(false)
+	traps.Unlock()
+
+	for _, sig := range pending {
+		if _, trapped := sh.getTrap(signalName(sig)); !trapped && sh.endsShell(sig) {
+			sh.exitOnSignal(sig)
+		}
+		sh.runTrap(signalName(sig))
+	}
+}
+
+// runTrap runs the trap set for name, leaving $? as it was.
+func (sh *Shell) runTrap(name string) {
+	if action, ok := sh.getTrap(name); ok && action != "" {
+		status := sh.status
+		sh.evaluateCommand(action)
+		sh.status = status
+	}
+}
+
+// exit runs the EXIT trap, if any, and exits the shell with status. In a
+// subshell, only the subshell ends.
+func (sh *Shell) exit(status int) {
+	traps.Lock()
+	action, ok := sh.traps["EXIT"]
+	delete(sh.traps, "EXIT")
+	traps.Unlock()
+
+	if ok && action != "" {
+		sh.status = status
+		sh.evaluateCommand(action)
+	}
+
+	if sh.subshell {
+		panic(subshellExit{status})
+	}
+	os.Exit(status)
+}
+
+// quoteString single-quotes s so that the shell reads it back unchanged.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (sh *Shell) executeTrapCmd(cmd *Command) int {
+	args := cmd.Args
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	// List the traps currently set
+	if len(args) == 0 || args[0] == "-p" {
+		traps.Lock()
+		defer traps.Unlock()
+
+		names := make([]string, 0, len(sh.traps))
+		for name := range sh.traps {
+			names = append(names, name)
+		}
+		slices.SortFunc(names, func(a, b string) int {
+			return int(signalNames[a]) - int(signalNames[b])
+		})
+
+		for _, name := range names {
+			label := name
+			if name != "EXIT" && name != "ERR" {
+				label = "SIG" + name
+			}
+			fmt.Fprintf(cmd.Stdout, "trap -- %s %s\n", quoteString(sh.traps[name]), label)
+		}
+		return 0
+	}
+
+	if len(args) == 1 {
+		fmt.Fprintln(cmd.Stderr, "trap: usage: trap [-p] [action signal_spec ...]")
+		return 2
+	}
+
+	status := 0
+	action := args[0]
+	for _, spec := range args[1:] {
+		name, sig, err := parseSignal(spec)
+		if strings.TrimPrefix(strings.ToUpper(spec), "SIG") == "ERR" {
+			name, sig, err = "ERR", 0, nil
+		}
+		if err != nil {
+			fmt.Fprintf(cmd.Stderr, "trap: %v\n", err)
+			status = 1
+			continue
+		}
+
+		traps.Lock()
+		if action == "-" {
+			delete(sh.traps, name)
+		} else {
+			sh.traps[name] = action
+		}
+		traps.Unlock()
+
+		// The signals the shell handles itself are always caught, the
+		// others only while a trap is set for them. Signals reach the
+		// process the subshells share with the shell, so they're the
+		// shell's to handle.
+		if sig == 0 || isShellSignal(sig) || sh.subshell {
+			continue
+		}
+		switch action {
+		case "-":
+			signal.Reset(sig)
+		case "":
+			signal.Ignore(sig)
+		default:
+			signal.Notify(sigCh, sig)
+		}
+	}
+
+	return status
+}
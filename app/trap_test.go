@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestTrapDuringLoop(t *testing.T) {
+	loop := "trap 'echo got; exit 3' TERM\n{ sleep 0.2; kill -TERM $$; } &\nwhile true; do sleep 0.1; done\n"
+	runScriptTests(t, []scriptTest{
+		{"script", loop, "got\n"},
+		{"sourced", "echo " + quoteString(loop) + " > loop.sh\n. ./loop.sh\n", "got\n"},
+	})
+
+	out, _, status := runScript(t, loop, "")
+	if out != "got\n" || status != 3 {
+		t.Errorf("got %q with status %d, want %q with status 3", out, status, "got\n")
+	}
+}
+
+func TestTrapInSubshell(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"substitution", "x=$(trap 'echo x' EXIT; echo in)\necho \"[$x]\"\ntrap\n", "[in\nx]\n"},
+		{"reset", "trap 'echo main' EXIT\nx=$(echo in)\necho $x\n", "in\nmain\n"},
+		{"listed", "trap 'echo main' EXIT\ntrap '' USR1\necho \"$(trap)\"\ntrap - EXIT\n", "trap -- '' SIGUSR1\n"},
+		{"pipeline stage", "echo done | { trap 'echo stage exit' EXIT; cat; }\n", "done\nstage exit\n"},
+		{"exit status", "x=$(trap 'echo $?' EXIT; exit 4); echo $x $?\n", "4 4\n"},
+	})
+}
+
+func TestTrapExitAndErr(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"exit at the end", "trap 'echo bye' EXIT\necho hi\n", "hi\nbye\n"},
+		{"exit builtin", "trap 'echo bye' EXIT\nexit 3\necho no\n", "bye\n"},
+		{"exit from the trap", "trap 'echo bye; exit' EXIT\necho hi\n", "hi\nbye\n"},
+		{"exit from a function", "trap 'echo bye' EXIT\nf() { exit; }\nf\necho no\n", "bye\n"},
+		{"err", "trap 'echo err $?' ERR\nfalse\ntrue\nf() { return 4; }\nf\necho done\n", "err 1\nerr 4\ndone\n"},
+		{"err not in conditions", "trap 'echo err' ERR\nif false; then :; fi\nfalse || true\n! true\nwhile false; do :; done\necho done\n", "done\n"},
+		{"err then exit", "trap 'echo bye' EXIT\ntrap 'echo err' ERR\nfalse\n", "err\nbye\n"},
+	})
+
+	_, _, status := runScript(t, "trap 'echo bye' EXIT\nexit 3\n", "")
+	if status != 3 {
+		t.Errorf("got status %d after the EXIT trap, want 3", status)
+	}
+}
+
+func TestUntrappedSignals(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+		status int
+	}{
+		{"interrupt", "trap 'echo bye' EXIT\nkill -INT $$\necho no\n", "bye\n", 130},
+		{"termination", "trap 'echo bye' EXIT\nkill $$\necho no\n", "bye\n", 143},
+		{"from a function", "f() { kill -TERM $$; }\nf\necho no\n", "", 143},
+		{"hangup", "trap 'echo bye' EXIT\nkill -HUP $$\necho no\n", "bye\n", 129},
+		{"during a program", "trap '[ -e done ] || echo early' EXIT\nsh -c 'kill -TERM $PPID; sleep 1; touch done' >/dev/null 2>&1\necho no\n", "early\n", 143},
+		{"during wait", "trap 'echo bye' EXIT\nsleep 1 >/dev/null 2>&1 &\nkill $$\nwait\necho no\n", "bye\n", 143},
+		{"trapped during a program", "trap 'echo got' TERM\nsh -c 'kill -TERM $PPID; sleep 0.1; echo child'\necho yes\n", "child\ngot\nyes\n", 0},
+		{"trapped", "trap 'echo got' INT\nkill -INT $$\necho yes\n", "got\nyes\n", 0},
+		{"ignored", "trap '' TERM\nkill $$\necho yes\n", "yes\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _, status := runScript(t, tt.script, "")
+			if out != tt.want || status != tt.status {
+				t.Errorf("got %q with status %d, want %q with status %d", out, status, tt.want, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// variable is a shell variable. Exported variables are passed on to the
+// environment of the programs the shell runs. The values assigned to integer
+// variables are evaluated as arithmetic expressions, and read-only variables
+// can't be assigned at all.
+type variable struct {
+	value    string
+	array    *indexedArray // elements of an indexed array, nil if not one
+	exported bool
+	integer  bool
+	readonly bool
+}
+
+// declarationBuiltins lists the builtins whose arguments that are
+// assignments are expanded like assignments, and may assign arrays.
+var declarationBuiltins = []string{"declare", "typeset", "local", "readonly"}
+
+// loadEnviron returns the variables of the shell's own environment, all of
+// them exported.
+func loadEnviron() map[string]*variable {
+	vars := make(map[string]*variable)
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			vars[name] = &variable{value: value, exported: true}
+		}
+	}
+	return vars
+}
+
+// copyVars returns a copy of the variables, for a copy of the shell to
+// change without affecting the original.
+func copyVars(vars map[string]*variable) map[string]*variable {
+	c := make(map[string]*variable, len(vars))
+	for name, v := range vars {
+		vc := *v
+		if v.array != nil {
+			vc.array = v.array.clone()
+		}
+		c[name] = &vc
+	}
+	return c
+}
+
+// setVar sets a shell variable, keeping it exported if it already was.
+func (sh *Shell) setVar(name, value string) {
+	if sh.setDynamicVar(name, value) {
+		return
+	}
+	if v, ok := sh.vars[name]; ok && v.array != nil {
+		sh.setElement(name, 0, value)
+	} else if ok {
+		v.value = value
+	} else {
+		sh.vars[name] = &variable{value: value}
+	}
+
+	switch name {
+	case "HISTSIZE":
+		sh.trimHistory()
+	case "PATH":
+		// The programs are to be looked up in the new directories
+		clear(sh.hashed)
+	}
+}
+
+// assignVar sets a shell variable for an assignment, which fails if it's
+// read-only. The value of an integer variable is evaluated first.
+func (sh *Shell) assignVar(name, value string) error {
+	if err := sh.checkWritable(name); err != nil {
+		return err
+	}
+	if v, ok := sh.vars[name]; ok && v.integer {
+		n, err := sh.evalArith(value)
+		if err != nil {
+			return err
+		}
+		value = strconv.FormatInt(n, 10)
+	}
+	sh.setVar(name, value)
+	return nil
+}
+
+// checkWritable returns an error if a variable is read-only.
+func (sh *Shell) checkWritable(name string) error {
+	if v, ok := sh.vars[name]; ok && v.readonly {
+		return fmt.Errorf("%s: readonly variable", name)
+	}
+	return nil
+}
+
+// exportVar sets a shell variable and exports it.
+func (sh *Shell) exportVar(name, value string) {
+	sh.setVar(name, value)
+	if v, ok := sh.vars[name]; ok {
+		v.exported = true
+	}
+}
+
+// environ returns the environment for the programs run by the shell, in the
+// "name=value" form.
+func (sh *Shell) environ() []string {
+	env := make([]string, 0, len(sh.vars))
+	for name, v := range sh.vars {
+		// Arrays can't be exported
+		if v.exported && v.array == nil {
+			env = append(env, name+"="+v.value)
+		}
+	}
+	slices.Sort(env)
+	return env
+}
+
+// isAssignment reports whether a raw word is a variable assignment, i.e.
+// starts with an unquoted "NAME=" or "NAME[subscript]=", or "+=" instead of
+// "=" to append.
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	name = strings.TrimSuffix(name, "+")
+	if _, _, isElement := cutSubscript(name); isElement {
+		return ok
+	}
+	return ok && isName(name)
+}
+
+// cutAssignment splits an assignment into the name assigned and the value,
+// reporting whether it appends to the variable, "NAME+=value".
+func cutAssignment(word string) (name, value string, appending bool) {
+	name, value, _ = strings.Cut(word, "=")
+	name, appending = strings.CutSuffix(name, "+")
+	return name, value, appending
+}
+
+// appendedValue returns the value a variable, or an array element, is
+// assigned when appending value to it: the two concatenated, or added up
+// for an integer variable.
+func (sh *Shell) appendedValue(name, value string) (string, error) {
+	cur, _ := sh.getVar(name)
+	array, _, isElement := cutSubscript(name)
+	if !isElement {
+		array = name
+	}
+	if v, ok := sh.vars[array]; !ok || !v.integer {
+		return cur + value, nil
+	}
+
+	x, err := sh.evalArith(cur)
+	if err != nil {
+		return "", err
+	}
+	y, err := sh.evalArith(value)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(x+y, 10), nil
+}
+
+// isName reports whether s is a valid variable name.
+func isName(s string) bool {
+	for i, r := range s {
+		if !isNameChar(r) || (i == 0 && !isNameStart(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// assign expands and performs the variable assignments of a command. With
+// temporary set, the assigned variables are exported and the returned
+// function restores their previous state, for assignments preceding a
+// command that only apply while it runs.
+func (sh *Shell) assign(assigns []string, temporary bool) (func(), error) {
+	saved := make(map[string]*variable)
+	restore := func() {
+		for name, v := range saved {
+			if v == nil {
+				delete(sh.vars, name)
+			} else {
+				sh.vars[name] = v
+			}
+		}
+	}
+
+	for _, word := range assigns {
+		name, raw, appending := cutAssignment(word)
+
+		array, sub, isElement := cutSubscript(name)
+		if !isElement {
+			array = name
+		}
+		if err := sh.checkWritable(array); err != nil {
+			restore()
+			return nil, err
+		}
+
+		// Arrays, and their elements, are assigned for good
+		if strings.HasPrefix(raw, "(") {
+			if err := sh.assignArray(name, raw, appending); err != nil {
+				restore()
+				return nil, err
+			}
+			continue
+		}
+
+		value, err := sh.expandAssignment(raw)
+		if err == nil && appending {
+			value, err = sh.appendedValue(name, value)
+		}
+		if err != nil {
+			restore()
+			return nil, err
+		}
+
+		if isElement {
+			if err := sh.assignElement(array, sub, value); err != nil {
+				restore()
+				return nil, err
+			}
+			continue
+		}
+
+		if !temporary {
+			if err := sh.assignVar(name, value); err != nil {
+				restore()
+				return nil, err
+			}
+			continue
+		}
+		if _, ok := saved[name]; !ok {
+			saved[name] = sh.vars[name]
+		}
+		sh.vars[name] = &variable{value: value, exported: true}
+	}
+
+	return restore, nil
+}
+
+// getDynamicVar returns the value of the variables computed anew on every
+// expansion, like $RANDOM.
+func (sh *Shell) getDynamicVar(name string) (string, bool) {
+	switch name {
+	case "RANDOM":
+		return strconv.Itoa(sh.random.IntN(32768)), true
+	case "SECONDS":
+		return strconv.Itoa(sh.secondsBase + int(time.Since(sh.secondsStart).Seconds())), true
+	case "LINENO":
+		return strconv.Itoa(sh.lineno), true
+	}
+	return "", false
+}
+
+// setDynamicVar handles assignments to the dynamic variables, reporting
+// whether name is one. Assigning $RANDOM seeds its generator, and assigning
+// $SECONDS has it count on from the value assigned.
+func (sh *Shell) setDynamicVar(name, value string) bool {
+	switch name {
+	case "RANDOM":
+		seed, _ := strconv.ParseInt(value, 10, 64)
+		sh.random = rand.New(rand.NewPCG(uint64(seed), 0))
+		return true
+	case "SECONDS":
+		sh.secondsBase, _ = strconv.Atoi(value)
+		sh.secondsStart = time.Now()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestRandom(t *testing.T) {
+	sh := newShell(false, "gosh", nil)
+	draw := func(n int) []string {
+		var values []string
+		for range n {
+			value, _ := sh.getVar("RANDOM")
+			if n, err := strconv.Atoi(value); err != nil || n < 0 || n > 32767 {
+				t.Fatalf("$RANDOM is %q, out of 0..32767", value)
+			}
+			values = append(values, value)
+		}
+		return values
+	}
+
+	if values := draw(10); len(slices.Compact(slices.Sorted(slices.Values(values)))) == 1 {
+		t.Errorf("$RANDOM didn't change in 10 expansions: %q", values)
+	}
+
+	sh.setVar("RANDOM", "42")
+	first := draw(5)
+	sh.setVar("RANDOM", "42")
+	if again := draw(5); !slices.Equal(first, again) {
+		t.Errorf("seeding with the same value gave %q, then %q", first, again)
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"increases", "a=$SECONDS; sleep 1.1; [ $SECONDS -gt $a ] && echo increased\n", "increased\n"},
+		{"rebased", "SECONDS=100; echo $SECONDS; sleep 1.1; echo $SECONDS\n", "100\n101\n"},
+	})
+}
+
+func TestAppendAssign(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"string", "P=/usr\nP+=:/opt/bin\necho $P\n", "/usr:/opt/bin\n"},
+		{"unset", "u+=x\necho $u\n", "x\n"},
+		{"array", "a=(a b)\na+=(c d)\necho ${#a[@]} ${a[@]}\n", "4 a b c d\n"},
+		{"array element 0", "a=(a b)\na+=e\necho ${a[@]}\n", "ae b\n"},
+		{"string to array", "s=ab\ns+=(x)\necho ${#s[@]} ${s[@]}\n", "2 ab x\n"},
+		{"integer", "declare -i n=5\nn+=3\nn+=2*2\necho $n\n", "12\n"},
+		{"local", "f() { local v=1; v+=2; echo $v; }\nf\n", "12\n"},
+		{"command prefix", "P=a\nP+=b sh -c 'echo $P'\necho $P\n", "ab\na\n"},
+	})
+}
+
+func TestLineno(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"lines", "echo $LINENO\n\n# comment\necho $LINENO\necho $LINENO\n", "1\n4\n5\n"},
+		{"compound commands", "if true; then\n  echo $LINENO\nfi\nfor i in 1; do\n  echo $LINENO\ndone\n", "2\n5\n"},
+		{"functions", "f() {\n  echo $LINENO\n}\nf\nf\n", "2\n2\n"},
+		{"sourced", "printf 'echo one\\necho $LINENO\\n' >lib.sh\n. ./lib.sh\necho $LINENO\n", "one\n2\n3\n"},
+	})
+}
+
+func TestPrefixAssignments(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"argument", "FOO=1 echo BAR=2\necho \"[$FOO] [$BAR]\"\n", "BAR=2\n[] []\n"},
+		{"environment", "FOO=1 BAZ=3 printenv FOO BAZ\nprintenv FOO || echo unset\n", "1\n3\nunset\n"},
+		{"child", "echo 'echo \"$FOO $1 [$BAR]\"' >child.sh\nFOO=1 $GOSH child.sh BAR=2\n", "1 BAR=2 []\n"},
+		{"only assignments", "x=1 y=$x\necho $x $y\n", "1 1\n"},
+		{"after an argument", "echo a b=c d=e\n", "a b=c d=e\n"},
+		{"after a redirection", ">out FOO=1 printenv FOO\ncat out\n", "1\n"},
+	})
+}
+
+func TestLastArg(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"last argument", "echo hello world; echo $_\n", "hello world\nworld\n"},
+		{"quoted", "echo a 'b c' >/dev/null; echo \"$_\"\n", "b c\n"},
+		{"command name", "true; echo $_\n", "true\n"},
+		{"cd $_", "mkdir -p a/b; cd $_; echo ${PWD#$HOME/}\n", "a/b\n"},
+		{"after assignments", "echo x; y=1; echo \"[$_]\"\n", "x\n[]\n"},
+		{"at startup", "case $_ in /*) echo path;; *) echo \"$_\";; esac\n", "path\n"},
+	})
+}